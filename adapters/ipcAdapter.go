@@ -26,11 +26,11 @@ func InstantiateAdapter(grpcContext *GrpcContext) ports.IpcPort {
 }
 
 // LoadConfigFile causes the server to load the config file.
-func (adapter *ipcAdapterImpl) LoadConfigFile(path string) error {
+func (adapter *ipcAdapterImpl) LoadConfigFiles(paths []string) error {
 	client := adapter.grpcContext.client
 	ctx, cancel := adapter.grpcContext.newCtxWithDefaultTimeout()
 	defer cancel()
-	reply, err := client.LoadConfigFile(ctx, &pb.LoadRequest{Destination: path})
+	reply, err := client.LoadConfigFile(ctx, &pb.LoadRequest{Destinations: paths})
 	if err != nil {
 		log.Debugf("Received unexpected error %s", err)
 		return err
@@ -55,16 +55,65 @@ func (adapter *ipcAdapterImpl) GetMatchingServer(query string) (*domain.Match, e
 		return nil, err
 	}
 
-	server := domain.Server{
-		Host:     response.Server.Info.Host,
-		Dir:      response.Server.Info.Directory,
-		Port:     int(response.Server.Port),
-		Username: response.Server.Username,
-		Password: response.Server.Password,
+	return mapMatch(response), nil
+}
+
+// GetMatchingServers asks the server for all entries matching the filter.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) GetMatchingServers(filter *domain.Filter, limit int) ([]domain.Match, error) {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newCtxWithDefaultTimeout()
+	defer cancel()
+
+	response, err := client.MatchAll(ctx, createRequestFromFilters(filter, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []domain.Match
+	for _, match := range response.Matches {
+		result = append(result, *mapMatch(match))
+	}
+	return result, nil
+}
+
+func mapMatch(response *pb.MatchReply) *domain.Match {
+	var jumps []domain.Hop
+	for _, hop := range response.Jumps {
+		jumps = append(jumps, domain.Hop{Tag: hop.Tag, Server: mapServer(hop.Server)})
 	}
 
 	return &domain.Match{Tag: response.Tag,
-		Server: server}, nil
+		Server:  mapServer(response.Server),
+		Jumps:   jumps,
+		Labels:  response.Labels,
+		Aliases: response.Aliases}
+}
+
+func mapServer(server *pb.Server) domain.Server {
+	return domain.Server{
+		Host:           server.Info.Host,
+		Dir:            server.Info.Directory,
+		Port:           int(server.Port),
+		Username:       server.Username,
+		Password:       server.Password,
+		PrivateKey:     server.PrivateKey,
+		HostKeys:       server.HostKeys,
+		Forwards:       mapForwards(server.Forwards),
+		Record:         server.Record,
+		Shell:          server.Shell,
+		StartupCommand: server.StartupCommand,
+		Env:            server.Env,
+		Sources:        server.Sources,
+	}
+}
+
+func mapForwards(pbForwards []*pb.Forward) []domain.Forward {
+	var result []domain.Forward
+	for _, f := range pbForwards {
+		result = append(result, domain.Forward{Type: f.Type, Listen: f.Listen, Target: f.Target})
+	}
+	return result
 }
 
 // GetEntries asks the server for all entries in the config file and returns these.
@@ -89,6 +138,8 @@ func (adapter *ipcAdapterImpl) GetEntries(filter *domain.Filter, limit int) (*do
 			conn := domain.ConnectionInfo{
 				Tag:      entry.Tag,
 				HostInfo: fmt.Sprintf("%s:%s", entry.Info.Host, entry.Info.Directory),
+				Source:   entry.Source,
+				Aliases:  entry.Aliases,
 			}
 			entryList = append(entryList, conn)
 		}
@@ -122,6 +173,9 @@ func createRequestFromFilters(filter *domain.Filter, limit int) *pb.ListRequest
 		if filter.HasFreeFilter() {
 			pf.Free = filter.FreeFilter
 		}
+		if filter.HasLabelFilters() {
+			pf.Labels = filter.LabelFilters
+		}
 	}
 
 	return request
@@ -134,7 +188,7 @@ func (adapter *ipcAdapterImpl) MatchClosestN(query string) []string {
 	defer cancel()
 	response, err := client.MatchN(ctx, &pb.MatchNRequest{
 		Query:           query,
-		NumberOfResults: 3,
+		NumberOfResults: 20,
 	})
 
 	if err != nil {
@@ -144,6 +198,255 @@ func (adapter *ipcAdapterImpl) MatchClosestN(query string) []string {
 	return response.Tags
 }
 
+// GetHostKeys asks the server for the pinned host keys of the entry with given tag, or all entries if the tag is empty.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) GetHostKeys(tag string) ([]domain.HostKeys, error) {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newCtxWithDefaultTimeout()
+	defer cancel()
+
+	response, err := client.ListHostKeys(ctx, &pb.ListHostKeysRequest{Tag: tag})
+	if err != nil {
+		return nil, err
+	}
+
+	return mapHostKeys(response.HostKeys), nil
+}
+
+// AddHostKey asks the server to pin the host key for the entry with given tag.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) AddHostKey(tag string, key string) error {
+	client := adapter.grpcContext.client
+	// the server re-encrypts the config file, which takes a while
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	reply, err := client.AddHostKey(ctx, &pb.AddHostKeyRequest{Tag: tag, Key: key})
+	if err != nil {
+		return err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return errors.New(reply.Reason)
+	}
+	return nil
+}
+
+// RevokeHostKey asks the server to remove the host key with given fingerprint from the entry with given tag.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) RevokeHostKey(tag string, fingerprint string) error {
+	client := adapter.grpcContext.client
+	// the server re-encrypts the config file, which takes a while
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	reply, err := client.RevokeHostKey(ctx, &pb.RevokeHostKeyRequest{Tag: tag, Fingerprint: fingerprint})
+	if err != nil {
+		return err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return errors.New(reply.Reason)
+	}
+	return nil
+}
+
+// ImportHostKeys asks the server to pin the host keys listed in the known_hosts file at path.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) ImportHostKeys(path string) ([]domain.HostKeys, error) {
+	client := adapter.grpcContext.client
+	// the server re-encrypts the config file, which takes a while
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	reply, err := client.ImportHostKeys(ctx, &pb.ImportHostKeysRequest{Destination: path})
+	if err != nil {
+		return nil, err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return nil, errors.New(reply.Reason)
+	}
+	return mapHostKeys(reply.Imported), nil
+}
+
+func mapHostKeys(pbHostKeys []*pb.HostKeys) []domain.HostKeys {
+	var result []domain.HostKeys
+	for _, hostKeys := range pbHostKeys {
+		result = append(result, domain.HostKeys{Tag: hostKeys.Tag, Keys: hostKeys.Keys})
+	}
+	return result
+}
+
+// StartTunnels asks the server to open the forwards through the entry with given tag.
+// Without forwards, the forwards declared for the entry are opened. The server has to be in ready state.
+func (adapter *ipcAdapterImpl) StartTunnels(tag string, forwards []domain.Forward) ([]domain.Tunnel, error) {
+	client := adapter.grpcContext.client
+	// the server waits for the tunnels to connect
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	var pbForwards []*pb.Forward
+	for _, f := range forwards {
+		pbForwards = append(pbForwards, &pb.Forward{Type: f.Type, Listen: f.Listen, Target: f.Target})
+	}
+
+	reply, err := client.StartTunnels(ctx, &pb.StartTunnelsRequest{Tag: tag, Forwards: pbForwards})
+	if err != nil {
+		return nil, err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return nil, errors.New(reply.Reason)
+	}
+	return mapTunnels(reply.Tunnels), nil
+}
+
+// StopTunnels asks the server to close the tunnels with given ids, all tunnels of the entry with given tag,
+// or all tunnels if all is set. Returns the closed tunnels.
+func (adapter *ipcAdapterImpl) StopTunnels(ids []int, tag string, all bool) ([]domain.Tunnel, error) {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newCtxWithDefaultTimeout()
+	defer cancel()
+
+	var pbIds []int32
+	for _, id := range ids {
+		pbIds = append(pbIds, int32(id))
+	}
+
+	reply, err := client.StopTunnels(ctx, &pb.StopTunnelsRequest{Ids: pbIds, Tag: tag, All: all})
+	if err != nil {
+		return nil, err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return nil, errors.New(reply.Reason)
+	}
+	return mapTunnels(reply.Tunnels), nil
+}
+
+// GetTunnels asks the server for all open tunnels
+func (adapter *ipcAdapterImpl) GetTunnels() ([]domain.Tunnel, error) {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newCtxWithDefaultTimeout()
+	defer cancel()
+
+	reply, err := client.ListTunnels(ctx, &pb.ListTunnelsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return mapTunnels(reply.Tunnels), nil
+}
+
+func mapTunnels(pbTunnels []*pb.Tunnel) []domain.Tunnel {
+	var result []domain.Tunnel
+	for _, t := range pbTunnels {
+		state := domain.TunnelConnecting
+		switch t.State {
+		case pb.Tunnel_UP:
+			state = domain.TunnelUp
+		case pb.Tunnel_RECONNECTING:
+			state = domain.TunnelReconnecting
+		}
+
+		result = append(result, domain.Tunnel{
+			ID:            int(t.Id),
+			Tag:           t.Tag,
+			Forward:       domain.Forward{Type: t.Forward.Type, Listen: t.Forward.Listen, Target: t.Forward.Target},
+			State:         state,
+			Since:         time.Unix(t.Since, 0),
+			Connections:   int(t.Connections),
+			BytesSent:     t.BytesSent,
+			BytesReceived: t.BytesReceived,
+			LastError:     t.LastError,
+		})
+	}
+	return result
+}
+
+// GetRecordingKey asks the server for the key to encrypt and decrypt recordings.
+// If create is set and recordings are to be encrypted, a missing key is created. The server has to be in ready state.
+func (adapter *ipcAdapterImpl) GetRecordingKey(create bool) ([]byte, error) {
+	client := adapter.grpcContext.client
+	// creating the key re-encrypts the config file, which takes a while
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	reply, err := client.GetRecordingKey(ctx, &pb.RecordingKeyRequest{Create: create})
+	if err != nil {
+		return nil, err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return nil, errors.New(reply.Reason)
+	}
+	if len(reply.Key) == 0 {
+		return nil, nil
+	}
+	return reply.Key, nil
+}
+
+// GetConflicts asks the server for the tags declared by multiple config files.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) GetConflicts() ([]domain.TagConflict, error) {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newCtxWithDefaultTimeout()
+	defer cancel()
+
+	reply, err := client.ListConflicts(ctx, &pb.ListConflictsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return nil, errors.New(reply.Reason)
+	}
+
+	var result []domain.TagConflict
+	for _, c := range reply.Conflicts {
+		result = append(result, domain.TagConflict{Tag: c.Tag, Sources: c.Sources})
+	}
+	return result, nil
+}
+
+// ImportEntries sends the config in json format to the server, which merges its entries and keys into the config files.
+// The server has to be in ready state.
+func (adapter *ipcAdapterImpl) ImportEntries(jimConfig []byte, update bool, dryRun bool) ([]domain.ImportedEntry, error) {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	reply, err := client.ImportEntries(ctx, &pb.ImportEntriesRequest{Config: jimConfig, Update: update, DryRun: dryRun})
+	if err != nil {
+		return nil, err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return nil, errors.New(reply.Reason)
+	}
+
+	var result []domain.ImportedEntry
+	for _, e := range reply.Entries {
+		action := domain.ImportAdded
+		switch e.Action {
+		case pb.ImportedEntry_UPDATED:
+			action = domain.ImportUpdated
+		case pb.ImportedEntry_SKIPPED:
+			action = domain.ImportSkipped
+		}
+		result = append(result, domain.ImportedEntry{Tag: e.Tag, Action: action})
+	}
+	return result, nil
+}
+
+// ReloadRekeyedFile makes the server read the config file at path again, after its password or key slots changed.
+func (adapter *ipcAdapterImpl) ReloadRekeyedFile(path string, password []byte) error {
+	client := adapter.grpcContext.client
+	ctx, cancel := adapter.grpcContext.newTimedCtx(30 * time.Second)
+	defer cancel()
+
+	reply, err := client.ReloadRekeyedFile(ctx, &pb.ReloadRekeyedFileRequest{Path: path, Password: password})
+	if err != nil {
+		return err
+	}
+	if reply.ResponseType == pb.ResponseType_FAILURE {
+		return errors.New(reply.Reason)
+	}
+	return nil
+}
+
 // IsServerReady checks whether the server is ready to serve
 func (adapter *ipcAdapterImpl) IsServerReady() bool {
 	state, err := adapter.ServerStatus()
@@ -212,6 +515,7 @@ func (adapter *ipcAdapterImpl) AttemptDecryption(password []byte) (chan domain.D
 				channel <- *update
 			} else {
 				update := domain.NewSuccessfulDecryptStep(mapStepType(response.Step))
+				update.Reason = response.Reason
 				channel <- *update
 			}
 		}
@@ -234,6 +538,8 @@ func mapStepType(name pb.StepName) domain.Step {
 		return domain.BuildIndex
 	case pb.StepName_DONE:
 		return domain.Done
+	case pb.StepName_PASSWORD_REQUIRED:
+		return domain.PasswordRequired
 	}
 	panic(fmt.Sprintf("encountered unsupported step name %s", name.String()))
 }
@@ -15,9 +15,11 @@ import (
 
 func main() {
 	sockAddr := config.GetSocketAddress()
+	agentSockAddr := config.GetAgentSocketAddress()
 
 	fmt.Println("Clearing old socket instance")
 	clearSocket(sockAddr)
+	clearSocket(agentSockAddr)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -25,6 +27,7 @@ func main() {
 		<-c
 		log.Println("Received SIGTERM, exiting")
 		clearSocket(sockAddr)
+		clearSocket(agentSockAddr)
 		os.Exit(1)
 	}()
 
@@ -39,6 +42,19 @@ func main() {
 	server := grpc.NewServer()
 	jimImpl := serverImpl.CreateJimService()
 
+	agentListener, err := net.Listen(config.Protocol, agentSockAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// only the user may use the keys
+	if err := os.Chmod(agentSockAddr, 0600); err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		err := jimImpl.ServeAgent(agentListener)
+		log.Printf("Stopped serving the ssh-agent: %s", err)
+	}()
+
 	pb.RegisterJimServer(server, jimImpl)
 	err = server.Serve(listener)
 	if err != nil {
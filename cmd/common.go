@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/CryoCodec/jim/core/domain"
 	"github.com/CryoCodec/jim/core/services"
@@ -22,13 +23,31 @@ var yellow = color.New(color.FgYellow).SprintfFunc()
 func requestPWandDecrypt(uiService services.UiService) {
 	enabledSpinner := true
 	attempt := 3
+	keyfile := os.Getenv("JIM_KEYFILE")
+	identity := identityForConfigFiles()
 outer:
 	for {
 		if attempt == 0 {
 			die("No more attempts left, exiting. \n")
 		}
 
-		password := readPasswordFromTerminal()
+		var password []byte
+		if keyfile != "" {
+			// the keyfile is tried once, a password is asked for afterwards
+			password = readKeyfile(keyfile)
+			keyfile = ""
+		} else if identity != "" {
+			// so is the identity, if it is a recipient of any config file
+			id, err := decryptIdentity(identity)
+			identity = ""
+			if err != nil {
+				fmt.Println(red("Failed to unlock the identity: %s", err))
+				continue
+			}
+			password = id.Secret()
+		} else {
+			password = readPasswordFromTerminal()
+		}
 		spinner, err := CreateSpinner()
 		if err != nil {
 			enabledSpinner = false
@@ -45,7 +64,7 @@ outer:
 			dief("\n Encountered an unexpected error: %s", err)
 		}
 		for update := range channel {
-			log.Debugf("received decrypt update: %s", update)
+			log.Debugf("received decrypt update: %v", update)
 			if update.Error != nil {
 				dief("Encountered an unexpected error: %s", update.Error)
 			}
@@ -65,10 +84,11 @@ outer:
 				case domain.Unmarshal:
 					fallthrough
 				case domain.BuildIndex:
-					fmt.Printf("Reason: %s", update.Reason)
+					fmt.Printf("Reason: %s\n", update.Reason)
 				}
 
-				fmt.Printf("Your configuration file seems to be invalid. Please run 'jim validate' for help")
+				// another password doesn't help with a damaged file
+				die("Your configuration file seems to be invalid. Please run 'jim validate' for help")
 			}
 
 			switch update.StepType {
@@ -95,6 +115,10 @@ outer:
 				spinner.Stop()
 				updateSpinnerPrefix(spinner, "Writing State")
 				spinner.Start()
+			case domain.PasswordRequired:
+				// the password fits some of the config files, the loop asks for the next one
+				spinner.Stop()
+				fmt.Println(yellow("%s", update.Reason))
 			}
 		}
 	}
@@ -163,6 +187,14 @@ func runPreamble(uiService services.UiService) error {
 	}
 }
 
+// askForConfirmation prints the question and returns true, if the user answered with 'y'
+func askForConfirmation(question string) bool {
+	fmt.Printf("%s (y/n) \n", question)
+	reader := bufio.NewReader(os.Stdin)
+	yes, _ := reader.ReadString('\n')
+	return strings.TrimSpace(yes) == "y"
+}
+
 func die(s string) {
 	fmt.Println(s)
 	os.Exit(1)
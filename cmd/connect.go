@@ -1,25 +1,42 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/CryoCodec/jim/core/domain"
 	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/recordings"
+	"github.com/CryoCodec/jim/sshclient"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"io"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
-const VerboseFlag = "-v"
-
 // connectCmd represents the connect command
 var connectCmd = &cobra.Command{
-	Use:   "connect",
+	Use:   "connect tag [-- command]",
 	Short: "Opens an interactive SSH connection to the Server, whose tag matches the args the closest.",
-	Long:  `Opens an interactive SSH connection to the Server, whose tag matches the args the closest. Requires native SSH and SSHPASS available on PATH.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Opens an interactive SSH connection to the Server, whose tag matches the args the closest.
+The session starts in the directory of the entry with its environment variables set. The startup command
+of the entry is run, before its shell is started.
+
+Pass a command after -- to run it instead of an interactive shell. A single argument is passed to the
+remote shell as is, so it may contain pipes. Multiple arguments are quoted individually.
+
+Examples:
+  jim connect Billing Web 1
+  jim connect Billing Web 1 -- 'tail -n 100 logs/app.log | grep ERROR'
+  jim connect Billing Web 1 -- ls -l "my dir"`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() == 0 || len(args) == 0 {
+			return errors.New("requires the tag of the server to connect to")
+		}
+		return nil
+	},
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, lastParam string) ([]string, cobra.ShellCompDirective) {
 		toComplete := lastParam
 		if len(args) != 0 {
@@ -48,16 +65,31 @@ var connectCmd = &cobra.Command{
 			dief("Received unexpected error: %s", err)
 		}
 
-		query := strings.Join(args, " ")
+		queryArgs, commandArgs := args, []string(nil)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			queryArgs, commandArgs = args[:dash], args[dash:]
+		}
+
+		query := strings.Join(queryArgs, " ")
 		response, err := uiService.GetMatchingServer(query)
 
 		if err != nil {
 			dief("Error: %s", err)
 		}
 
-		fmt.Printf("Connecting to %s -> %s \n", response.Tag, response.Server.Dir)
-		err = connectToServer(&response.Server)
+		command := remoteCommand(commandArgs)
+		if command == "" {
+			fmt.Printf("Connecting to %s -> %s \n", response.Tag, response.Server.Dir)
+		}
+		recorder := startRecording(uiService, response)
+		err = connectToServer(response, command, trustOnFirstUse(uiService), recorder)
+		if recorder != nil {
+			if closeErr := recorder.Close(); closeErr != nil {
+				fmt.Println(red("The recording %s is incomplete: %s", recorder.Path, closeErr))
+			}
+		}
 		if err != nil {
+			exitWithRemoteStatus(err)
 			dief("Error: %s", err.Error())
 		}
 	},
@@ -67,33 +99,64 @@ func init() {
 	rootCmd.AddCommand(connectCmd)
 }
 
-func connectToServer(server *domain.Server) error {
-	var sshFlags []string
-	if VerbosityLevel >= 1 {
-		sshFlags = append(sshFlags, VerboseFlag)
+// connectToServer opens an interactive session, or runs the command if it's not empty.
+// The output is recorded, if recorder is not nil.
+func connectToServer(match *domain.Match, command string, onUnknown sshclient.UnknownHostKeyHandler, recorder *recordings.Recorder) error {
+	client, err := sshclient.Dial(match, onUnknown)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var output io.Writer
+	if recorder != nil {
+		output = recorder
+	}
+	return sshclient.RunInteractive(client, sshclient.SessionCommand(&match.Server, command), output)
+}
+
+// remoteCommand joins the args passed after --. A single arg is used as is, multiple args are quoted individually.
+func remoteCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, sshclient.Quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// startRecording starts recording the session, if recording is enabled for the entry. Returns nil otherwise.
+// Jim refuses to connect, if a session that has to be recorded can't be recorded.
+func startRecording(uiService services.UiService, match *domain.Match) *recordings.Recorder {
+	if !match.Server.Record {
+		return nil
 	}
 
-	if len(server.Password) == 0 {
-		sshArgs := []string{"-o", "StrictHostKeyChecking=no", "-p", strconv.Itoa(server.Port), "-t", server.Username + "@" + server.Host, "cd " + server.Dir + "; " + "bash"}
-		sshArgs = append(sshFlags, sshArgs...)
-		cmd := exec.Command("ssh", sshArgs...)
-		return interactiveConsole(cmd)
+	key, err := uiService.GetRecordingKey(true)
+	if err != nil {
+		dief("Failed to fetch the recording key: %s\n", err)
 	}
 
-	sshPassArgs := []string{"-e", "ssh"}
-	sshPassArgs = append(sshPassArgs, sshFlags...)
-	sshPassArgs = append(sshPassArgs, "-o", "StrictHostKeyChecking=no", "-p", strconv.Itoa(server.Port), "-t", server.Username+"@"+server.Host, "cd "+server.Dir+"; "+"bash")
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width == 0 || height == 0 {
+		width, height = 80, 24
+	}
 
-	cmd := exec.Command("sshpass", sshPassArgs...)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "SSHPASS="+string(server.Password))
-	return interactiveConsole(cmd)
+	recorder, err := recordings.Create(match.Tag, width, height, key)
+	if err != nil {
+		dief("Failed to start the recording: %s\n", err)
+	}
+	fmt.Println(yellow("This session is recorded to %s", recorder.Path))
+	return recorder
 }
 
-func interactiveConsole(cmd *exec.Cmd) error {
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	err := cmd.Run()
-	return err
+// exitWithRemoteStatus terminates jim with the exit status of the remote command, if err carries one.
+func exitWithRemoteStatus(err error) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitStatus())
+	}
 }
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/sshclient"
+	"github.com/pkg/sftp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var recursiveCopy bool
+
+// cpCmd represents the cp command
+var cpCmd = &cobra.Command{
+	Use:   "cp source destination",
+	Short: "Copies files from or to a server via SFTP",
+	Long: `Copies files from or to a server via SFTP, authenticating with the stored credentials. 
+Remote paths are written as 'tag:path', where the tag matches the closest entry like in the connect command. 
+Relative remote paths are resolved against the directory configured for the entry, paths starting with ~/ against the home directory. 
+Wrap tags containing spaces in quotes, e.g. "Integration Webserver 1:logs/app.log".
+
+Examples:
+  jim cp "Integration Webserver 1:logs/app.log" .
+  jim cp -r ./dist "Integration Webserver 1:/var/www"`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		srcTag, srcPath, srcRemote := parseCopyTarget(args[0])
+		dstTag, dstPath, dstRemote := parseCopyTarget(args[1])
+		if srcRemote == dstRemote {
+			die("Exactly one of source and destination has to be a remote path in the format 'tag:path'")
+		}
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		tag := srcTag
+		if dstRemote {
+			tag = dstTag
+		}
+		response, err := uiService.GetMatchingServer(tag)
+		if err != nil {
+			dief("Error: %s", err)
+		}
+
+		remotePath := dstPath
+		if srcRemote {
+			remotePath = srcPath
+		}
+		remotePath, err = sshclient.RemotePath(&response.Server, remotePath)
+		if err != nil {
+			dief("Error: %s", err)
+		}
+
+		client, err := sshclient.Dial(response, trustOnFirstUse(uiService))
+		if err != nil {
+			dief("Error: %s", err)
+		}
+		defer client.Close()
+
+		sftpClient, err := sftp.NewClient(client)
+		if err != nil {
+			dief("Failed to start the SFTP session: %s", err)
+		}
+		defer sftpClient.Close()
+
+		progress := newProgressPrinter()
+		if srcRemote {
+			fmt.Printf("Copying %s:%s -> %s\n", response.Tag, remotePath, dstPath)
+			err = sshclient.Download(sftpClient, remotePath, dstPath, recursiveCopy, progress)
+		} else {
+			fmt.Printf("Copying %s -> %s:%s\n", srcPath, response.Tag, remotePath)
+			err = sshclient.Upload(sftpClient, srcPath, remotePath, recursiveCopy, progress)
+		}
+		if err != nil {
+			die(red("✗ failed. Reason: %s", err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+	cpCmd.Flags().BoolVarP(&recursiveCopy, "recursive", "r", false, "copies directories recursively")
+}
+
+// parseCopyTarget splits an argument in the format 'tag:path'. Returns false if the argument is a local path.
+func parseCopyTarget(arg string) (string, string, bool) {
+	idx := strings.Index(arg, ":")
+	// local paths may contain colons as well, but not before the first slash
+	if idx <= 0 || strings.Contains(arg[:idx], "/") {
+		return "", arg, false
+	}
+	return arg[:idx], arg[idx+1:], true
+}
+
+// newProgressPrinter prints the progress of each file on a single line, which is updated at most every 100ms
+func newProgressPrinter() sshclient.ProgressFunc {
+	var lastUpdate time.Time
+	return func(name string, transferred int64, total int64) {
+		done := transferred == total
+		if !done && time.Since(lastUpdate) < 100*time.Millisecond {
+			return
+		}
+		lastUpdate = time.Now()
+
+		percent := int64(100)
+		if total > 0 {
+			percent = transferred * 100 / total
+		}
+		fmt.Fprintf(os.Stderr, "\r%s %s / %s %3d%%", name, formatBytes(transferred), formatBytes(total), percent)
+		if done {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -4,26 +4,25 @@ import (
 	"bufio"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 
 	b64 "encoding/base64"
 
 	"github.com/CryoCodec/jim/crypto"
 	"github.com/CryoCodec/jim/files"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 // decryptCmd represents the decrypt command
 var decryptCmd = &cobra.Command{
 	Use:   "decrypt path/to/file",
 	Short: "Decrypts the file at given path, so you may edit your configuration",
-	Long:  `Decrypts the file at given path, so you may edit your configuration. The file has to be encrypted by jim and must end with .enc`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Decrypts the file at given path, so you may edit your configuration. The file has to be encrypted by jim and must end with .enc
+The file is unlocked with any of its key slots, i.e. a password, a recovery key, the keyfile passed by --keyfile
+or your identity, if it is a recipient of the file.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initLogging()
 
@@ -44,15 +43,11 @@ var decryptCmd = &cobra.Command{
 		if err != nil {
 			dief("Corrupt input file, failed at base64 decode. Reason: %s", err)
 		}
-
-		log.Println("Enter master password:")
-		password, err := term.ReadPassword(syscall.Stdin)
-		if err != nil {
-			die("Error reading the password from terminal. Try again.")
-
+		if _, _, err := crypto.ParseHeader(cipherText); err != nil {
+			dief("Corrupt input file. Reason: %s\n", err)
 		}
 
-		clearText, err := crypto.Decrypt(password, cipherText)
+		_, clearText, err := crypto.Open(unlockSecret(args[0], cipherText), cipherText)
 		if err != nil {
 			dief("Failed to decrypt the given content. Reason: %s", err)
 		}
@@ -78,4 +73,6 @@ var decryptCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(decryptCmd)
+	decryptCmd.Flags().StringVar(&unlockKeyfile, "keyfile", "", "unlocks the file with the keyfile at given path instead of a password")
+	decryptCmd.Flags().StringVar(&unlockIdentity, "identity", "", "unlocks the file with the identity at given path")
 }
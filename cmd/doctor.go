@@ -67,9 +67,8 @@ var doctorCmd = &cobra.Command{
 		path := os.Getenv("JIM_CONFIG_FILE") // env variable has highest priority
 		if path == "" {
 			messagesPerStep = append(messagesPerStep, "The environment variable JIM_CONFIG_FILE is not set, will use default config location ~/.jim/config.json.enc")
-			configFile := filepath.Join(jimDir, "config.json.enc")
 			messagesPerStep = append(messagesPerStep, yellow("test: config file exists"))
-			if !files.Exists(configFile) {
+			if _, err := files.GetJimConfigFilePaths(); err != nil {
 				messagesPerStep = append(messagesPerStep, red("The config file does not exist. I will create the dummy file config.json for you. Please update the file and use 'jim encrypt' afterwards."))
 				dummyFilePath := filepath.Join(jimDir, "config.json")
 				dummyValue := config.JimConfigElement{
@@ -78,13 +77,13 @@ var doctorCmd = &cobra.Command{
 					Tag:   "This string is used in the connect command",
 					Server: config.JimConfigEntry{
 						Host:     "Host name of your Server to connect to",
-						Port:     "The SSH Port on the remote server",
+						Port:     22,
 						Dir:      "The directory you'd like to start after SSH login",
 						Username: "The Username used for authentication",
 						Password: "The Password used for authentication",
 					},
 				}
-				jimConfig := config.JimConfig([]config.JimConfigElement{dummyValue})
+				jimConfig := config.JimConfig{Version: config.Version, Entries: []config.JimConfigElement{dummyValue}}
 				json, err := jimConfig.Marshal()
 				if err != nil {
 					spinner.StopFail()
@@ -119,7 +118,7 @@ var doctorCmd = &cobra.Command{
 		} else {
 			messagesPerStep = append(messagesPerStep, fmt.Sprintf("Environment variable JIM_CONFIG_FILE is set, using the path %s", path))
 			messagesPerStep = append(messagesPerStep, yellow("test: config file exists"))
-			if !files.Exists(path) {
+			if _, err := files.GetJimConfigFilePaths(); err != nil {
 				spinner.StopFail()
 				messagesPerStep = append(messagesPerStep, red("The configured path does not point to an existing file. Please update the environment variable JIM_CONFIG_FILE."))
 				printStepMessagesAndDie(messagesPerStep)
@@ -138,11 +137,9 @@ var doctorCmd = &cobra.Command{
 		updateSpinnerPrefix(spinner, "Checking required utilities")
 		spinner.Start()
 
-		messagesPerStep, ok1 := commandExists("pgrep", messagesPerStep)
-		messagesPerStep, ok2 := commandExists("sshpass", messagesPerStep)
-		messagesPerStep, ok3 := commandExists("ssh", messagesPerStep)
+		messagesPerStep, ok := commandExists("pgrep", messagesPerStep)
 
-		if ok1 && ok2 && ok3 {
+		if ok {
 			spinner.Stop()
 			printStepMessages(messagesPerStep)
 		} else {
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 
 	b64 "encoding/base64"
 
@@ -16,12 +17,21 @@ import (
 	"golang.org/x/term"
 )
 
+var encryptKDF string
+var encryptBenchmark bool
+var encryptTarget time.Duration
+var encryptRecipients []string
+
 // encryptCmd represents the encrypt command
 var encryptCmd = &cobra.Command{
 	Use:   "encrypt path/to/file",
 	Short: "Encrypts the file at given path, so it can be used with jim",
 	Long: `Encrypts the file at path/to/file with a master password. 
-	The file may then be used with jim`,
+	The file may then be used with jim.
+	The key is derived from the password with argon2id or scrypt, --kdf-benchmark tunes the parameters
+	to take about --kdf-target on this machine. The parameters are stored in the encrypted file.
+	With --recipient the file is encrypted for the public keys of the recipients instead, each of them
+	unlocks it with their own identity, see 'jim identity'.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initLogging()
@@ -35,15 +45,11 @@ var encryptCmd = &cobra.Command{
 			dief("Error reading file: %s", err)
 		}
 
-		fmt.Println("Enter master password:")
-		password, err := term.ReadPassword(syscall.Stdin)
-		if err != nil {
-			die("Error reading the password from terminal. Try again.")
-		}
-
-		cipherText, err := crypto.Encrypt(password, fileContents)
-		if err != nil {
-			dief("Failed to encrypt the given content. Reason: %s", err)
+		var cipherText []byte
+		if len(encryptRecipients) > 0 {
+			cipherText = encryptForRecipients(fileContents)
+		} else {
+			cipherText = encryptWithPassword(fileContents)
 		}
 
 		sEnc := b64.StdEncoding.EncodeToString(cipherText)
@@ -66,6 +72,62 @@ var encryptCmd = &cobra.Command{
 	},
 }
 
+// encryptWithPassword asks for the master password and encrypts the contents with it
+func encryptWithPassword(fileContents []byte) []byte {
+	algorithm, err := crypto.ParseKDFAlgorithm(encryptKDF)
+	if err != nil {
+		dief("%s\n", err)
+	}
+	params := crypto.DefaultParams(algorithm)
+	if encryptBenchmark {
+		fmt.Printf("Calibrating %s to unlock in about %s\n", algorithm, encryptTarget)
+		var elapsed time.Duration
+		params, elapsed, err = crypto.CalibrateKDF(algorithm, encryptTarget)
+		if err != nil {
+			dief("Failed to calibrate the key derivation. Reason: %s\n", err)
+		}
+		fmt.Printf("Using %s, it takes %s on this machine\n", params, elapsed.Round(time.Millisecond))
+	}
+
+	fmt.Println("Enter master password:")
+	password, err := term.ReadPassword(syscall.Stdin)
+	if err != nil {
+		die("Error reading the password from terminal. Try again.")
+	}
+
+	cipherText, err := crypto.EncryptWithParams(password, fileContents, params)
+	if err != nil {
+		dief("Failed to encrypt the given content. Reason: %s", err)
+	}
+	return cipherText
+}
+
+// encryptForRecipients encrypts the contents for the public keys passed by --recipient
+func encryptForRecipients(fileContents []byte) []byte {
+	var recipients []crypto.Recipient
+	for _, publicKey := range encryptRecipients {
+		recipient, err := crypto.ParseRecipient(publicKey)
+		if err != nil {
+			dief("%s\n", err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	vault, err := crypto.NewVaultForRecipients(recipients)
+	if err != nil {
+		dief("Failed to encrypt the given content. Reason: %s", err)
+	}
+	cipherText, err := vault.Seal(fileContents)
+	if err != nil {
+		dief("Failed to encrypt the given content. Reason: %s", err)
+	}
+	return cipherText
+}
+
 func init() {
 	rootCmd.AddCommand(encryptCmd)
+	encryptCmd.Flags().StringVar(&encryptKDF, "kdf", crypto.DefaultKDFParams.Algorithm.String(), "the function deriving the key from the password: "+strings.Join(crypto.KDFAlgorithms, ", "))
+	encryptCmd.Flags().BoolVar(&encryptBenchmark, "kdf-benchmark", false, "calibrates the parameters of the key derivation to this machine")
+	encryptCmd.Flags().DurationVar(&encryptTarget, "kdf-target", time.Second, "the time the key derivation should take with --kdf-benchmark")
+	encryptCmd.Flags().StringArrayVar(&encryptRecipients, "recipient", nil, "encrypts the file for the public key of a recipient instead of a password, may be repeated")
 }
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/sshclient"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var execFilters []string
+var execAll bool
+var execParallel int
+var execTimeout time.Duration
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec -f filter [-f filter...] -- command",
+	Short: "Runs a command on all servers matching the filters",
+	Long: `Runs a command on all servers matching the filters in parallel. 
+The command runs in the dir of each entry with its env, inside its shell if one is configured, like 'jim connect tag -- command'.
+The output of each server is prefixed with its tag. At the end a summary of the exit codes is printed. 
+Exits with a non-zero code, if the command failed on any server. 
+Host keys must already be pinned for all servers, see 'jim hostkeys'.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		if len(execFilters) == 0 && !execAll {
+			die("Refusing to run on all servers, pass at least one filter or --all")
+		}
+		if execParallel < 1 {
+			die("The parallelism must be at least 1")
+		}
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		matches, err := uiService.GetMatchingServers(execFilters, math.MaxInt32)
+		if err != nil {
+			die(err.Error())
+		}
+		if len(matches) == 0 {
+			die("Your query did not yield any results.")
+		}
+
+		command := remoteCommand(args)
+		results := runOnAll(matches, command)
+
+		fmt.Println()
+		if !printExecSummary(results) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringArrayVarP(&execFilters, "filter", "f", []string{}, filterFlagDescription)
+	execCmd.Flags().BoolVar(&execAll, "all", false, "runs the command on all servers, if no filter is set")
+	execCmd.Flags().IntVarP(&execParallel, "parallel", "p", 10, "the maximum number of servers to run the command on at the same time")
+	execCmd.Flags().DurationVar(&execTimeout, "timeout", 0, "aborts the command on a server after the duration, e.g. 30s. Zero means no timeout")
+}
+
+type execResult struct {
+	tag      string
+	exitCode int
+	duration time.Duration
+	err      error
+}
+
+// runOnAll runs the command on all matched servers with bounded parallelism.
+// The results are in the same order as the matches.
+func runOnAll(matches []domain.Match, command string) []execResult {
+	results := make([]execResult, len(matches))
+	semaphore := make(chan struct{}, execParallel)
+	outputLock := &sync.Mutex{}
+
+	width := 0
+	for _, match := range matches {
+		if len(match.Tag) > width {
+			width = len(match.Tag)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range matches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			match := &matches[i]
+			prefix := fmt.Sprintf("%-*s | ", width, match.Tag)
+			stdout := newPrefixWriter(os.Stdout, prefix, outputLock)
+			stderr := newPrefixWriter(os.Stderr, prefix, outputLock)
+
+			start := time.Now()
+			exitCode, err := runOnServer(match, command, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+			results[i] = execResult{tag: match.Tag, exitCode: exitCode, duration: time.Since(start), err: err}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// runOnServer returns the exit code of the remote command.
+// Errors unrelated to the exit code are returned as err with an exit code of -1.
+func runOnServer(match *domain.Match, command string, stdout io.Writer, stderr io.Writer) (int, error) {
+	client, err := sshclient.Dial(match, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if execTimeout > 0 {
+		timer := time.AfterFunc(execTimeout, func() {
+			client.Close()
+		})
+		defer timer.Stop()
+	}
+
+	start := time.Now()
+	err = session.Run(sshclient.SessionCommand(&match.Server, command))
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		if execTimeout > 0 && time.Since(start) >= execTimeout {
+			return -1, fmt.Errorf("timed out after %s", execTimeout)
+		}
+		return -1, err
+	}
+	return 0, nil
+}
+
+// printExecSummary prints the exit code and duration per server.
+// Returns true, if the command succeeded on all servers.
+func printExecSummary(results []execResult) bool {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tEXIT\tDURATION\tERROR")
+	for _, result := range results {
+		if result.exitCode != 0 {
+			failed++
+		}
+		errMsg := ""
+		if result.err != nil {
+			errMsg = strings.ReplaceAll(result.err.Error(), "\n", " ")
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", result.tag, result.exitCode, result.duration.Round(time.Millisecond), errMsg)
+	}
+	w.Flush()
+
+	if failed != 0 {
+		fmt.Println(red("✗ failed on %d of %d servers", failed, len(results)))
+		return false
+	}
+	fmt.Println(green("✓ succeeded on %d servers", len(results)))
+	return true
+}
+
+// prefixWriter prefixes every line with a fixed string. Lines of concurrent writers
+// sharing the lock don't interleave.
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+	lock   *sync.Mutex
+	buffer bytes.Buffer
+}
+
+func newPrefixWriter(out io.Writer, prefix string, lock *sync.Mutex) *prefixWriter {
+	return &prefixWriter{out: out, prefix: prefix, lock: lock}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buffer.Write(data)
+	for {
+		line, err := p.buffer.ReadBytes('\n')
+		if err != nil {
+			// incomplete line, wait for more data
+			p.buffer.Reset()
+			p.buffer.Write(line)
+			return len(data), nil
+		}
+		p.writeLine(line)
+	}
+}
+
+// Flush writes the remaining incomplete line
+func (p *prefixWriter) Flush() {
+	if p.buffer.Len() != 0 {
+		p.writeLine(append(p.buffer.Bytes(), '\n'))
+		p.buffer.Reset()
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	fmt.Fprintf(p.out, "%s%s", p.prefix, line)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/files"
+	"github.com/CryoCodec/jim/inventory"
+	"github.com/spf13/cobra"
+)
+
+var exportFilters []string
+var exportOutput string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports entries into other formats",
+	Long: `Exports entries into other formats, so other tools can reach the servers.
+Secrets are never exported, they stay in the encrypted config file.`,
+}
+
+// exportSSHConfigCmd represents the export ssh-config command
+var exportSSHConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Exports the entries as OpenSSH config",
+	Long: `Exports the entries matching the filters as Host blocks of an OpenSSH config, e.g. for IDEs, rsync or ansible.
+The host aliases are derived from the tags, e.g. 'Billing Web 1' becomes billing-web-1.
+Servers using a private key authenticate with jim's agent, servers using a password are connected through 'jim proxy'.
+Both require a running daemon with decrypted config. Entries, whose sessions have to be recorded, are skipped.
+
+Examples:
+  jim export ssh-config -f env:INT -o ~/.ssh/jim_config
+  echo 'Include ~/.ssh/jim_config' >> ~/.ssh/config`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		// makes sure the server is in the correct state.
+		// might ask the user to enter the master password.
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		matches, err := uiService.GetMatchingServers(exportFilters, math.MaxInt32)
+		if err != nil {
+			die(err.Error())
+		}
+		if len(matches) == 0 {
+			die("Your query did not yield any results.")
+		}
+
+		helper, err := os.Executable()
+		if err != nil {
+			dief("Could not determine the path of jim: %s\n", err)
+		}
+		options := inventory.ExportOptions{Helper: helper, IdentityAgent: config.GetAgentSocketAddress()}
+
+		var buffer bytes.Buffer
+		warnings, err := inventory.WriteSSHConfig(&buffer, matches, options)
+		if err != nil {
+			dief("Failed to export the entries: %s\n", err)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, yellow("%s", warning))
+		}
+
+		if exportOutput == "" {
+			fmt.Print(buffer.String())
+			return
+		}
+		if err := files.WriteFileAtomic(exportOutput, buffer.Bytes(), 0600); err != nil {
+			dief("Failed to write %s: %s\n", exportOutput, err)
+		}
+		fmt.Println(green("Exported the entries to %s", exportOutput))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportSSHConfigCmd)
+	exportSSHConfigCmd.Flags().StringArrayVarP(&exportFilters, "filter", "f", []string{}, filterFlagDescription)
+	exportSSHConfigCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Writes the config to the file instead of stdout")
+}
@@ -2,17 +2,23 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/CryoCodec/jim/config"
 	"github.com/CryoCodec/jim/core/services"
+	"golang.org/x/crypto/ssh"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var explainSources bool
+
 // getCmd represents the get command
 var getCmd = &cobra.Command{
 	Use:   "get",
 	Short: "Prints information for given server entry, whose tag matches the args the closest",
-	Long:  `Prints information for given server entry, whose tag matches the args the closest`,
+	Long: `Prints information for given server entry, whose tag matches the args the closest.
+With --explain, every value is followed by its origin, i.e. the entry itself or the defaults it was inherited from.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		initLogging()
 
@@ -31,14 +37,88 @@ var getCmd = &cobra.Command{
 			die(err.Error())
 		}
 
+		sources := response.Server.Sources
 		fmt.Println("Tag:\t\t", response.Tag)
-		fmt.Println("Host:\t\t", response.Server.Host)
-		fmt.Println("Directory:\t", response.Server.Dir)
-		fmt.Println("Username:\t", response.Server.Username)
-		fmt.Println("Password:\t", string(response.Server.Password))
+		if len(response.Aliases) != 0 {
+			fmt.Println("Aliases:\t", strings.Join(response.Aliases, ", "))
+		}
+		fmt.Printf("Host:\t\t %s%s\n", response.Server.Host, explain(sources, "host"))
+		fmt.Printf("Port:\t\t %d%s\n", response.Server.Port, explain(sources, "port"))
+		fmt.Printf("Directory:\t %s%s\n", response.Server.Dir, explain(sources, "dir"))
+		if len(response.Jumps) != 0 {
+			var jumps []string
+			for _, jump := range response.Jumps {
+				jumps = append(jumps, jump.Tag)
+			}
+			fmt.Printf("Jump hosts:\t %s%s\n", strings.Join(jumps, " -> "), explain(sources, "jump"))
+		}
+		fmt.Printf("Username:\t %s%s\n", response.Server.Username, explain(sources, "username"))
+		fmt.Printf("Password:\t %s%s\n", response.Server.Password, explain(sources, "password"))
+		if len(response.Server.PrivateKey) != 0 {
+			fmt.Printf("Private key:\t %s%s\n", describePrivateKey(response.Server.PrivateKey), explain(sources, "private_key", "key_ref"))
+		}
+		for _, key := range response.Server.HostKeys {
+			fmt.Println("Host key:\t", describeHostKey(key))
+		}
+		if response.Server.Shell != "" {
+			fmt.Printf("Shell:\t\t %s%s\n", response.Server.Shell, explain(sources, "shell"))
+		}
+		if response.Server.StartupCommand != "" {
+			fmt.Printf("Startup command: %s%s\n", response.Server.StartupCommand, explain(sources, "startup_command"))
+		}
+		for _, name := range sortedKeys(response.Server.Env) {
+			fmt.Printf("Env:\t\t %s=%s%s\n", name, response.Server.Env[name], explain(sources, "env."+name))
+		}
+		if response.Server.Record {
+			fmt.Printf("Recording:\t enabled%s\n", explain(sources, "record"))
+		}
+		for _, forward := range response.Server.Forwards {
+			fmt.Printf("Forward:\t %s%s\n", forward, explain(sources, "forwards"))
+		}
+		for _, name := range sortedKeys(response.Labels) {
+			fmt.Printf("Label:\t\t %s=%s\n", name, response.Labels[name])
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().BoolVar(&explainSources, "explain", false, "shows where each value comes from")
+}
+
+// explain describes the origin of the first of the given settings, that has one, prefixed by a space.
+// Returns an empty string without --explain.
+func explain(sources map[string]string, names ...string) string {
+	if !explainSources {
+		return ""
+	}
+	for _, name := range names {
+		switch source, ok := sources[name]; {
+		case !ok:
+			continue
+		case source == config.SourceEntry:
+			return " " + yellow("(set by the entry)")
+		default:
+			return " " + yellow("(inherited from %s)", source)
+		}
+	}
+	return " " + yellow("(not set)")
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// describePrivateKey returns the type and fingerprint of the key, so it can be identified without revealing it
+func describePrivateKey(pemBytes []byte) string {
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	if err != nil {
+		return red("invalid key: %s", err)
+	}
+	return fmt.Sprintf("%s %s", signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey()))
 }
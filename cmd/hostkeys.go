@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/sshclient"
+	"golang.org/x/crypto/ssh"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var assumeYes bool
+
+// hostkeysCmd represents the hostkeys command
+var hostkeysCmd = &cobra.Command{
+	Use:   "hostkeys",
+	Short: "Manages the host keys pinned for the configured servers",
+	Long: `Manages the host keys pinned for the configured servers. 
+The pinned keys are stored inside the encrypted config file. Whenever a server presents a key, 
+that doesn't match the pinned keys of its entry, jim refuses to connect.`,
+}
+
+var hostkeysListCmd = &cobra.Command{
+	Use:   "list [tag]",
+	Short: "Lists the pinned host keys",
+	Long:  `Lists the pinned host keys of all entries, or only of the entry whose tag matches the args the closest.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		tag := ""
+		if len(args) != 0 {
+			tag = matchTag(uiService, args)
+		}
+
+		hostKeys, err := uiService.GetHostKeys(tag)
+		if err != nil {
+			die(err.Error())
+		}
+
+		if len(hostKeys) == 0 {
+			fmt.Println("No host keys are pinned.")
+			return
+		}
+
+		for _, entry := range hostKeys {
+			fmt.Println(entry.Tag)
+			for _, key := range entry.Keys {
+				fmt.Printf("    %s\n", describeHostKey(key))
+			}
+		}
+	},
+}
+
+var hostkeysAcceptCmd = &cobra.Command{
+	Use:   "accept tag",
+	Short: "Fetches and pins the host key of the server, whose tag matches the args the closest",
+	Long: `Fetches and pins the host key of the server, whose tag matches the args the closest. 
+Use this command to trust a server, whose host key has changed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		response, err := uiService.GetMatchingServer(strings.Join(args, " "))
+		if err != nil {
+			dief("Error: %s", err)
+		}
+
+		key, err := sshclient.FetchHostKey(response, trustOnFirstUse(uiService))
+		if err != nil {
+			dief("Error: %s", err)
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		for _, pinned := range response.Server.HostKeys {
+			if pinnedFingerprint, _ := sshclient.FingerprintOf(pinned); pinnedFingerprint == fingerprint {
+				fmt.Printf("The host key %s is already pinned for '%s'.\n", fingerprint, response.Tag)
+				return
+			}
+		}
+
+		if len(response.Server.HostKeys) != 0 {
+			fmt.Printf("The entry '%s' currently pins these host keys:\n", response.Tag)
+			for _, pinned := range response.Server.HostKeys {
+				fmt.Printf("    %s\n", describeHostKey(pinned))
+			}
+		}
+		fmt.Printf("The server %s presents the %s key %s.\n", response.Server.Host, key.Type(), fingerprint)
+
+		if !assumeYes && !askForConfirmation(fmt.Sprintf("Pin this key for '%s'?", response.Tag)) {
+			return
+		}
+
+		err = uiService.AddHostKey(response.Tag, sshclient.MarshalHostKey(key))
+		if err != nil {
+			die(red("✗ failed. Reason: %s", err))
+		}
+		fmt.Println(green("✓ pinned %s for '%s'", fingerprint, response.Tag))
+	},
+}
+
+var hostkeysRevokeCmd = &cobra.Command{
+	Use:   "revoke tag",
+	Short: "Removes pinned host keys of the server, whose tag matches the args the closest",
+	Long: `Removes pinned host keys of the server, whose tag matches the args the closest. 
+By default all keys of the entry are removed, use --fingerprint to remove a single key.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		tag := matchTag(uiService, args)
+		fingerprint, _ := cmd.Flags().GetString("fingerprint")
+		err = uiService.RevokeHostKey(tag, fingerprint)
+		if err != nil {
+			die(red("✗ failed. Reason: %s", err))
+		}
+		fmt.Println(green("✓ revoked host keys of '%s'", tag))
+	},
+}
+
+var hostkeysImportCmd = &cobra.Command{
+	Use:   "import [path/to/known_hosts]",
+	Short: "Pins the host keys listed in an OpenSSH known_hosts file",
+	Long: `Pins the host keys listed in an OpenSSH known_hosts file for all entries, whose host and port are listed. 
+Defaults to ~/.ssh/known_hosts. Keys already pinned in jim take precedence.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		var path string
+		if len(args) == 1 {
+			path = args[0]
+		} else {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				dief("Could not read user home directory path: %s", err)
+			}
+			path = filepath.Join(homeDir, ".ssh", "known_hosts")
+		}
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		imported, err := uiService.ImportHostKeys(path)
+		if err != nil {
+			die(red("✗ failed. Reason: %s", err))
+		}
+
+		if len(imported) == 0 {
+			fmt.Println("No new host keys were found.")
+			return
+		}
+
+		for _, entry := range imported {
+			fmt.Println(entry.Tag)
+			for _, key := range entry.Keys {
+				fmt.Printf("    %s\n", describeHostKey(key))
+			}
+		}
+		fmt.Println(green("✓ imported host keys for %d entries", len(imported)))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hostkeysCmd)
+	hostkeysCmd.AddCommand(hostkeysListCmd)
+	hostkeysCmd.AddCommand(hostkeysAcceptCmd)
+	hostkeysCmd.AddCommand(hostkeysRevokeCmd)
+	hostkeysCmd.AddCommand(hostkeysImportCmd)
+
+	hostkeysAcceptCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "pins the key without asking for confirmation")
+	hostkeysRevokeCmd.Flags().String("fingerprint", "", "the SHA256 fingerprint of the key to remove, e.g. SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8")
+}
+
+// trustOnFirstUse asks the user whether to trust the key of servers without pinned keys.
+// Trusted keys are pinned for the entry.
+func trustOnFirstUse(uiService services.UiService) sshclient.UnknownHostKeyHandler {
+	return func(tag string, hostname string, key ssh.PublicKey) error {
+		fmt.Printf("The authenticity of the server for entry '%s' (%s) can't be established.\n", tag, hostname)
+		fmt.Printf("The %s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+		if !askForConfirmation("Are you sure you want to trust this key and pin it for the entry?") {
+			return sshclient.ErrHostKeyRejected
+		}
+
+		if err := uiService.AddHostKey(tag, sshclient.MarshalHostKey(key)); err != nil {
+			return fmt.Errorf("failed to pin the host key: %w", err)
+		}
+		fmt.Println(green("✓ pinned the host key for '%s'", tag))
+		return nil
+	}
+}
+
+// matchTag returns the tag of the entry matching the args the closest
+func matchTag(uiService services.UiService, args []string) string {
+	response, err := uiService.GetMatchingServer(strings.Join(args, " "))
+	if err != nil {
+		dief("Error: %s", err)
+	}
+	return response.Tag
+}
+
+func describeHostKey(authorizedKey string) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return red("invalid key: %s", err)
+	}
+	return fmt.Sprintf("%s %s", key.Type(), ssh.FingerprintSHA256(key))
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/CryoCodec/jim/files"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// identityCmd represents the identity command
+var identityCmd = &cobra.Command{
+	Use:   "identity",
+	Short: "Manages your identity, which unlocks config files shared with you",
+	Long: `Manages your identity, which unlocks config files shared with you, e.g. a team inventory.
+The identity is an X25519 key pair, its private key is encrypted with your passphrase. Share the public key
+with the owner of a config file, who adds it with 'jim recipients add'. The identity is read from ~/.jim/identity,
+the environment variable JIM_IDENTITY or --identity may point to another file.`,
+}
+
+var identityNewCmd = &cobra.Command{
+	Use:   "new [path/to/identity]",
+	Short: "Generates a new identity",
+	Long:  `Generates a new identity, which is protected by a passphrase, and prints its public key. Existing identities are not overwritten.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := filepath.Join(files.GetJimConfigDir(), "identity")
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if _, err := os.Stat(path); err == nil {
+			dief("The identity %s exists already\n", path)
+		}
+
+		passphrase := readNewPassword("Enter the passphrase of the new identity:")
+		id, err := crypto.GenerateIdentity()
+		if err != nil {
+			dief("Failed to generate the identity. Reason: %s\n", err)
+		}
+		identityFile, err := crypto.EncryptIdentity(id, passphrase)
+		if err != nil {
+			dief("Failed to encrypt the identity. Reason: %s\n", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			dief("Failed to create the directory of %s: %s\n", path, err)
+		}
+		if err := files.WriteFileAtomic(path, identityFile, 0600); err != nil {
+			dief("Failed to write to %s: %s\n", path, err)
+		}
+		fmt.Println(green("✓ generated the identity %s", path))
+		fmt.Printf("Public key: %s\n", id.Recipient())
+	},
+}
+
+var identityShowCmd = &cobra.Command{
+	Use:   "show [path/to/identity]",
+	Short: "Prints the public key of your identity",
+	Long:  `Prints the public key of your identity, no passphrase is needed.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := identityPath()
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if path == "" {
+			die("There is no identity yet, generate one with 'jim identity new'")
+		}
+		recipient, err := crypto.IdentityRecipient(readIdentityFile(path))
+		if err != nil {
+			dief("Failed to read the identity %s. Reason: %s\n", path, err)
+		}
+		fmt.Println(recipient)
+	},
+}
+
+// identityPath returns the path of the identity passed by --identity, set by JIM_IDENTITY
+// or the default identity, if it exists. Returns an empty string, if there is no identity.
+func identityPath() string {
+	if unlockIdentity != "" {
+		return unlockIdentity
+	}
+	if path := os.Getenv("JIM_IDENTITY"); path != "" {
+		return path
+	}
+	path := filepath.Join(files.GetJimConfigDir(), "identity")
+	if !files.Exists(path) {
+		return ""
+	}
+	return path
+}
+
+// identityFor returns the path of the identity, if it is a recipient of any of the encrypted files.
+// An identity passed by --identity is always returned.
+func identityFor(cipherTexts ...[]byte) string {
+	path := identityPath()
+	if path == "" || unlockIdentity != "" {
+		return path
+	}
+	identityFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	recipient, err := crypto.IdentityRecipient(identityFile)
+	if err != nil {
+		return ""
+	}
+	for _, cipherText := range cipherTexts {
+		header, _, err := crypto.ParseHeader(cipherText)
+		if err != nil {
+			continue
+		}
+		for _, slot := range header.Slots {
+			if r, ok := slot.Recipient(); ok && r == recipient {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// identityForConfigFiles returns the path of the identity, if it is a recipient of any of the config files in use
+func identityForConfigFiles() string {
+	paths, err := files.GetJimConfigFilePaths()
+	if err != nil {
+		return ""
+	}
+	var cipherTexts [][]byte
+	for _, path := range paths {
+		fileContents, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if cipherText, err := b64.StdEncoding.DecodeString(string(fileContents)); err == nil {
+			cipherTexts = append(cipherTexts, cipherText)
+		}
+	}
+	return identityFor(cipherTexts...)
+}
+
+// decryptIdentity asks for the passphrase of the identity at path and decrypts it
+func decryptIdentity(path string) (*crypto.Identity, error) {
+	identityFile := readIdentityFile(path)
+	fmt.Printf("Enter the passphrase of your identity %s:\n", path)
+	passphrase, err := term.ReadPassword(syscall.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptIdentity(identityFile, passphrase)
+}
+
+func readIdentityFile(path string) []byte {
+	identityFile, err := ioutil.ReadFile(path)
+	if err != nil {
+		dief("Error reading the identity: %s\n", err)
+	}
+	return identityFile
+}
+
+func init() {
+	rootCmd.AddCommand(identityCmd)
+	identityCmd.AddCommand(identityNewCmd)
+	identityCmd.AddCommand(identityShowCmd)
+}
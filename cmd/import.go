@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/inventory"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var importDryRun bool
+var importUpdate bool
+var importMapping inventory.Mapping
+var importColumns map[string]string
+var importDelimiter string
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Imports entries from other formats into the config file",
+	Long: `Imports entries from other formats into the config file.
+New entries are added to the first config file, entries whose tag already exists are skipped unless --update is given.
+Without --group and --env, group and env are derived from the host names, e.g. billing-web1-prod becomes group billing and env PROD.
+The imported entries are checked like 'jim validate' does, nothing is imported, if any check fails.`,
+}
+
+// importSSHConfigCmd represents the import ssh-config command
+var importSSHConfigCmd = &cobra.Command{
+	Use:   "ssh-config [path/to/file]",
+	Short: "Imports the hosts of an OpenSSH config file",
+	Long: `Imports the hosts of an OpenSSH config file, ~/.ssh/config by default.
+Every host declared without wildcards becomes an entry, tagged with the first name of its Host line.
+Host blocks with wildcards, Include, HostName, Port, User, ProxyJump and IdentityFile are evaluated like ssh does.
+The first existing identity file of a host is stored in the keys section of the config file.
+Keys protected by a passphrase are only imported, if the passphrase is entered.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		var path string
+		if len(args) == 1 {
+			path = args[0]
+		} else {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				dief("Could not read user home directory path: %s", err)
+			}
+			path = filepath.Join(homeDir, ".ssh", "config")
+		}
+
+		hosts, warnings, err := inventory.ParseSSHConfig(path)
+		if err != nil {
+			dief("Failed to read the ssh config %s: %s\n", path, err)
+		}
+		if len(hosts) == 0 {
+			dief("No hosts are declared in %s\n", path)
+		}
+
+		jimConfig, keyWarnings, err := inventory.FromSSHHosts(hosts, importMapping, readPassphrase)
+		if err != nil {
+			dief("%s\n", err)
+		}
+		runImport(&jimConfig, append(warnings, keyWarnings...))
+	},
+}
+
+// importCSVCmd represents the import csv command
+var importCSVCmd = &cobra.Command{
+	Use:   "csv path/to/file.csv",
+	Short: "Imports the rows of a CSV file",
+	Long: `Imports the rows of a CSV file, whose first line names the columns.
+The fields tag, aliases, group, env, host, port, username, password, dir, key_file and jump are read from the columns
+of the same name. Map them to other columns with --columns, e.g. --columns host=IP,tag=Name.
+Only host is required, the tag defaults to the host and the port to 22. Aliases and jump hosts are separated by semicolons.
+Without group and env columns, group and env are derived from the tag.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		delimiter := []rune(importDelimiter)
+		if len(delimiter) != 1 {
+			die("The delimiter must be a single character")
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			dief("Failed to read the CSV file: %s\n", err)
+		}
+		defer file.Close()
+
+		jimConfig, warnings, err := inventory.FromCSV(file, importColumns, delimiter[0], importMapping, readPassphrase)
+		if err != nil {
+			dief("Failed to read the CSV file %s: %s\n", args[0], err)
+		}
+		if len(jimConfig.Entries) == 0 {
+			dief("No hosts are declared in %s\n", args[0])
+		}
+		runImport(&jimConfig, warnings)
+	},
+}
+
+// importAnsibleCmd represents the import ansible command
+var importAnsibleCmd = &cobra.Command{
+	Use:   "ansible path/to/inventory",
+	Short: "Imports the hosts of an Ansible inventory file",
+	Long: `Imports the hosts of an Ansible inventory file in INI or YAML format.
+The connection settings are read from the variables ansible_host, ansible_port, ansible_user, ansible_password
+and ansible_ssh_private_key_file, group variables are inherited like Ansible does.
+Inventory groups named like an env, e.g. prod, staging or int, determine the env of their hosts,
+the most specific other group determines the group. Host ranges like web[01:03] are expanded.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		hosts, warnings, err := inventory.ParseAnsibleInventory(args[0])
+		if err != nil {
+			dief("Failed to read the inventory %s: %s\n", args[0], err)
+		}
+		if len(hosts) == 0 {
+			dief("No hosts are declared in %s\n", args[0])
+		}
+
+		jimConfig, keyWarnings, err := inventory.FromAnsibleHosts(hosts, importMapping, readPassphrase)
+		if err != nil {
+			dief("%s\n", err)
+		}
+		runImport(&jimConfig, append(warnings, keyWarnings...))
+	},
+}
+
+// readPassphrase asks for the passphrase of the private key at path
+func readPassphrase(path string) ([]byte, error) {
+	fmt.Printf("Enter the passphrase of %s, or nothing to skip the key:\n", path)
+	return term.ReadPassword(syscall.Stdin)
+}
+
+// runImport merges the imported entries into the config files, or previews the result with --dry-run
+func runImport(jimConfig *config.JimConfig, warnings []string) {
+	uiService := services.NewUiService()
+	defer uiService.ShutDown()
+
+	// makes sure the server is in the correct state.
+	// might ask the user to enter the master password.
+	err := runPreamble(uiService)
+	if err != nil {
+		dief("Received unexpected error: %s", err)
+	}
+
+	// the imported entries are checked like 'jim validate' does, before they are sent to the daemon
+	groups, err := uiService.GetEntries(nil, math.MaxInt32)
+	if err != nil {
+		dief("Failed to list the existing entries: %s\n", err)
+	}
+	messagesPerStep, validationErrors := checkEntries(jimConfig, existingNames(*groups, jimConfig, importUpdate))
+	fmt.Println("Validating the imported entries:")
+	printStepMessages(messagesPerStep)
+	if len(validationErrors) != 0 {
+		for _, warning := range warnings {
+			fmt.Println(yellow("%s", warning))
+		}
+		fmt.Println()
+		printInvalidEntries(validationErrors)
+		die(red("Nothing was imported, fix the errors in the imported file and try again."))
+	}
+
+	results, err := uiService.ImportEntries(jimConfig, importUpdate, importDryRun)
+	if err != nil {
+		dief("Failed to import the entries: %s\n", err)
+	}
+
+	for _, warning := range warnings {
+		fmt.Println(yellow("%s", warning))
+	}
+	if importDryRun {
+		fmt.Println(yellow("Dry run, the config files are not modified:"))
+	}
+
+	entries := make(map[string]config.JimConfigElement)
+	for _, el := range jimConfig.Entries {
+		entries[el.Tag] = el
+	}
+	added, updated, skipped := 0, 0, 0
+	for _, result := range results {
+		el := entries[result.Tag]
+		description := fmt.Sprintf("%s [%s / %s] -> %s@%s:%d", el.Tag, el.Group, el.Env, el.Server.Username, el.Server.Host, el.Server.Port)
+		if len(el.Server.Jump) != 0 {
+			description += fmt.Sprintf(" via %s", strings.Join(el.Server.Jump, ", "))
+		}
+		if el.Server.KeyRef != "" {
+			description += fmt.Sprintf(" with key %s", el.Server.KeyRef)
+		}
+
+		switch result.Action {
+		case domain.ImportAdded:
+			added++
+			fmt.Println(green("+ %s", description))
+		case domain.ImportUpdated:
+			updated++
+			fmt.Println(yellow("~ %s", description))
+		default:
+			skipped++
+			fmt.Printf("= %s already exists, use --update to update it\n", el.Tag)
+		}
+	}
+
+	if importDryRun {
+		fmt.Printf("Would add %d, update %d and skip %d entries.\n", added, updated, skipped)
+	} else {
+		fmt.Printf("Added %d, updated %d and skipped %d entries.\n", added, updated, skipped)
+	}
+}
+
+// existingNames maps the tags and aliases of the existing entries to the tag of their entry. Entries, which are imported
+// again, are skipped or updated, so the imported entry declares their tag. Their aliases are kept, unless they are updated.
+func existingNames(groups domain.GroupList, imported *config.JimConfig, update bool) map[string]string {
+	importedAliases := make(map[string][]string)
+	for _, el := range imported.Entries {
+		importedAliases[el.Tag] = el.Aliases
+	}
+
+	names := make(map[string]string)
+	for _, group := range groups {
+		for _, entry := range group.Entries {
+			aliases, reimported := importedAliases[entry.Tag]
+			if reimported && update && len(aliases) != 0 {
+				continue
+			}
+			if !reimported {
+				names[entry.Tag] = entry.Tag
+			}
+			for _, alias := range entry.Aliases {
+				names[alias] = entry.Tag
+			}
+		}
+	}
+	return names
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importSSHConfigCmd)
+	importCmd.AddCommand(importCSVCmd)
+	importCmd.AddCommand(importAnsibleCmd)
+	importCmd.PersistentFlags().BoolVar(&importDryRun, "dry-run", false, "Shows the result of the import without modifying the config files")
+	importCmd.PersistentFlags().BoolVar(&importUpdate, "update", false, "Updates host, port, username, key and jump hosts of existing entries")
+	importCmd.PersistentFlags().StringVar(&importMapping.Group, "group", "", "Sets the group of all imported entries")
+	importCmd.PersistentFlags().StringVar(&importMapping.Env, "env", "", "Sets the env of all imported entries")
+	importCSVCmd.Flags().StringToStringVar(&importColumns, "columns", map[string]string{}, "Maps fields to the names of the CSV columns, e.g. host=IP,tag=Name")
+	importCSVCmd.Flags().StringVar(&importDelimiter, "delimiter", ",", "The character separating the columns")
+}
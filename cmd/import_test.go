@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/CryoCodec/jim/inventory"
+)
+
+func importFixture(t *testing.T) *config.JimConfig {
+	t.Helper()
+	// no identity files of the user are found
+	t.Setenv("HOME", t.TempDir())
+	hosts, _, err := inventory.ParseSSHConfig("testdata/ssh_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, _, err := inventory.FromSSHHosts(hosts, inventory.Mapping{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &imported
+}
+
+// listed returns the entries of the config, as the daemon lists them after the import
+func listed(jimConfig *config.JimConfig) domain.GroupList {
+	var entries domain.ConnectionList
+	for _, el := range jimConfig.Entries {
+		entries = append(entries, domain.ConnectionInfo{Tag: el.Tag, Aliases: el.Aliases})
+	}
+	return domain.GroupList{{Title: "imported", Entries: entries}}
+}
+
+func TestImportSameFileTwice(t *testing.T) {
+	imported := importFixture(t)
+	if _, validationErrors := checkEntries(imported, existingNames(nil, imported, false)); len(validationErrors) != 0 {
+		t.Fatalf("the first import failed: %+v", validationErrors)
+	}
+
+	existing := listed(imported)
+	for _, update := range []bool{false, true} {
+		again := importFixture(t)
+		if _, validationErrors := checkEntries(again, existingNames(existing, again, update)); len(validationErrors) != 0 {
+			t.Errorf("importing again with update %t failed: %+v", update, validationErrors)
+		}
+	}
+}
+
+func TestImportAliasClashNamesOwner(t *testing.T) {
+	existing := listed(importFixture(t))
+	imported := &config.JimConfig{Entries: []config.JimConfigElement{{
+		Group: "billing", Env: "PROD", Tag: "billing-web2-prod", Aliases: []string{"web1"},
+		Server: config.JimConfigEntry{Host: "10.0.0.2", Port: 22},
+	}}}
+
+	for _, update := range []bool{false, true} {
+		_, validationErrors := checkEntries(imported, existingNames(existing, imported, update))
+		want := []validationError{{tag: "billing-web2-prod", reason: "The alias 'web1' is already used by the entry 'billing-web1-prod'"}}
+		if !reflect.DeepEqual(validationErrors, want) {
+			t.Errorf("update %t: errors = %+v, want %+v", update, validationErrors, want)
+		}
+	}
+}
+
+func TestExistingNames(t *testing.T) {
+	existing := listed(importFixture(t))
+	imported := &config.JimConfig{Entries: []config.JimConfigElement{{Tag: "billing-web1-prod", Aliases: []string{"web1-new"}}}}
+
+	skipped := map[string]string{"bastion": "bastion", "jump": "bastion", "web1": "billing-web1-prod", "web1.example.com": "billing-web1-prod"}
+	if names := existingNames(existing, imported, false); !reflect.DeepEqual(names, skipped) {
+		t.Errorf("names = %v, want %v", names, skipped)
+	}
+	// updated entries take over the imported aliases
+	updated := map[string]string{"bastion": "bastion", "jump": "bastion"}
+	if names := existingNames(existing, imported, true); !reflect.DeepEqual(names, updated) {
+		t.Errorf("names = %v, want %v", names, updated)
+	}
+}
@@ -3,19 +3,36 @@ package cmd
 import (
 	"fmt"
 	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/files"
 	"github.com/spf13/cobra"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 var filters []string
 var limit int32
 
+const filterFlagDescription = `Applies filters to the returned list. 
+You may filter over all attributes, or be more precise by using one or multiple of these categories: 
+- group
+- env
+- host
+- tag
+- the name of any label, e.g. role
+
+To filter over all attributes use: '-f "Your text of choice"'
+To filter a category, prefix the filter value with the category e.g. '-f "env:INT"'. 
+Use this flag multiple times to apply multiple filters e.g. '-f "env:INT" -f "tag:DB"'`
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists all entries in the configuration file",
-	Long:  `Lists all entries in the configuration file`,
-	Args:  cobra.ExactArgs(0),
+	Long: `Lists all entries in the configuration file.
+If multiple config files are loaded, the file declaring each entry is shown and tags declared by multiple files are reported.`,
+	Args: cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
 		initLogging()
 
@@ -35,11 +52,23 @@ var listCmd = &cobra.Command{
 			die(err.Error())
 		}
 
+		// the source file is only of interest, if entries are merged from multiple files
+		paths, _ := files.GetJimConfigFilePaths()
+		showSource := len(paths) > 1
+
 		fmt.Println()
 		for _, group := range *groups {
 			fmt.Println(group.Title)
 			for _, entry := range group.Entries {
-				fmt.Printf("%s -> %s\n", entry.Tag, entry.HostInfo)
+				name := entry.Tag
+				if len(entry.Aliases) != 0 {
+					name = fmt.Sprintf("%s (%s)", entry.Tag, strings.Join(entry.Aliases, ", "))
+				}
+				if showSource {
+					fmt.Printf("%s -> %s [%s]\n", name, entry.HostInfo, shortenHome(entry.Source))
+				} else {
+					fmt.Printf("%s -> %s\n", name, entry.HostInfo)
+				}
 			}
 			fmt.Println()
 		}
@@ -47,21 +76,34 @@ var listCmd = &cobra.Command{
 		if len(*groups) == 0 {
 			fmt.Println("Your query did not yield any results.")
 		}
+
+		conflicts, err := uiService.GetConflicts()
+		if err != nil {
+			dief("Failed to fetch the conflicting tags: %s\n", err)
+		}
+		for _, conflict := range conflicts {
+			var sources []string
+			for _, source := range conflict.Sources {
+				sources = append(sources, shortenHome(source))
+			}
+			fmt.Println(yellow("The tag '%s' is declared in %s, the entry of %s is used.", conflict.Tag, strings.Join(sources, ", "), sources[0]))
+		}
 	},
 }
 
-func init() {
-	filterFlagDescription := `Applies filters to the returned list. 
-You may filter over all attributes, or be more precise by using one or multiple of these categories: 
-- group
-- env
-- host
-- tag
-
-To filter over all attributes use: '-f "Your text of choice"'
-To filter a category, prefix the filter value with the category e.g. '-f "env:INT"'. 
-Use this flag multiple times to apply multiple filters e.g. '-f "env:INT" -f "tag:DB"'`
+// shortenHome replaces the home directory at the start of path with ~
+func shortenHome(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
 
+func init() {
 	limitFlagDescription := `Limits the amount entries to be printed. 
 The result will include the best matched results. 
 This flag is only useful if combined filters.`
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/CryoCodec/jim/files"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate [path/to/file]",
+	Short: "Upgrades config files to the current version of the config format",
+	Long: `Upgrades the config file at given path to the current version of the config format in place.
+Without path, all config files in use are upgraded. Encrypted files must end with .enc, they are decrypted with
+the master password or your identity and encrypted again with the same data key, so all key slots keep working. The changes are shown before the file is written.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		paths := args
+		if len(paths) == 0 {
+			var err error
+			if paths, err = files.GetJimConfigFilePaths(); err != nil {
+				dief("%s\n", err)
+			}
+		}
+
+		for _, path := range paths {
+			migrateFile(path)
+		}
+	},
+}
+
+// migrateFile upgrades the config file at path after the user confirmed the changes
+func migrateFile(path string) {
+	if !files.Exists(path) {
+		dief("The file %s does not exist or is a directory\n", path)
+	}
+
+	fileContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		dief("Error reading file: %s\n", err)
+	}
+
+	encrypted := filepath.Ext(path) == ".enc"
+	clearText := fileContents
+	var vault *crypto.Vault
+	if encrypted {
+		cipherText := readCipherText(path)
+		if vault, clearText, err = crypto.Open(unlockSecret(path, cipherText), cipherText); err != nil {
+			dief("Failed to decrypt %s. Reason: %s\n", path, err)
+		}
+	}
+
+	format := config.FormatOf(strings.TrimSuffix(path, ".enc"), clearText)
+	jimConfig, changes, err := config.Migrate(clearText, format)
+	if err != nil {
+		dief("The file %s could not be read as jim config, reason: %s\n", path, err)
+	}
+
+	if len(changes) == 0 {
+		fmt.Println(green("%s already uses the current version %d", path, config.Version))
+		return
+	}
+
+	fmt.Printf("Upgrading %s to version %d of the config format:\n", path, config.Version)
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+	if format != config.JSON {
+		fmt.Println(yellow("The file is rewritten as %s, comments are not preserved.", format))
+	}
+	if !askForConfirmation("Write the upgraded file?") {
+		fmt.Printf("Skipped %s\n", path)
+		return
+	}
+
+	migrated, err := jimConfig.MarshalFormat(format)
+	if err != nil {
+		dief("Failed to serialize the upgraded config. Reason: %s\n", err)
+	}
+	if encrypted {
+		cipherText, err := vault.Seal(migrated)
+		if err != nil {
+			dief("Failed to encrypt the upgraded config. Reason: %s\n", err)
+		}
+		migrated = []byte(b64.StdEncoding.EncodeToString(cipherText))
+	}
+
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := files.WriteFileAtomic(path, migrated, perm); err != nil {
+		dief("Failed to write to %s: %s\n", path, err)
+	}
+	fmt.Println(green("✓ upgraded %s", path))
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
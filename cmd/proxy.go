@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/sshclient"
+	"github.com/spf13/cobra"
+)
+
+// proxyCmd represents the proxy command
+var proxyCmd = &cobra.Command{
+	Use:   "proxy tag",
+	Short: "Connects other ssh clients to a server, which jim authenticates against",
+	Long: `Connects other ssh clients to a server, which jim authenticates against, e.g. with a stored password.
+Meant to be used as ProxyCommand, see 'jim export ssh-config'. The ssh protocol is spoken on stdin and stdout.
+The tag must match an entry exactly. The config must be decrypted already and the host keys of the server
+and its jump hosts must be pinned, since there's no terminal to ask for them.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		// stdout carries the ssh protocol, so all messages go to stderr
+		fail := func(format string, a ...interface{}) {
+			fmt.Fprintf(os.Stderr, format, a...)
+			os.Exit(1)
+		}
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		if !uiService.IsServerReady() {
+			fail("jim is locked, unlock it with 'jim list' first\n")
+		}
+
+		match, err := uiService.GetMatchingServer(args[0])
+		if err != nil {
+			fail("Error: %s\n", err)
+		}
+		if match.Tag != args[0] {
+			fail("There's no entry with tag '%s'\n", args[0])
+		}
+		if match.Server.Record {
+			fail("The sessions of '%s' have to be recorded, use 'jim connect' instead\n", match.Tag)
+		}
+
+		client, err := sshclient.Dial(match, nil)
+		if err != nil {
+			fail("Error: %s\n", err)
+		}
+		defer client.Close()
+
+		if err := sshclient.ServeProxy(sshclient.StdioConn(), client); err != nil {
+			fail("Error: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+}
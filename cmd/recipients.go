@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/spf13/cobra"
+)
+
+// recipientsCmd represents the recipients command
+var recipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Manages the recipients of an encrypted config file",
+	Long: `Manages the recipients of an encrypted config file, e.g. of a team inventory. Each recipient unlocks the file
+with their own identity and passphrase, see 'jim identity'. Adding or removing a recipient wraps the data key
+of the file anew, the entries are not encrypted again.
+Without path, the config file in use is changed, if there is only one. The file is unlocked with your identity,
+if it is a recipient, otherwise with a password or recovery key, or with the keyfile passed by --keyfile.`,
+}
+
+var recipientsListCmd = &cobra.Command{
+	Use:   "list [path/to/file.enc]",
+	Short: "Lists the public keys of the recipients",
+	Long:  `Lists the public keys of the recipients of an encrypted config file. The slots are stored unencrypted, no password is needed.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := resolveConfigFile(args)
+		header, _, err := crypto.ParseHeader(readCipherText(path))
+		if err != nil {
+			dief("Corrupt input file %s. Reason: %s\n", path, err)
+		}
+
+		count := 0
+		for i, slot := range header.Slots {
+			if recipient, ok := slot.Recipient(); ok {
+				fmt.Printf("  %d  %s\n", i, recipient)
+				count++
+			}
+		}
+		if count == 0 {
+			fmt.Printf("%s has no recipients\n", path)
+		}
+	},
+}
+
+var recipientsAddCmd = &cobra.Command{
+	Use:   "add public-key [path/to/file.enc]",
+	Short: "Adds a recipient, who unlocks the file with their identity",
+	Long:  `Adds a recipient, who unlocks the file with their identity. The public key is printed by 'jim identity show'.`,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		recipient, err := crypto.ParseRecipient(args[0])
+		if err != nil {
+			dief("%s\n", err)
+		}
+		path := resolveConfigFile(args[1:])
+		vault, secret := unlockVault(path, readCipherText(path))
+
+		index, err := vault.AddRecipientSlot(recipient)
+		if err != nil {
+			dief("Failed to add the recipient. Reason: %s\n", err)
+		}
+		writeVault(path, vault, secret)
+		fmt.Println(green("✓ added the recipient %s in slot %d to %s", recipient, index, path))
+	},
+}
+
+var recipientsRmCmd = &cobra.Command{
+	Use:     "rm public-key [path/to/file.enc]",
+	Aliases: []string{"remove"},
+	Short:   "Removes a recipient",
+	Long: `Removes a recipient, so their identity doesn't unlock the file anymore. The last slot of a file can't be removed.
+The data key of the file stays the same, change the secrets stored in the file, if the recipient must not read them anymore.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		recipient, err := crypto.ParseRecipient(args[0])
+		if err != nil {
+			dief("%s\n", err)
+		}
+		path := resolveConfigFile(args[1:])
+		vault, secret := unlockVault(path, readCipherText(path))
+
+		if !assumeYes && !askForConfirmation(fmt.Sprintf("Remove the recipient %s from %s?", recipient, path)) {
+			return
+		}
+		if err := vault.RemoveRecipient(recipient); err != nil {
+			dief("Failed to remove the recipient. Reason: %s\n", err)
+		}
+		writeVault(path, vault, secret)
+		fmt.Println(green("✓ removed the recipient %s from %s", recipient, path))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recipientsCmd)
+	recipientsCmd.AddCommand(recipientsListCmd)
+	recipientsCmd.AddCommand(recipientsAddCmd)
+	recipientsCmd.AddCommand(recipientsRmCmd)
+
+	recipientsCmd.PersistentFlags().StringVar(&unlockKeyfile, "keyfile", "", "unlocks the file with the keyfile at given path instead of a password")
+	recipientsCmd.PersistentFlags().StringVar(&unlockIdentity, "identity", "", "unlocks the file with the identity at given path")
+	recipientsRmCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "removes the recipient without asking for confirmation")
+}
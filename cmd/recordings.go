@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/recordings"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var playbackSpeed float64
+var idleLimit time.Duration
+
+// recordingsCmd represents the recordings command
+var recordingsCmd = &cobra.Command{
+	Use:   "recordings",
+	Short: "Lists and replays recorded connect sessions",
+	Long: `Lists and replays recorded connect sessions.
+Sessions are recorded, if "record" is set for the entry or its env is listed in the "recording" section of the config file.
+The recordings are stored in the asciicast v2 format of asciinema in ~/.jim/recordings.
+Encrypted recordings can only be replayed with the vault unlocked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		recordingsListCmd.Run(cmd, args)
+	},
+}
+
+var recordingsListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "Lists the recorded sessions",
+	Long:    `Lists the recorded sessions, oldest first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		list, err := recordings.List()
+		if err != nil {
+			dief("Failed to list the recordings: %s\n", err)
+		}
+		if len(list) == 0 {
+			fmt.Println("No sessions were recorded yet.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTAG\tDATE\tSIZE\tENCRYPTED")
+		for _, r := range list {
+			encrypted := "no"
+			if r.Encrypted {
+				encrypted = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Tag, r.Time.Format("2006-01-02 15:04:05"), formatBytes(r.Size), encrypted)
+		}
+		w.Flush()
+	},
+}
+
+var recordingsPlayCmd = &cobra.Command{
+	Use:   "play name",
+	Short: "Replays a recorded session in the terminal",
+	Long:  `Replays a recorded session in the terminal. The name is the one shown by 'jim recordings ls'.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		reader := openRecording(args[0])
+		defer reader.Close()
+
+		buffered := bufio.NewReader(reader)
+		header, err := recordings.ReadHeader(buffered)
+		if err != nil {
+			dief("Failed to replay the recording: %s\n", err)
+		}
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width < header.Width {
+			fmt.Println(yellow("The session was recorded with %d columns, enlarge the terminal for a proper replay.", header.Width))
+		}
+
+		if err := recordings.Play(buffered, os.Stdout, playbackSpeed, idleLimit); err != nil {
+			dief("\nFailed to replay the recording: %s\n", err)
+		}
+		fmt.Println()
+	},
+}
+
+var recordingsCatCmd = &cobra.Command{
+	Use:   "cat name",
+	Short: "Prints a recording in the asciicast format",
+	Long: `Prints a recording in the asciicast format, decrypting it if necessary.
+Use it to pass recordings to other tools, e.g. jim recordings cat name > session.cast && asciinema play session.cast`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		reader := openRecording(args[0])
+		defer reader.Close()
+
+		if _, err := io.Copy(os.Stdout, reader); err != nil {
+			dief("Failed to read the recording: %s\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recordingsCmd)
+	recordingsCmd.AddCommand(recordingsListCmd)
+	recordingsCmd.AddCommand(recordingsPlayCmd)
+	recordingsCmd.AddCommand(recordingsCatCmd)
+
+	recordingsPlayCmd.Flags().Float64VarP(&playbackSpeed, "speed", "s", 1, "speeds up the replay by the given factor")
+	recordingsPlayCmd.Flags().DurationVarP(&idleLimit, "idle-limit", "i", 2*time.Second, "limits pauses to the given duration, 0 keeps the recorded pauses")
+}
+
+// openRecording opens the recording with given name. Encrypted recordings are decrypted with the key from the vault.
+func openRecording(name string) io.ReadCloser {
+	recording, err := recordings.Find(name)
+	if err != nil {
+		dief("Error: %s\n", err)
+	}
+
+	var key []byte
+	if recording.Encrypted {
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		if err := runPreamble(uiService); err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+		if key, err = uiService.GetRecordingKey(false); err != nil {
+			dief("Failed to fetch the recording key: %s\n", err)
+		}
+	}
+
+	reader, err := recordings.Open(recording, key)
+	if err != nil {
+		dief("Failed to open the recording: %s\n", err)
+	}
+	return reader
+}
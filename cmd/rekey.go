@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/CryoCodec/jim/files"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// rekeyCmd represents the rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey [path/to/file.enc]",
+	Short: "Changes the master password of an encrypted config file",
+	Long: `Changes the master password of the encrypted config file at given path in place.
+Without path, the config file in use is rekeyed, if there is only one. The current password is verified and its
+key slot is replaced by a slot with the new password, the other slots keep working. The file is replaced at once,
+no plain text is written to disk. A running daemon reads the file again and stays unlocked.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := resolveConfigFile(args)
+		cipherText := readCipherText(path)
+
+		fmt.Printf("Enter the current master password of %s:\n", path)
+		oldPassword, err := term.ReadPassword(syscall.Stdin)
+		if err != nil {
+			die("Error reading the password from terminal. Try again.")
+		}
+		vault, _, err := crypto.Open(oldPassword, cipherText)
+		if err != nil {
+			dief("Failed to decrypt %s. Reason: %s\n", path, err)
+		}
+		if slot := vault.Slots()[vault.UnlockedSlot()]; slot.Type != crypto.SlotPassword {
+			dief("The file was unlocked with a %s, use 'jim slots add password' to add a password\n", slot.Type)
+		}
+
+		newPassword := readNewPassword("Enter the new master password:")
+
+		// the key derivation parameters of the slot are kept, the contents are not encrypted again
+		if err := vault.ReplacePassword(newPassword); err != nil {
+			dief("Failed to change the password of %s. Reason: %s\n", path, err)
+		}
+		writeVault(path, vault, newPassword)
+		fmt.Println(green("✓ changed the master password of %s", path))
+	},
+}
+
+// configFileInUse returns the path, under which the daemon loads the config file at path, or an empty string,
+// if the file is not in use
+func configFileInUse(path string) string {
+	paths, err := files.GetJimConfigFilePaths()
+	if err != nil {
+		return ""
+	}
+	absPath, _ := filepath.Abs(path)
+	for _, p := range paths {
+		if abs, _ := filepath.Abs(p); abs == absPath {
+			return p
+		}
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(rekeyCmd)
+}
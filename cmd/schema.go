@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Prints the JSON Schema of the config file",
+	Long: `Prints the JSON Schema of the config file in the current version.
+Save it to a file and point your editor to it, to get completion and validation while editing plain text configs, e.g.
+	jim schema > ~/.jim/config.schema.json`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		schema, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			dief("Failed to serialize the schema. Reason: %s\n", err)
+		}
+		fmt.Println(string(schema))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"crypto/rand"
+	b64 "encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/CryoCodec/jim/files"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// generatedKeyfileSize is the number of random bytes of a keyfile generated by jim
+const generatedKeyfileSize = 64
+
+// unlockKeyfile and unlockIdentity are the paths of a keyfile or an identity, which unlock an encrypted file
+var unlockKeyfile string
+var unlockIdentity string
+var slotsKDF string
+var slotsBenchmark bool
+var slotsTarget time.Duration
+
+// slotsCmd represents the slots command
+var slotsCmd = &cobra.Command{
+	Use:   "slots",
+	Short: "Manages the key slots of an encrypted config file",
+	Long: `Manages the key slots of an encrypted config file. The config is encrypted with a random data key,
+each key slot holds the data key encrypted with a password, a keyfile, a recovery key or for a recipient.
+Any of the slots unlocks the file, adding or removing a slot doesn't encrypt the config again.
+Without path, the config file in use is changed, if there is only one. The file is unlocked with your identity,
+if it is a recipient, otherwise with a password or recovery key, or with the keyfile passed by --keyfile.`,
+}
+
+var slotsListCmd = &cobra.Command{
+	Use:   "list [path/to/file.enc]",
+	Short: "Lists the key slots of an encrypted config file",
+	Long:  `Lists the key slots of an encrypted config file. The slots are stored unencrypted, no password is needed.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := resolveConfigFile(args)
+		header, _, err := crypto.ParseHeader(readCipherText(path))
+		if err != nil {
+			dief("Corrupt input file %s. Reason: %s\n", path, err)
+		}
+
+		fmt.Printf("%s (format version %d)\n", path, header.Version)
+		for i, slot := range header.Slots {
+			if recipient, ok := slot.Recipient(); ok {
+				fmt.Printf("  %d  %-12s  %s\n", i, slot.Type, recipient)
+				continue
+			}
+			fmt.Printf("  %d  %-12s  %s\n", i, slot.Type, slot.KDF)
+		}
+		if header.Version < crypto.FormatVersion {
+			fmt.Println(yellow("The file has no data key yet, it gets one when it is written again, e.g. on adding a slot."))
+		}
+	},
+}
+
+var slotsAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Adds a key slot to an encrypted config file",
+}
+
+var slotsAddPasswordCmd = &cobra.Command{
+	Use:   "password [path/to/file.enc]",
+	Short: "Adds a slot unlocked by another password",
+	Long: `Adds a slot unlocked by another password. The key is derived from the password with the function given by --kdf,
+--kdf-benchmark tunes the parameters to take about --kdf-target on this machine.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := resolveConfigFile(args)
+		vault, secret := unlockVault(path, readCipherText(path))
+
+		algorithm, err := crypto.ParseKDFAlgorithm(slotsKDF)
+		if err != nil {
+			dief("%s\n", err)
+		}
+		params := crypto.DefaultParams(algorithm)
+		if slotsBenchmark {
+			fmt.Printf("Calibrating %s to unlock in about %s\n", algorithm, slotsTarget)
+			var elapsed time.Duration
+			params, elapsed, err = crypto.CalibrateKDF(algorithm, slotsTarget)
+			if err != nil {
+				dief("Failed to calibrate the key derivation. Reason: %s\n", err)
+			}
+			fmt.Printf("Using %s, it takes %s on this machine\n", params, elapsed.Round(time.Millisecond))
+		}
+
+		password := readNewPassword("Enter the password of the new slot:")
+		index, err := vault.AddPasswordSlot(password, params)
+		if err != nil {
+			dief("Failed to add the slot. Reason: %s\n", err)
+		}
+		writeVault(path, vault, secret)
+		fmt.Println(green("✓ added the password slot %d to %s", index, path))
+	},
+}
+
+var slotsAddKeyfileCmd = &cobra.Command{
+	Use:   "keyfile path/to/keyfile [path/to/file.enc]",
+	Short: "Adds a slot unlocked by a keyfile",
+	Long: `Adds a slot unlocked by the contents of a keyfile. If the keyfile doesn't exist, a keyfile with random contents
+is generated. Keep the keyfile apart from the config file, e.g. on a removable drive.
+The daemon is unlocked with the keyfile, if the environment variable JIM_KEYFILE holds its path.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		keyfilePath := args[0]
+		path := resolveConfigFile(args[1:])
+		vault, secret := unlockVault(path, readCipherText(path))
+
+		generated := false
+		if !files.Exists(keyfilePath) {
+			keyfile := make([]byte, generatedKeyfileSize)
+			if _, err := rand.Read(keyfile); err != nil {
+				dief("Failed to generate the keyfile. Reason: %s\n", err)
+			}
+			if err := ioutil.WriteFile(keyfilePath, keyfile, 0600); err != nil {
+				dief("Failed to write to %s: %s\n", keyfilePath, err)
+			}
+			generated = true
+		}
+
+		index, err := vault.AddKeyfileSlot(readKeyfile(keyfilePath))
+		if err != nil {
+			dief("Failed to add the slot. Reason: %s\n", err)
+		}
+		writeVault(path, vault, secret)
+		if generated {
+			fmt.Println(green("✓ generated the keyfile %s", keyfilePath))
+		}
+		fmt.Println(green("✓ added the keyfile slot %d to %s", index, path))
+	},
+}
+
+var slotsAddRecoveryCmd = &cobra.Command{
+	Use:   "recovery [path/to/file.enc]",
+	Short: "Adds a slot unlocked by a generated recovery key",
+	Long: `Adds a slot unlocked by a generated recovery key. The recovery key is shown only once, write it down
+and keep it in a safe place. It is typed like a password, wherever jim asks for one.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		path := resolveConfigFile(args)
+		vault, secret := unlockVault(path, readCipherText(path))
+
+		recoveryKey, index, err := vault.AddRecoverySlot()
+		if err != nil {
+			dief("Failed to add the slot. Reason: %s\n", err)
+		}
+		writeVault(path, vault, secret)
+		fmt.Println(green("✓ added the recovery key slot %d to %s", index, path))
+		fmt.Printf("Recovery key: %s\n", recoveryKey)
+		fmt.Println(yellow("The recovery key is not shown again."))
+	},
+}
+
+var slotsRemoveCmd = &cobra.Command{
+	Use:   "remove index [path/to/file.enc]",
+	Short: "Removes a key slot from an encrypted config file",
+	Long:  `Removes the key slot with given index, as shown by 'jim slots list'. The last slot of a file can't be removed.`,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		index, err := strconv.Atoi(args[0])
+		if err != nil {
+			dief("The index %s is not a number\n", args[0])
+		}
+		path := resolveConfigFile(args[1:])
+		vault, secret := unlockVault(path, readCipherText(path))
+
+		if index < 0 || index >= len(vault.Slots()) {
+			dief("There is no key slot %d in %s, see 'jim slots list'\n", index, path)
+		}
+		if index == vault.UnlockedSlot() {
+			fmt.Println(yellow("The slot %d is the one you just unlocked the file with.", index))
+		}
+		if !assumeYes && !askForConfirmation(fmt.Sprintf("Remove the %s slot %d from %s?", vault.Slots()[index].Type, index, path)) {
+			return
+		}
+		if err := vault.RemoveSlot(index); err != nil {
+			dief("Failed to remove the slot. Reason: %s\n", err)
+		}
+		writeVault(path, vault, secret)
+		fmt.Println(green("✓ removed the slot %d from %s", index, path))
+	},
+}
+
+// resolveConfigFile returns the path passed in args, or the config file in use, if there is only one
+func resolveConfigFile(args []string) string {
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+	} else {
+		paths, err := files.GetJimConfigFilePaths()
+		if err != nil {
+			dief("%s\n", err)
+		}
+		if len(paths) != 1 {
+			dief("There are %d config files in use, pass the path of the file\n", len(paths))
+		}
+		path = paths[0]
+	}
+
+	if !files.Exists(path) {
+		dief("The file %s does not exist or is a directory\n", path)
+	}
+	if filepath.Ext(path) != ".enc" {
+		dief("The file %s did not end on .enc. The file must be encrypted with jim.\n", path)
+	}
+	return path
+}
+
+// readCipherText reads and decodes the encrypted config file at path
+func readCipherText(path string) []byte {
+	fileContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		dief("Error reading file: %s\n", err)
+	}
+	cipherText, err := b64.StdEncoding.DecodeString(string(fileContents))
+	if err != nil {
+		dief("Corrupt input file %s, failed at base64 decode. Reason: %s\n", path, err)
+	}
+	if _, _, err := crypto.ParseHeader(cipherText); err != nil {
+		dief("Corrupt input file %s. Reason: %s\n", path, err)
+	}
+	return cipherText
+}
+
+// unlockVault opens the encrypted config file with the secret returned by unlockSecret.
+// Returns the vault and the secret, which unlocked it.
+func unlockVault(path string, cipherText []byte) (*crypto.Vault, []byte) {
+	secret := unlockSecret(path, cipherText)
+	vault, _, err := crypto.Open(secret, cipherText)
+	if err != nil {
+		dief("Failed to decrypt %s. Reason: %s\n", path, err)
+	}
+	return vault, secret
+}
+
+// unlockSecret returns the contents of the keyfile passed by --keyfile, the private key of the identity, if it is
+// a recipient of the encrypted file, or asks for a password or recovery key
+func unlockSecret(path string, cipherText []byte) []byte {
+	var secret []byte
+	if unlockKeyfile != "" {
+		secret = readKeyfile(unlockKeyfile)
+	} else if identity := identityFor(cipherText); identity != "" {
+		id, err := decryptIdentity(identity)
+		if err != nil {
+			dief("Failed to unlock the identity %s. Reason: %s\n", identity, err)
+		}
+		secret = id.Secret()
+	} else {
+		fmt.Printf("Enter a password or recovery key of %s:\n", path)
+		var err error
+		if secret, err = term.ReadPassword(syscall.Stdin); err != nil {
+			die("Error reading the password from terminal. Try again.")
+		}
+	}
+	return secret
+}
+
+// readNewPassword asks for a new password twice, an empty password or a mismatch ends the program
+func readNewPassword(prompt string) []byte {
+	fmt.Println(prompt)
+	password, err := term.ReadPassword(syscall.Stdin)
+	if err != nil {
+		die("Error reading the password from terminal. Try again.")
+	}
+	if len(password) == 0 {
+		die(red("The password must not be empty, nothing was changed."))
+	}
+	fmt.Println("Repeat the password:")
+	repeated, err := term.ReadPassword(syscall.Stdin)
+	if err != nil {
+		die("Error reading the password from terminal. Try again.")
+	}
+	if string(password) != string(repeated) {
+		die(red("The passwords don't match, nothing was changed."))
+	}
+	return password
+}
+
+// readKeyfile returns the contents of the keyfile at path
+func readKeyfile(path string) []byte {
+	keyfile, err := ioutil.ReadFile(path)
+	if err != nil {
+		dief("Error reading the keyfile: %s\n", err)
+	}
+	return keyfile
+}
+
+// writeVault replaces the encrypted config file at path by the vault at once. A running daemon, which loaded the file,
+// reads it again, so it keeps the changed slots. The secret unlocks the file, in case it was converted to a data key.
+func writeVault(path string, vault *crypto.Vault, secret []byte) {
+	encoded := []byte(b64.StdEncoding.EncodeToString(vault.Bytes()))
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := files.WriteFileAtomic(path, encoded, perm); err != nil {
+		dief("Failed to write to %s: %s\n", path, err)
+	}
+
+	loadedPath := configFileInUse(path)
+	if loadedPath == "" {
+		return
+	}
+	uiService := services.NewUiService()
+	defer uiService.ShutDown()
+	if _, err := uiService.GetState(); err != nil {
+		// no daemon is running, it reads the file on start
+		return
+	}
+	if err := uiService.ReloadRekeyedFile(loadedPath, secret); err != nil {
+		fmt.Println(yellow("The daemon could not read the changed file: %s", err))
+		fmt.Println(yellow("Run 'jim reload' and unlock the vault again."))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(slotsCmd)
+	slotsCmd.AddCommand(slotsListCmd)
+	slotsCmd.AddCommand(slotsAddCmd)
+	slotsCmd.AddCommand(slotsRemoveCmd)
+	slotsAddCmd.AddCommand(slotsAddPasswordCmd)
+	slotsAddCmd.AddCommand(slotsAddKeyfileCmd)
+	slotsAddCmd.AddCommand(slotsAddRecoveryCmd)
+
+	slotsCmd.PersistentFlags().StringVar(&unlockKeyfile, "keyfile", "", "unlocks the file with the keyfile at given path instead of a password")
+	slotsCmd.PersistentFlags().StringVar(&unlockIdentity, "identity", "", "unlocks the file with the identity at given path")
+	slotsAddPasswordCmd.Flags().StringVar(&slotsKDF, "kdf", crypto.DefaultKDFParams.Algorithm.String(), "the function deriving the key from the password: "+strings.Join(crypto.KDFAlgorithms, ", "))
+	slotsAddPasswordCmd.Flags().BoolVar(&slotsBenchmark, "kdf-benchmark", false, "calibrates the parameters of the key derivation to this machine")
+	slotsAddPasswordCmd.Flags().DurationVar(&slotsTarget, "kdf-target", time.Second, "the time the key derivation should take with --kdf-benchmark")
+	slotsRemoveCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "removes the slot without asking for confirmation")
+}
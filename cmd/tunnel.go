@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/CryoCodec/jim/core/services"
+	"github.com/CryoCodec/jim/sshclient"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var localForwards []string
+var remoteForwards []string
+var tunnelTag string
+var stopAllTunnels bool
+
+// tunnelCmd represents the tunnel command
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "Manages port forwards, which are kept open by the daemon",
+	Long: `Manages port forwards, which are kept open by the daemon.
+Tunnels survive the jim command, which opened them. Broken connections are reestablished automatically.
+All tunnels are closed, when the vault is locked.`,
+}
+
+var tunnelUpCmd = &cobra.Command{
+	Use:   "up tag",
+	Short: "Opens port forwards through the server, whose tag matches the args the closest",
+	Long: `Opens port forwards through the server, whose tag matches the args the closest.
+Without -L and -R options, the forwards declared for the entry in the config file are opened.
+The options use the same syntax as ssh: [bind_address:]port:host:hostport
+
+Examples:
+  jim tunnel up Billing DB 1 -L 5432:localhost:5432
+  jim tunnel up Billing Web 1 -R 8080:localhost:3000`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		var forwards []domain.Forward
+		for _, spec := range localForwards {
+			forwards = append(forwards, parseForwardSpec(domain.LocalForward, spec))
+		}
+		for _, spec := range remoteForwards {
+			forwards = append(forwards, parseForwardSpec(domain.RemoteForward, spec))
+		}
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		err := runPreamble(uiService)
+		if err != nil {
+			dief("Received unexpected error: %s", err)
+		}
+
+		match, err := uiService.GetMatchingServer(strings.Join(args, " "))
+		if err != nil {
+			dief("Error: %s", err)
+		}
+
+		// the daemon can't ask whether to trust unknown host keys
+		if err := pinUnknownHostKeys(uiService, match); err != nil {
+			dief("Error: %s\n", err)
+		}
+
+		tunnels, err := uiService.StartTunnels(match.Tag, forwards)
+		if err != nil {
+			die(red("✗ failed to open the tunnels. Reason: %s", err))
+		}
+
+		printTunnels(tunnels)
+		for _, t := range tunnels {
+			if t.State != domain.TunnelUp {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+var tunnelDownCmd = &cobra.Command{
+	Use:   "down [id...]",
+	Short: "Closes tunnels",
+	Long:  `Closes the tunnels with the given ids, all tunnels of an entry with --tag or all tunnels with --all.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		var ids []int
+		for _, arg := range args {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				dief("Invalid tunnel id '%s', see 'jim tunnel ls' for the ids\n", arg)
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 && tunnelTag == "" && !stopAllTunnels {
+			die("Pass the ids of the tunnels to close, --tag or --all")
+		}
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		if !uiService.IsServerReady() {
+			die("No tunnels are open, the vault is locked.")
+		}
+
+		tag := ""
+		if tunnelTag != "" {
+			tag = matchTag(uiService, []string{tunnelTag})
+		}
+
+		stopped, err := uiService.StopTunnels(ids, tag, stopAllTunnels)
+		if err != nil {
+			die(err.Error())
+		}
+		if len(stopped) == 0 {
+			die("No matching tunnels are open.")
+		}
+		for _, t := range stopped {
+			fmt.Println(green("✓ closed tunnel %d to '%s': %s", t.ID, t.Tag, t.Forward))
+		}
+	},
+}
+
+var tunnelListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "Lists the open tunnels",
+	Long:    `Lists the open tunnels with their state, the number of forwarded connections and bytes and the last error.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initLogging()
+
+		uiService := services.NewUiService()
+		defer uiService.ShutDown()
+
+		if !uiService.IsServerReady() {
+			fmt.Println("No tunnels are open, the vault is locked.")
+			return
+		}
+
+		tunnels, err := uiService.GetTunnels()
+		if err != nil {
+			die(err.Error())
+		}
+		if len(tunnels) == 0 {
+			fmt.Println("No tunnels are open.")
+			return
+		}
+		printTunnels(tunnels)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+	tunnelCmd.AddCommand(tunnelUpCmd)
+	tunnelCmd.AddCommand(tunnelDownCmd)
+	tunnelCmd.AddCommand(tunnelListCmd)
+
+	tunnelUpCmd.Flags().StringArrayVarP(&localForwards, "local", "L", nil, "forwards a local port to an address reachable from the server, e.g. 5432:localhost:5432")
+	tunnelUpCmd.Flags().StringArrayVarP(&remoteForwards, "remote", "R", nil, "forwards a port on the server to an address reachable from this machine, e.g. 8080:localhost:3000")
+	tunnelDownCmd.Flags().StringVarP(&tunnelTag, "tag", "t", "", "closes all tunnels of the entry, whose tag matches the value the closest")
+	tunnelDownCmd.Flags().BoolVar(&stopAllTunnels, "all", false, "closes all tunnels")
+}
+
+// parseForwardSpec parses a forward in the format of ssh's -L and -R options: [bind_address:]port:host:hostport
+func parseForwardSpec(forwardType string, spec string) domain.Forward {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		dief("Invalid forward '%s', must be [bind_address:]port:host:hostport\n", spec)
+	}
+
+	n := len(parts)
+	forward := domain.Forward{
+		Type:   forwardType,
+		Listen: strings.Join(parts[:n-2], ":"),
+		Target: strings.Join(parts[n-2:], ":"),
+	}
+	if err := forward.Validate(); err != nil {
+		dief("Invalid forward '%s': %s\n", spec, err)
+	}
+	return forward
+}
+
+// pinUnknownHostKeys asks whether to trust the servers on the way to the match, that have no pinned host keys yet
+func pinUnknownHostKeys(uiService services.UiService, match *domain.Match) error {
+	unpinned := len(match.Server.HostKeys) == 0
+	for _, hop := range match.Jumps {
+		unpinned = unpinned || len(hop.Server.HostKeys) == 0
+	}
+	if !unpinned {
+		return nil
+	}
+
+	client, err := sshclient.Dial(match, trustOnFirstUse(uiService))
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+func printTunnels(tunnels []domain.Tunnel) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTAG\tFORWARD\tSTATE\tSINCE\tCONNECTIONS\tSENT\tRECEIVED\tLAST ERROR")
+	for _, t := range tunnels {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", t.ID, t.Tag, t.Forward, describeTunnelState(t.State),
+			time.Since(t.Since).Round(time.Second), t.Connections, formatBytes(t.BytesSent), formatBytes(t.BytesReceived),
+			strings.ReplaceAll(t.LastError, "\n", " "))
+	}
+	w.Flush()
+}
+
+func describeTunnelState(state int) string {
+	switch state {
+	case domain.TunnelUp:
+		return "up"
+	case domain.TunnelReconnecting:
+		return "reconnecting"
+	default:
+		return "connecting"
+	}
+}
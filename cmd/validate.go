@@ -3,13 +3,17 @@ package cmd
 import (
 	"fmt"
 	"github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/CryoCodec/jim/crypto"
 	"github.com/CryoCodec/jim/files"
+	"github.com/CryoCodec/jim/sshclient"
 	"github.com/fatih/color"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // validateCmd represents the validate command
@@ -17,7 +21,9 @@ var validateCmd = &cobra.Command{
 	Use:   "validate /path/to/file",
 	Short: "Checks whether the given file can be parsed as jim config.",
 	Long: `Checks whether the given file can be parsed as jim config. 
-	The file must be available in plain text. This operation does not work on the encrypted config file.`,
+	The file must be available in plain text. This operation does not work on the encrypted config file.
+	Config files may be written in json, yaml or toml. The format is determined by the file extension,
+	files without a known extension are inspected.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initLogging()
@@ -39,82 +45,352 @@ var validateCmd = &cobra.Command{
 		updateSpinnerPrefix(spinner, "Validating")
 		spinner.Start()
 
-		jimConf, err := config.UnmarshalJimConfig(fileContents)
+		format := config.FormatOf(args[0], fileContents)
+		jimConf, err := config.UnmarshalJimConfigFormat(fileContents, format)
 		if err != nil {
+			spinner.StopFail()
 			die(red("The given file could not be read as jim config, reason: %s", err))
 		}
 
 		var validationErrors []validationError
 		var messagesPerStep []string
 
-		messagesPerStep = append(messagesPerStep, yellow("Checking for invalid ports"))
+		messagesPerStep = append(messagesPerStep, yellow("Checking the version of the config format"))
+		if jimConf.Version < config.Version {
+			messagesPerStep = append(messagesPerStep, yellow("The file uses version %d of the config format, upgrade it to version %d with 'jim migrate %s'", jimConf.Version, config.Version, args[0]))
+		} else {
+			messagesPerStep = append(messagesPerStep, green("The file uses the current version %d", config.Version))
+		}
+
+		messagesPerStep = append(messagesPerStep, yellow("Checking against the schema"))
+		var schemaErrors []validationError
+		if jimConf.Version < config.Version {
+			messagesPerStep = append(messagesPerStep, yellow("Skipped, the schema describes version %d of the config format", config.Version))
+		} else if schemaErrors, err = validateSchema(&jimConf, fileContents, format); err != nil {
+			spinner.StopFail()
+			die(red("The given file could not be read as jim config, reason: %s", err))
+		} else if len(schemaErrors) != 0 {
+			validationErrors = append(validationErrors, schemaErrors...)
+			messagesPerStep = append(messagesPerStep, red("Found schema violations"))
+		} else {
+			messagesPerStep = append(messagesPerStep, green("The file matches the schema"))
+		}
 
-		duplicatesMap := make(map[string]int)
-		foundInvalidPorts := false
-		for _, el := range jimConf {
-			// checking for duplicated tags
-			duplicatesMap[el.Tag] += 1
+		entryMessages, entryErrors := checkEntries(&jimConf, nil)
+		messagesPerStep = append(messagesPerStep, entryMessages...)
+		validationErrors = append(validationErrors, entryErrors...)
 
-			// checking for invalid port numbers
-			port, err := strconv.Atoi(el.Server.Port)
-			if err != nil {
-				foundInvalidPorts = true
+		if len(validationErrors) != 0 {
+			spinner.StopFail()
+			printStepMessages(messagesPerStep)
+			fmt.Println()
+			printInvalidEntries(validationErrors)
+			os.Exit(1)
+		} else {
+			spinner.Stop()
+			printStepMessages(messagesPerStep)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+// checkEntries runs the checks of validate, which only depend on the parsed config, like ports, tags, aliases,
+// jump hosts, private keys, port forwards, environment variables and labels. It's used by import, before the entries
+// are encrypted. Jump hosts may also reference the names in externalNames, e.g. the tags and aliases of the entries in
+// the vault mapped to the tag of their entry, aliases must not clash with them.
+// Returns the messages of each step and the found errors.
+func checkEntries(jimConf *config.JimConfig, externalNames map[string]string) ([]string, []validationError) {
+	var validationErrors []validationError
+	var messagesPerStep []string
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking for invalid ports"))
+
+	duplicatesMap := make(map[string]int)
+	foundInvalidPorts := false
+	for _, el := range jimConf.Entries {
+		// checking for duplicated tags
+		duplicatesMap[el.Tag] += 1
+
+		// checking for invalid port numbers, which may be inherited from the defaults
+		resolved, _ := jimConf.Resolve(&el)
+		if resolved.Port < 1 || resolved.Port > 65535 {
+			foundInvalidPorts = true
+			validationErrors = append(validationErrors, validationError{
+				tag:    el.Tag,
+				reason: "The port must be a numeric value between 1 and 65535",
+			})
+		}
+	}
+
+	if foundInvalidPorts {
+		messagesPerStep = append(messagesPerStep, red("Found invalid ports"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All ports are valid"))
+	}
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking for duplicated tags and aliases"))
+	foundDuplicates := false
+	for tag, count := range duplicatesMap {
+		if count > 1 {
+			foundDuplicates = true
+			validationErrors = append(validationErrors, validationError{tag: tag, reason: "Tag is used more than once. Tags should be unique."})
+		}
+	}
+	aliasErrors := validateAliases(jimConf, externalNames)
+	if len(aliasErrors) != 0 {
+		foundDuplicates = true
+		validationErrors = append(validationErrors, aliasErrors...)
+	}
+
+	if foundDuplicates {
+		messagesPerStep = append(messagesPerStep, red("Found duplicated tags or aliases"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All tags and aliases are unique"))
+	}
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking jump hosts"))
+	jumpErrors := validateJumpHosts(*jimConf, externalNames)
+	if len(jumpErrors) != 0 {
+		validationErrors = append(validationErrors, jumpErrors...)
+		messagesPerStep = append(messagesPerStep, red("Found invalid jump hosts"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All jump hosts are valid"))
+	}
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking private keys"))
+	keyErrors := validatePrivateKeys(jimConf)
+	if len(keyErrors) != 0 {
+		validationErrors = append(validationErrors, keyErrors...)
+		messagesPerStep = append(messagesPerStep, red("Found invalid private keys"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All private keys are valid"))
+	}
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking port forwards"))
+	forwardErrors := validateForwards(jimConf)
+	if len(forwardErrors) != 0 {
+		validationErrors = append(validationErrors, forwardErrors...)
+		messagesPerStep = append(messagesPerStep, red("Found invalid port forwards"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All port forwards are valid"))
+	}
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking environment variables"))
+	envErrors := validateEnvNames(jimConf)
+	if len(envErrors) != 0 {
+		validationErrors = append(validationErrors, envErrors...)
+		messagesPerStep = append(messagesPerStep, red("Found invalid environment variables"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All environment variables are valid"))
+	}
+
+	messagesPerStep = append(messagesPerStep, yellow("Checking labels"))
+	labelErrors := validateLabelNames(jimConf)
+	if len(labelErrors) != 0 {
+		validationErrors = append(validationErrors, labelErrors...)
+		messagesPerStep = append(messagesPerStep, red("Found invalid labels"))
+	} else {
+		messagesPerStep = append(messagesPerStep, green("All labels are valid"))
+	}
+	return messagesPerStep, validationErrors
+}
+
+// validateSchema checks the config file against the JSON Schema of the current version.
+// Violations within an entry are reported with the tag of the entry.
+func validateSchema(jimConf *config.JimConfig, fileContents []byte, format config.Format) ([]validationError, error) {
+	violations, err := config.ValidateSchema(fileContents, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var validationErrors []validationError
+	for _, violation := range violations {
+		e := validationError{pointer: violation.Pointer, reason: violation.Msg}
+		if tokens := strings.Split(violation.Pointer, "/"); len(tokens) > 2 && tokens[1] == "entries" {
+			if i, err := strconv.Atoi(tokens[2]); err == nil && i < len(jimConf.Entries) {
+				e.tag = jimConf.Entries[i].Tag
+			}
+		}
+		validationErrors = append(validationErrors, e)
+	}
+	return validationErrors, nil
+}
+
+// validatePrivateKeys checks, that all referenced keys exist and can be decrypted with their passphrase
+func validatePrivateKeys(jimConf *config.JimConfig) []validationError {
+	var validationErrors []validationError
+	for _, el := range jimConf.Entries {
+		resolved, _ := jimConf.Resolve(&el)
+		keyPem, passphrase, ok := jimConf.PrivateKeyOf(&el, &resolved)
+		if !ok {
+			validationErrors = append(validationErrors, validationError{
+				tag:    el.Tag,
+				reason: fmt.Sprintf("The referenced key '%s' does not exist", resolved.KeyRef),
+			})
+			continue
+		}
+		if keyPem == "" {
+			continue
+		}
+
+		if _, err := crypto.DecryptPrivateKey([]byte(keyPem), []byte(passphrase)); err != nil {
+			validationErrors = append(validationErrors, validationError{
+				tag:    el.Tag,
+				reason: fmt.Sprintf("The private key can't be read: %s", err),
+			})
+		}
+	}
+	return validationErrors
+}
+
+// validateForwards checks the type and addresses of all declared port forwards, including the inherited ones
+func validateForwards(jimConf *config.JimConfig) []validationError {
+	var validationErrors []validationError
+	for _, el := range jimConf.Entries {
+		resolved, _ := jimConf.Resolve(&el)
+		for _, f := range resolved.Forwards {
+			forward := domain.Forward{Type: f.Type, Listen: f.Listen, Target: f.Target}
+			if err := forward.Validate(); err != nil {
 				validationErrors = append(validationErrors, validationError{
 					tag:    el.Tag,
-					reason: "The port must be a numeric value between 0 and 65535",
+					reason: fmt.Sprintf("Invalid port forward: %s", err),
 				})
 			}
+		}
+	}
+	return validationErrors
+}
 
-			if port < 0 || port > 65535 {
-				foundInvalidPorts = true
+// validateEnvNames checks the names of the environment variables of all entries, including the inherited ones
+func validateEnvNames(jimConf *config.JimConfig) []validationError {
+	var validationErrors []validationError
+	for _, el := range jimConf.Entries {
+		resolved, _ := jimConf.Resolve(&el)
+		for name := range resolved.Env {
+			if !sshclient.IsValidEnvName(name) {
 				validationErrors = append(validationErrors, validationError{
 					tag:    el.Tag,
-					reason: "The port must be a numeric value between 0 and 65535",
+					reason: fmt.Sprintf("The environment variable '%s' has an invalid name", name),
 				})
 			}
 		}
+	}
+	return validationErrors
+}
 
-		if foundInvalidPorts {
-			messagesPerStep = append(messagesPerStep, red("Found invalid ports"))
-		} else {
-			messagesPerStep = append(messagesPerStep, green("All ports are valid"))
+// validateAliases checks, that no alias is used as tag or alias by another entry, including the names in externalNames
+func validateAliases(jimConf *config.JimConfig, externalNames map[string]string) []validationError {
+	names := make(map[string]string)
+	for _, el := range jimConf.Entries {
+		names[el.Tag] = el.Tag
+	}
+
+	var validationErrors []validationError
+	for _, el := range jimConf.Entries {
+		for _, alias := range el.Aliases {
+			owner, ok := names[alias]
+			if !ok {
+				// an entry, which is imported again, keeps its existing aliases
+				owner, ok = externalNames[alias]
+				ok = ok && owner != el.Tag
+			}
+			if ok {
+				validationErrors = append(validationErrors, validationError{
+					tag:    el.Tag,
+					reason: fmt.Sprintf("The alias '%s' is already used by the entry '%s'", alias, owner),
+				})
+				continue
+			}
+			names[alias] = el.Tag
 		}
+	}
+	return validationErrors
+}
 
-		messagesPerStep = append(messagesPerStep, yellow("Checking for duplicated tags"))
-		foundDuplicates := false
-		for tag, count := range duplicatesMap {
-			if count > 1 {
-				foundDuplicates = true
-				validationErrors = append(validationErrors, validationError{tag: tag, reason: "Tag is used more than once. Tags should be unique."})
+// validateLabelNames checks, that the names of all labels can be used as filter category
+func validateLabelNames(jimConf *config.JimConfig) []validationError {
+	var validationErrors []validationError
+	for _, el := range jimConf.Entries {
+		for _, name := range sortedKeys(el.Labels) {
+			if !domain.IsValidLabelName(name) {
+				validationErrors = append(validationErrors, validationError{
+					tag:    el.Tag,
+					reason: fmt.Sprintf("The label '%s' has an invalid name, use letters, digits, '-' and '_', except group, env, host and tag", name),
+				})
 			}
 		}
+	}
+	return validationErrors
+}
 
-		if foundDuplicates {
-			messagesPerStep = append(messagesPerStep, red("Found duplicated tags"))
-		} else {
-			messagesPerStep = append(messagesPerStep, green("All tags are unique"))
+// validateJumpHosts checks, that all referenced jump hosts exist and don't form a cycle.
+// Jump hosts may reference the entries of the config by tag or alias and the names in externalNames.
+func validateJumpHosts(jimConf config.JimConfig, externalNames map[string]string) []validationError {
+	tagOf := make(map[string]string)
+	for _, el := range jimConf.Entries {
+		for _, alias := range el.Aliases {
+			tagOf[alias] = el.Tag
+		}
+	}
+
+	jumps := make(map[string][]string)
+	for _, el := range jimConf.Entries {
+		resolved, _ := jimConf.Resolve(&el)
+		jumps[el.Tag] = make([]string, len(resolved.Jump))
+		for i, jump := range resolved.Jump {
+			if tag, ok := tagOf[jump]; ok {
+				jump = tag
+			}
+			jumps[el.Tag][i] = jump
 		}
+	}
 
-		if foundDuplicates || foundInvalidPorts {
-			spinner.StopFail()
-			printStepMessages(messagesPerStep)
-			fmt.Println()
-			printInvalidEntries(validationErrors)
-			os.Exit(1)
-		} else {
-			spinner.Stop()
-			printStepMessages(messagesPerStep)
+	var validationErrors []validationError
+	for _, el := range jimConf.Entries {
+		for _, jump := range jumps[el.Tag] {
+			_, external := externalNames[jump]
+			if _, ok := jumps[jump]; !ok && !external {
+				validationErrors = append(validationErrors, validationError{
+					tag:    el.Tag,
+					reason: fmt.Sprintf("The jump host '%s' does not exist", jump),
+				})
+			}
 		}
-	},
+
+		if leadsToCycle(el.Tag, el.Tag, jumps, map[string]bool{}) {
+			validationErrors = append(validationErrors, validationError{
+				tag:    el.Tag,
+				reason: "The jump hosts lead to a cycle",
+			})
+		}
+	}
+	return validationErrors
 }
 
-func init() {
-	rootCmd.AddCommand(validateCmd)
+func leadsToCycle(start string, current string, jumps map[string][]string, visited map[string]bool) bool {
+	for _, jump := range jumps[current] {
+		if jump == start {
+			return true
+		}
+		if visited[jump] {
+			continue
+		}
+		visited[jump] = true
+		if leadsToCycle(start, jump, jumps, visited) {
+			return true
+		}
+	}
+	return false
 }
 
 type validationError struct {
-	tag    string
-	reason string
+	tag string
+	// pointer locates the error in the config file as JSON pointer, if it's known
+	pointer string
+	reason  string
 }
 
 func printInvalidEntries(validationErrors []validationError) {
@@ -122,7 +398,12 @@ func printInvalidEntries(validationErrors []validationError) {
 	c.Println("These errors were found: ")
 
 	for _, err := range validationErrors {
-		fmt.Printf("Tag: %s\n", err.tag)
+		if err.tag != "" {
+			fmt.Printf("Tag: %s\n", err.tag)
+		}
+		if err.pointer != "" {
+			fmt.Printf("Location: %s\n", err.pointer)
+		}
 		fmt.Printf("Reason: %s\n", err.reason)
 		fmt.Println()
 	}
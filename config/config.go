@@ -13,3 +13,8 @@ const (
 func GetSocketAddress() string {
 	return filepath.Join(files.GetJimConfigDir(), "socket")
 }
+
+// GetAgentSocketAddress returns the address of the UDS socket, where jim serves the ssh-agent protocol
+func GetAgentSocketAddress() string {
+	return filepath.Join(files.GetJimConfigDir(), "agent.socket")
+}
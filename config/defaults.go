@@ -0,0 +1,120 @@
+package config
+
+import "fmt"
+
+// JimDefaults holds values, which entries inherit unless they set them themselves.
+// All settings of an entry except host and host_keys may be declared as default.
+// The most specific level wins: the entry, its group and env, its group and finally the global defaults.
+type JimDefaults struct {
+	// Global holds defaults for all entries
+	Global *JimConfigEntry `json:"global,omitempty" toml:"global,omitempty"`
+	// Groups holds defaults per group name
+	Groups map[string]JimConfigEntry `json:"groups,omitempty" toml:"groups,omitempty"`
+	// GroupEnvs holds defaults per group name and env
+	GroupEnvs map[string]map[string]JimConfigEntry `json:"group_envs,omitempty" toml:"group_envs,omitempty"`
+}
+
+// SourceEntry marks values, which are set by the entry itself
+const SourceEntry = "entry"
+
+// DefaultPort is the port of entries, which neither set a port themselves nor inherit one
+const DefaultPort = 22
+
+// Resolve returns the effective settings of the element with the defaults applied.
+// The returned map tells for every set value, where it was taken from, keyed by the name of the setting
+// in the config file. Environment variables are merged across all levels and keyed by env.NAME.
+// Elements of a merged config inherit the defaults of the config declaring them only.
+func (r *JimConfig) Resolve(el *JimConfigElement) (JimConfigEntry, map[string]string) {
+	resolved := JimConfigEntry{
+		Host:     el.Server.Host,
+		HostKeys: el.Server.HostKeys,
+		Env:      make(map[string]string),
+	}
+	sources := map[string]string{"host": SourceEntry}
+
+	defaults := r.Defaults
+	if r.scopes != nil {
+		defaults = r.scopes[r.scopeOf[el.Tag]].defaults
+	}
+	if defaults != nil {
+		if defaults.Global != nil {
+			inherit(&resolved, defaults.Global, "global defaults", sources)
+		}
+		if group, ok := defaults.Groups[el.Group]; ok {
+			inherit(&resolved, &group, fmt.Sprintf("defaults of group '%s'", el.Group), sources)
+		}
+		if groupEnv, ok := defaults.GroupEnvs[el.Group][el.Env]; ok {
+			inherit(&resolved, &groupEnv, fmt.Sprintf("defaults of group '%s' and env '%s'", el.Group, el.Env), sources)
+		}
+	}
+	inherit(&resolved, &el.Server, SourceEntry, sources)
+	if resolved.Port == 0 {
+		resolved.Port = DefaultPort
+		sources["port"] = "the default ssh port"
+	}
+
+	// a jump host inheriting the jump hosts of its group must not jump through itself
+	if sources["jump"] != SourceEntry {
+		var jump []string
+		for _, tag := range resolved.Jump {
+			if tag != el.Tag {
+				jump = append(jump, tag)
+			}
+		}
+		resolved.Jump = jump
+		if len(jump) == 0 {
+			delete(sources, "jump")
+		}
+	}
+	return resolved, sources
+}
+
+// inherit copies all values set in src to dst, except host and host keys, and records their source.
+func inherit(dst *JimConfigEntry, src *JimConfigEntry, source string, sources map[string]string) {
+	setString := func(name string, dst *string, value string) {
+		if value != "" {
+			*dst = value
+			sources[name] = source
+		}
+	}
+
+	setString("dir", &dst.Dir, src.Dir)
+	if src.Port != 0 {
+		dst.Port = src.Port
+		sources["port"] = source
+	}
+	setString("username", &dst.Username, src.Username)
+	setString("password", &dst.Password, src.Password)
+	// an inline key and a key reference replace each other
+	if src.PrivateKey != "" {
+		dst.KeyRef = ""
+		delete(sources, "key_ref")
+	}
+	if src.KeyRef != "" {
+		dst.PrivateKey = ""
+		delete(sources, "private_key")
+	}
+	setString("private_key", &dst.PrivateKey, src.PrivateKey)
+	setString("key_ref", &dst.KeyRef, src.KeyRef)
+	setString("passphrase", &dst.Passphrase, src.Passphrase)
+	setString("shell", &dst.Shell, src.Shell)
+	setString("startup_command", &dst.StartupCommand, src.StartupCommand)
+
+	if len(src.Jump) != 0 {
+		dst.Jump = src.Jump
+		sources["jump"] = source
+	}
+	if len(src.Forwards) != 0 {
+		dst.Forwards = src.Forwards
+		sources["forwards"] = source
+	}
+	// false can't be told apart from unset, so recording can't be disabled again by a more specific level
+	if src.Record {
+		dst.Record = true
+		sources["record"] = source
+	}
+	for name, value := range src.Env {
+		dst.Env[name] = value
+		sources["env."+name] = source
+	}
+}
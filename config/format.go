@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pkg/errors"
+)
+
+// Format is the syntax of a plain text config file
+type Format int
+
+const (
+	JSON Format = iota
+	YAML
+	TOML
+)
+
+func (f Format) String() string {
+	switch f {
+	case YAML:
+		return "yaml"
+	case TOML:
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+var (
+	tomlTableHeader = regexp.MustCompile(`^\[\[?\s*[A-Za-z0-9_."' -]+\s*\]\]?\s*(#.*)?$`)
+	tomlKeyValue    = regexp.MustCompile(`^([A-Za-z0-9_-]+|"[^"]*"|'[^']*')(\s*\.\s*([A-Za-z0-9_-]+|"[^"]*"|'[^']*'))*\s*=`)
+	yamlErrorPrefix = regexp.MustCompile(`^\[(\d+):(\d+)\]\s*`)
+)
+
+// FormatOf returns the format of the config file at path. The extensions .json, .yaml, .yml and .toml
+// determine the format, otherwise it's detected from the contents.
+func FormatOf(path string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	case ".toml":
+		return TOML
+	default:
+		return DetectFormat(data)
+	}
+}
+
+// DetectFormat guesses the format of a config file from its first significant line.
+// Objects and lists are json, table headers and key = value pairs are toml, everything else is yaml.
+func DetectFormat(data []byte) Format {
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case tomlTableHeader.MatchString(line) || tomlKeyValue.MatchString(line):
+			return TOML
+		case strings.HasPrefix(line, "{") || strings.HasPrefix(line, "["):
+			return JSON
+		default:
+			return YAML
+		}
+	}
+	return JSON
+}
+
+// ParseError is returned, when a config file can't be parsed. Line and Column are 1-based,
+// they are 0 if the parser doesn't provide the position.
+type ParseError struct {
+	Format Format
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Format, e.Msg)
+	}
+	return fmt.Sprintf("%s: line %d, column %d: %s", e.Format, e.Line, e.Column, e.Msg)
+}
+
+// UnmarshalJimConfigFormat parses given byte[] in the given format to a JimConfig struct.
+// Config files of older versions are upgraded while parsing, the version of the file is kept in JimConfig.Version.
+func UnmarshalJimConfigFormat(data []byte, format Format) (JimConfig, error) {
+	r, _, err := unmarshalVersioned(data, format)
+	return r, err
+}
+
+// unmarshalDocument parses a config file of the current version
+func unmarshalDocument(data []byte, format Format) (JimConfig, error) {
+	var r JimConfig
+	switch format {
+	case YAML:
+		if err := yaml.Unmarshal(data, &r); err != nil {
+			return r, yamlParseError(err)
+		}
+	case TOML:
+		if err := toml.Unmarshal(data, &r); err != nil {
+			return r, tomlParseError(err)
+		}
+	default:
+		if err := json.Unmarshal(data, &r); err != nil {
+			return r, jsonParseError(data, err)
+		}
+	}
+	return r, nil
+}
+
+// MarshalFormat serializes a JimConfig struct to the given format, always using the current version.
+func (r *JimConfig) MarshalFormat(format Format) ([]byte, error) {
+	current := *r
+	current.Version = Version
+	switch format {
+	case YAML:
+		return yaml.Marshal(&current)
+	case TOML:
+		return toml.Marshal(&current)
+	default:
+		return json.Marshal(&current)
+	}
+}
+
+func jsonParseError(data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return &ParseError{Format: JSON, Msg: strings.TrimPrefix(err.Error(), "json: ")}
+	}
+	// the offset points behind the offending byte
+	offset--
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	line, column := 1, 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &ParseError{Format: JSON, Line: line, Column: column, Msg: strings.TrimPrefix(err.Error(), "json: ")}
+}
+
+func yamlParseError(err error) error {
+	// without colors and source, errors are formatted as "[line:column] message"
+	msg := yaml.FormatError(err, false, false)
+	match := yamlErrorPrefix.FindStringSubmatch(msg)
+	if match == nil {
+		return &ParseError{Format: YAML, Msg: msg}
+	}
+	line, _ := strconv.Atoi(match[1])
+	column, _ := strconv.Atoi(match[2])
+	return &ParseError{Format: YAML, Line: line, Column: column, Msg: strings.TrimSpace(msg[len(match[0]):])}
+}
+
+func tomlParseError(err error) error {
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, column := decodeErr.Position()
+		return &ParseError{Format: TOML, Line: line, Column: column, Msg: strings.TrimPrefix(decodeErr.Error(), "toml: ")}
+	}
+	return &ParseError{Format: TOML, Msg: strings.TrimPrefix(err.Error(), "toml: ")}
+}
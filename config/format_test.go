@@ -0,0 +1,160 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Format
+	}{
+		{"empty", "", JSON},
+		{"object", `{"version": 2}`, JSON},
+		{"plain list", "[\n  {\"tag\": \"a\"}\n]", JSON},
+		{"json after comments", "# comment\n\n{}", JSON},
+		{"byte order mark", "\xef\xbb\xbf{}", JSON},
+		{"yaml", "version: 2\nentries: []", YAML},
+		{"yaml list", "- group: a\n  tag: b", YAML},
+		{"yaml document start", "---\nversion: 2", YAML},
+		{"toml key value", "version = 2", TOML},
+		{"toml table", "# comment\n[defaults.global]\nport = 22", TOML},
+		{"toml array of tables", "[[entries]]\ntag = \"a\"", TOML},
+		{"toml quoted key", "\"$schema\" = \"x\"", TOML},
+		{"toml dotted key", "defaults.'global'.port = 22", TOML},
+		{"yaml with equals sign", "startup: a = b", YAML},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectFormat([]byte(test.data)); got != test.want {
+				t.Errorf("DetectFormat(%q) = %s, want %s", test.data, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]Format{
+		"config.json":  JSON,
+		"config.YAML":  YAML,
+		"config.yml":   YAML,
+		"config.toml":  TOML,
+		"config":       TOML,
+		"config.conf":  TOML,
+		"inventory.md": TOML,
+	}
+	for path, want := range tests {
+		// the contents only decide for unknown extensions
+		if got := FormatOf(path, []byte("version = 2")); got != want {
+			t.Errorf("FormatOf(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestUnmarshalFixturesAgree(t *testing.T) {
+	var configs []JimConfig
+	for _, name := range []string{"inventory.json", "inventory.yaml", "inventory.toml"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := UnmarshalJimConfigFormat(data, FormatOf(name, data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		configs = append(configs, config)
+	}
+
+	json := configs[0]
+	if len(json.Entries) != 2 || json.Entries[0].Server.KeyRef != "deploy" || json.Entries[1].Server.Port != 22 {
+		t.Fatalf("unexpected config %+v", json)
+	}
+	for i, name := range []string{"yaml", "toml"} {
+		if !reflect.DeepEqual(json, configs[i+1]) {
+			t.Errorf("the %s fixture differs from the json fixture:\n%+v\n%+v", name, configs[i+1], json)
+		}
+	}
+}
+
+func TestMarshalFormatRoundTrip(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "inventory.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := UnmarshalJimConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []Format{JSON, YAML, TOML} {
+		encoded, err := original.MarshalFormat(format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		if detected := DetectFormat(encoded); detected != format {
+			t.Errorf("%s is detected as %s", format, detected)
+		}
+		decoded, err := UnmarshalJimConfigFormat(encoded, format)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		if !reflect.DeepEqual(original, decoded) {
+			t.Errorf("%s round trip differs:\n%+v\n%+v", format, decoded, original)
+		}
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		line   int
+	}{
+		{"json syntax", JSON, "{\n  \"version\": 2,\n  \"entries\": [,]\n}", 3},
+		{"json type", JSON, "{\n  \"version\": 2,\n  \"entries\": [{\"tag\": 1}]\n}", 3},
+		{"yaml", YAML, "version: 2\nentries:\n  - tag: a\n    group: b\n      env: c\n", 4},
+		{"toml", TOML, "version = 2\n\n[[entries]]\ntag = \n", 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := UnmarshalJimConfigFormat([]byte(test.data), test.format)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Format != test.format {
+				t.Errorf("format %s, want %s", parseErr.Format, test.format)
+			}
+			if parseErr.Line != test.line {
+				t.Errorf("line %d, want %d: %s", parseErr.Line, test.line, parseErr)
+			}
+			if parseErr.Column < 1 {
+				t.Errorf("column %d, want a position: %s", parseErr.Column, parseErr)
+			}
+		})
+	}
+}
+
+func TestParseErrorWithoutPosition(t *testing.T) {
+	err := &ParseError{Format: YAML, Msg: "broken"}
+	if err.Error() != "yaml: broken" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	err = &ParseError{Format: TOML, Line: 2, Column: 5, Msg: "broken"}
+	if err.Error() != "toml: line 2, column 5: broken" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	_, err := UnmarshalJimConfig([]byte(`{"version": 99, "entries": []}`))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+// EntryOrigin locates a merged entry in the configs it was merged from
+type EntryOrigin struct {
+	// Config is the index of the config declaring the entry
+	Config int
+	// Index is the position of the entry within the entries of its config
+	Index int
+}
+
+// Origins tells, where the parts of a merged config were taken from
+type Origins struct {
+	// Entries holds the origin of every merged entry, in the order of the merged entries
+	Entries []EntryOrigin
+	// Recording is the index of the config, whose recording section was used, or -1 if there is none
+	Recording int
+}
+
+// Conflict describes a tag, which is declared by more than one config
+type Conflict struct {
+	Tag string
+	// Configs lists the indices of the configs declaring the tag. The entry of the first one is used.
+	Configs []int
+}
+
+// scope holds the keys and defaults of one of the merged configs. The entries of a config inherit its defaults
+// and reference its keys only, e.g. entries of a personal config don't inherit the password of a team config.
+type scope struct {
+	keys     []JimKey
+	defaults *JimDefaults
+}
+
+// Merge merges the configs into one, the first config takes precedence over the following ones.
+// Entries are merged by tag, tags declared by multiple configs are reported as conflicts.
+// Keys are merged by name, the entries of the merged config still resolve defaults and key references
+// within the config declaring them. The recording section is taken from the first config declaring one.
+func Merge(configs []JimConfig) (JimConfig, Origins, []Conflict) {
+	merged := JimConfig{scopeOf: make(map[string]int)}
+	origins := Origins{Recording: -1}
+
+	declaredBy := make(map[string]int)
+	conflictIndex := make(map[string]int)
+	var conflicts []Conflict
+	keyNames := make(map[string]bool)
+
+	for i := range configs {
+		config := &configs[i]
+
+		for j, el := range config.Entries {
+			first, declared := declaredBy[el.Tag]
+			if declared && first != i {
+				if index, ok := conflictIndex[el.Tag]; ok {
+					if last := conflicts[index].Configs; last[len(last)-1] != i {
+						conflicts[index].Configs = append(last, i)
+					}
+				} else {
+					conflictIndex[el.Tag] = len(conflicts)
+					conflicts = append(conflicts, Conflict{Tag: el.Tag, Configs: []int{first, i}})
+				}
+				continue
+			}
+			declaredBy[el.Tag] = i
+			merged.scopeOf[el.Tag] = i
+			merged.Entries = append(merged.Entries, el)
+			origins.Entries = append(origins.Entries, EntryOrigin{Config: i, Index: j})
+		}
+
+		for _, key := range config.Keys {
+			if !keyNames[key.Name] {
+				keyNames[key.Name] = true
+				merged.Keys = append(merged.Keys, key)
+			}
+		}
+
+		if config.Recording != nil && merged.Recording == nil {
+			recording := *config.Recording
+			merged.Recording = &recording
+			origins.Recording = i
+		}
+
+		merged.scopes = append(merged.scopes, scope{keys: config.Keys, defaults: config.Defaults})
+	}
+	return merged, origins, conflicts
+}
+
+// Split writes the modifications of a merged config back to copies of the configs it was merged from.
+// Entries are written back to the config they were taken from, entries added to the merged config are added to the first config.
+// Keys added to the merged config are added to the configs of the entries referencing them, or to the first config.
+// The recording section is written back as well, existing keys and defaults are left untouched.
+// Entries must not be removed from or reordered within the merged config.
+func Split(merged *JimConfig, configs []JimConfig, origins Origins) []JimConfig {
+	result := make([]JimConfig, len(configs))
+	for i, config := range configs {
+		result[i] = config
+		result[i].Entries = append([]JimConfigElement(nil), config.Entries...)
+	}
+
+	for i, el := range merged.Entries {
+		if i < len(origins.Entries) {
+			origin := origins.Entries[i]
+			result[origin.Config].Entries[origin.Index] = el
+		} else if len(result) != 0 {
+			result[0].Entries = append(result[0].Entries, el)
+		}
+	}
+
+	keyNames := make(map[string]bool)
+	for _, config := range configs {
+		for _, key := range config.Keys {
+			keyNames[key.Name] = true
+		}
+	}
+	for _, key := range merged.Keys {
+		if keyNames[key.Name] || len(result) == 0 {
+			continue
+		}
+		targets := make(map[int]bool)
+		for i := range merged.Entries {
+			if resolved, _ := merged.Resolve(&merged.Entries[i]); resolved.KeyRef == key.Name {
+				target := 0
+				if i < len(origins.Entries) {
+					target = origins.Entries[i].Config
+				}
+				targets[target] = true
+			}
+		}
+		if len(targets) == 0 {
+			targets[0] = true
+		}
+		for i := range result {
+			if targets[i] {
+				result[i].Keys = append(append([]JimKey(nil), result[i].Keys...), key)
+			}
+		}
+	}
+
+	if merged.Recording != nil && len(result) != 0 {
+		target := origins.Recording
+		if target < 0 {
+			target = 0
+		}
+		recording := *merged.Recording
+		result[target].Recording = &recording
+	}
+	return result
+}
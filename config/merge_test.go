@@ -0,0 +1,149 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func personalAndTeam() []JimConfig {
+	personal := JimConfig{
+		Version: Version,
+		Keys:    []JimKey{{Name: "shared", PrivateKey: "personal-key"}},
+		Entries: []JimConfigElement{
+			{Group: "web", Env: "prod", Tag: "mine", Server: JimConfigEntry{Host: "mine.example.com"}},
+			{Group: "web", Env: "prod", Tag: "own-key", Server: JimConfigEntry{Host: "own.example.com", KeyRef: "shared"}},
+			{Group: "web", Env: "prod", Tag: "team-key", Server: JimConfigEntry{Host: "other.example.com", KeyRef: "deploy"}},
+		},
+	}
+	team := JimConfig{
+		Version: Version,
+		Keys: []JimKey{
+			{Name: "shared", PrivateKey: "team-key"},
+			{Name: "deploy", PrivateKey: "deploy-key"},
+		},
+		Defaults: &JimDefaults{
+			Global: &JimConfigEntry{Port: 2222},
+			Groups: map[string]JimConfigEntry{"web": {Username: "deploy", Password: "team-secret"}},
+		},
+		Entries: []JimConfigElement{
+			{Group: "web", Env: "prod", Tag: "team", Server: JimConfigEntry{Host: "team.example.com", KeyRef: "shared"}},
+			{Group: "web", Env: "prod", Tag: "mine", Server: JimConfigEntry{Host: "shadowed.example.com"}},
+		},
+	}
+	return []JimConfig{personal, team}
+}
+
+func findEntry(t *testing.T, config *JimConfig, tag string) *JimConfigElement {
+	t.Helper()
+	for i := range config.Entries {
+		if config.Entries[i].Tag == tag {
+			return &config.Entries[i]
+		}
+	}
+	t.Fatalf("the merged config lacks the entry %s", tag)
+	return nil
+}
+
+func TestMergeConflicts(t *testing.T) {
+	merged, origins, conflicts := Merge(personalAndTeam())
+
+	if want := []Conflict{{Tag: "mine", Configs: []int{0, 1}}}; !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+	if got := findEntry(t, &merged, "mine").Server.Host; got != "mine.example.com" {
+		t.Errorf("the entry of the first config should win, got host %s", got)
+	}
+	want := []EntryOrigin{{0, 0}, {0, 1}, {0, 2}, {1, 0}}
+	if !reflect.DeepEqual(origins.Entries, want) {
+		t.Errorf("origins = %v, want %v", origins.Entries, want)
+	}
+}
+
+func TestMergeResolvesDefaultsPerConfig(t *testing.T) {
+	merged, _, _ := Merge(personalAndTeam())
+
+	mine, _ := merged.Resolve(findEntry(t, &merged, "mine"))
+	if mine.Password != "" || mine.Username != "" || mine.Port != DefaultPort {
+		t.Errorf("the personal entry inherited the team defaults: %+v", mine)
+	}
+
+	team, sources := merged.Resolve(findEntry(t, &merged, "team"))
+	if team.Password != "team-secret" || team.Username != "deploy" || team.Port != 2222 {
+		t.Errorf("the team entry lacks the team defaults: %+v", team)
+	}
+	if sources["password"] != "defaults of group 'web'" {
+		t.Errorf("password source = %q", sources["password"])
+	}
+}
+
+func TestMergeResolvesKeysPerConfig(t *testing.T) {
+	merged, _, _ := Merge(personalAndTeam())
+
+	tests := []struct {
+		tag  string
+		key  string
+		want bool
+	}{
+		{"own-key", "personal-key", true},
+		{"team", "team-key", true},
+		{"team-key", "", false},
+	}
+	for _, test := range tests {
+		el := findEntry(t, &merged, test.tag)
+		resolved, _ := merged.Resolve(el)
+		key, _, ok := merged.PrivateKeyOf(el, &resolved)
+		if ok != test.want || key != test.key {
+			t.Errorf("PrivateKeyOf(%s) = %q, %v, want %q, %v", test.tag, key, ok, test.key, test.want)
+		}
+	}
+}
+
+func TestSplitAddsKeysToReferencingConfigs(t *testing.T) {
+	configs := personalAndTeam()
+	merged, origins, _ := Merge(configs)
+
+	merged.Keys = append(merged.Keys, JimKey{Name: "added", PrivateKey: "added-key"}, JimKey{Name: "unused", PrivateKey: "unused-key"})
+	findEntry(t, &merged, "team").Server.KeyRef = "added"
+	el := findEntry(t, &merged, "team")
+	resolved, _ := merged.Resolve(el)
+	if key, _, ok := merged.PrivateKeyOf(el, &resolved); !ok || key != "added-key" {
+		t.Errorf("the added key is not visible before the split, got %q, %v", key, ok)
+	}
+
+	split := Split(&merged, configs, origins)
+	keyNames := func(config JimConfig) []string {
+		var names []string
+		for _, key := range config.Keys {
+			names = append(names, key.Name)
+		}
+		return names
+	}
+	if got, want := keyNames(split[0]), []string{"shared", "unused"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys of the first config = %v, want %v", got, want)
+	}
+	if got, want := keyNames(split[1]), []string{"shared", "deploy", "added"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys of the second config = %v, want %v", got, want)
+	}
+	if len(configs[1].Keys) != 2 {
+		t.Errorf("Split modified the keys of the original config")
+	}
+}
+
+func TestSplitAddsEntriesToFirstConfig(t *testing.T) {
+	configs := personalAndTeam()
+	merged, origins, _ := Merge(configs)
+
+	merged.Entries = append(merged.Entries, JimConfigElement{Group: "web", Env: "dev", Tag: "new", Server: JimConfigEntry{Host: "new.example.com"}})
+	findEntry(t, &merged, "team").Server.Dir = "/srv"
+
+	split := Split(&merged, configs, origins)
+	if n := len(split[0].Entries); n != 4 || split[0].Entries[3].Tag != "new" {
+		t.Errorf("the added entry is missing in the first config: %v", split[0].Entries)
+	}
+	if split[1].Entries[0].Server.Dir != "/srv" {
+		t.Errorf("the modification of the team entry is not written back")
+	}
+	if configs[1].Entries[0].Server.Dir != "" {
+		t.Errorf("Split modified the entries of the original config")
+	}
+}
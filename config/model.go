@@ -1,35 +1,177 @@
 package config
 
-import "encoding/json"
+import (
+	"strings"
+)
 
-// JimConfig is a type alias for a list of config elements
-type JimConfig []JimConfigElement
+// JimConfig is the root of the config file
+type JimConfig struct {
+	// Schema optionally references the JSON Schema of the file for editors, see Schema
+	Schema string `json:"$schema,omitempty" toml:"$schema,omitempty"`
+	// Version is the version of the config file format, see Version
+	Version int `json:"version" toml:"version" jsonschema:"required"`
+	// Keys holds named private keys, which entries may reference
+	Keys []JimKey `json:"keys,omitempty" toml:"keys,omitempty"`
+	// Recording configures the recording of connect sessions
+	Recording *JimRecording `json:"recording,omitempty" toml:"recording,omitempty"`
+	// Defaults holds values, which entries inherit
+	Defaults *JimDefaults       `json:"defaults,omitempty" toml:"defaults,omitempty"`
+	Entries  []JimConfigElement `json:"entries" toml:"entries" jsonschema:"required"`
 
-// UnmarshalJimConfig tries to parse given byte[] in json format to a JimConfig struct
+	// scopes holds the keys and defaults of the configs, a merged config was merged from. Nil for other configs.
+	scopes []scope
+	// scopeOf maps the tags of merged entries to the index of the declaring config in scopes
+	scopeOf map[string]int
+}
+
+// UnmarshalJimConfig tries to parse given byte[] to a JimConfig struct, detecting whether it's json, yaml or toml.
+// Config files of older versions, e.g. plain lists of config elements, are upgraded while parsing.
 func UnmarshalJimConfig(data []byte) (JimConfig, error) {
-	var r JimConfig
-	err := json.Unmarshal(data, &r)
-	return r, err
+	return UnmarshalJimConfigFormat(data, DetectFormat(data))
 }
 
-// Marshal serializes a JimConfig struct to json format
+// Marshal serializes a JimConfig struct to json format, always using the current version.
 func (r *JimConfig) Marshal() ([]byte, error) {
-	return json.Marshal(r)
+	return r.MarshalFormat(JSON)
 }
 
 // JimConfigElement is the main structure in the json format
 type JimConfigElement struct {
-	Group  string         `json:"group"`
-	Env    string         `json:"env"`
-	Tag    string         `json:"tag"`
-	Server JimConfigEntry `json:"server"`
+	Group  string         `json:"group" toml:"group" jsonschema:"required"`
+	Env    string         `json:"env" toml:"env" jsonschema:"required"`
+	Tag    string         `json:"tag" toml:"tag" jsonschema:"required"`
+	Server JimConfigEntry `json:"server" toml:"server" jsonschema:"required"`
+	// Aliases are further names of the entry, e.g. short names, which have to be unique like tags
+	Aliases []string `json:"aliases,omitempty" toml:"aliases,omitempty"`
+	// Labels are free key value pairs, e.g. role: db, which can be filtered like the group or env
+	Labels map[string]string `json:"labels,omitempty" toml:"labels,omitempty"`
 }
 
 // JimConfigEntry holds all the information necessary to connect to a server via ssh
 type JimConfigEntry struct {
-	Host     string `json:"host"`
-	Dir      string `json:"dir"`
-	Port     string `json:"port"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Host string `json:"host" toml:"host"`
+	Dir  string `json:"dir" toml:"dir"`
+	// Port is the ssh port of the server, 0 if it's not set. Unset ports are inherited from the defaults or default to 22.
+	Port     int    `json:"port,omitempty" toml:"port,omitempty" jsonschema:"minimum=1,maximum=65535"`
+	Username string `json:"username" toml:"username"`
+	Password string `json:"password" toml:"password"`
+	// PrivateKey holds a PEM encoded private key used for authentication
+	PrivateKey string `json:"private_key,omitempty" toml:"private_key,omitempty"`
+	// KeyRef references a key in JimConfig.Keys by name, as alternative to PrivateKey
+	KeyRef string `json:"key_ref,omitempty" toml:"key_ref,omitempty"`
+	// Passphrase decrypts the private key. Overrides the passphrase of a referenced key.
+	Passphrase string `json:"passphrase,omitempty" toml:"passphrase,omitempty"`
+	// Jump lists the tags of the entries to use as jump hosts, starting with the first hop.
+	// Jump hosts may use jump hosts themselves.
+	Jump []string `json:"jump,omitempty" toml:"jump,omitempty"`
+	// HostKeys holds the pinned host keys of the server in authorized_keys format
+	HostKeys []string `json:"host_keys,omitempty" toml:"host_keys,omitempty"`
+	// Forwards declares the port forwards, which 'jim tunnel up' opens for the server
+	Forwards []JimForward `json:"forwards,omitempty" toml:"forwards,omitempty"`
+	// Record enables the recording of connect sessions with the server
+	Record bool `json:"record,omitempty" toml:"record,omitempty"`
+	// Shell is the shell started for interactive sessions, defaults to the login shell of the user
+	Shell string `json:"shell,omitempty" toml:"shell,omitempty"`
+	// StartupCommand is run before the shell of an interactive session is started
+	StartupCommand string `json:"startup_command,omitempty" toml:"startup_command,omitempty"`
+	// Env holds environment variables set for sessions
+	Env map[string]string `json:"env,omitempty" toml:"env,omitempty"`
+}
+
+// JimForward declares a port forward through the server
+type JimForward struct {
+	// Type is either "local" or "remote", like ssh's -L and -R options
+	Type string `json:"type" toml:"type" jsonschema:"required,enum=local,enum=remote"`
+	// Listen is the address to listen on in the format [bind_address:]port.
+	// Local forwards listen on the local machine, remote forwards on the server.
+	Listen string `json:"listen" toml:"listen" jsonschema:"required"`
+	// Target is the address to forward connections to in the format host:port
+	Target string `json:"target" toml:"target" jsonschema:"required"`
+}
+
+// JimKey is a named private key, which may be shared by multiple entries
+type JimKey struct {
+	Name       string `json:"name" toml:"name" jsonschema:"required"`
+	PrivateKey string `json:"private_key" toml:"private_key" jsonschema:"required"`
+	Passphrase string `json:"passphrase,omitempty" toml:"passphrase,omitempty"`
+	// Confirm requires a confirmation, whenever jim's ssh-agent is asked to use the key
+	Confirm bool `json:"confirm,omitempty" toml:"confirm,omitempty"`
+}
+
+// JimRecording configures, which connect sessions are recorded
+type JimRecording struct {
+	// Envs lists the envs, whose sessions are always recorded
+	Envs []string `json:"envs,omitempty" toml:"envs,omitempty"`
+	// Encrypt enables the encryption of recordings with the recording key
+	Encrypt bool `json:"encrypt,omitempty" toml:"encrypt,omitempty"`
+	// Key is the base64 encoded recording key. It is generated, when it's needed for the first time.
+	Key string `json:"key,omitempty" toml:"key,omitempty"`
+}
+
+// IsRecorded returns true, if connect sessions with the element have to be recorded
+func (r *JimConfig) IsRecorded(el *JimConfigElement) bool {
+	if resolved, _ := r.Resolve(el); resolved.Record {
+		return true
+	}
+	if r.Recording == nil {
+		return false
+	}
+	for _, env := range r.Recording.Envs {
+		if strings.EqualFold(env, el.Env) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindKey returns the key with given name, or nil if there is none
+func (r *JimConfig) FindKey(name string) *JimKey {
+	for i := range r.Keys {
+		if r.Keys[i].Name == name {
+			return &r.Keys[i]
+		}
+	}
+	return nil
+}
+
+// FindKeyOf returns the key with given name, which the element may reference, or nil if there is none.
+// Elements of a merged config reference the keys of the config declaring them and keys added to the merged config.
+func (r *JimConfig) FindKeyOf(el *JimConfigElement, name string) *JimKey {
+	if r.scopes == nil {
+		return r.FindKey(name)
+	}
+	s := &r.scopes[r.scopeOf[el.Tag]]
+	for i := range s.keys {
+		if s.keys[i].Name == name {
+			return &s.keys[i]
+		}
+	}
+	for _, s := range r.scopes {
+		for _, key := range s.keys {
+			if key.Name == name {
+				// declared by another config
+				return nil
+			}
+		}
+	}
+	return r.FindKey(name)
+}
+
+// PrivateKeyOf returns the PEM encoded private key and passphrase, the resolved entry of the element authenticates with.
+// The returned key is empty, if the entry doesn't use key authentication.
+// Returns false, if the entry references a key, that doesn't exist.
+func (r *JimConfig) PrivateKeyOf(el *JimConfigElement, entry *JimConfigEntry) (string, string, bool) {
+	if entry.KeyRef == "" {
+		return entry.PrivateKey, entry.Passphrase, true
+	}
+
+	key := r.FindKeyOf(el, entry.KeyRef)
+	if key == nil {
+		return "", "", false
+	}
+	passphrase := key.Passphrase
+	if entry.Passphrase != "" {
+		passphrase = entry.Passphrase
+	}
+	return key.PrivateKey, passphrase, true
 }
@@ -0,0 +1,651 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pkg/errors"
+)
+
+// EditError is returned by Patch, if the modifications can't be written to a config file without losing its
+// comments. Edits describes the modifications, so they can be made by hand.
+type EditError struct {
+	Format Format
+	Edits  []string
+}
+
+func (e *EditError) Error() string {
+	return fmt.Sprintf("the %s file can't be modified without losing its comments, edit it by hand:\n%s", e.Format, strings.Join(e.Edits, "\n"))
+}
+
+// change is a modification of a config. The path holds the keys of mappings and the indices of sequences
+// leading to the modified value, the path of an appended item ends with the index behind the last item.
+type change struct {
+	path     []interface{}
+	value    interface{}
+	removed  bool
+	appended bool
+}
+
+// Patch writes the modifications of modified compared to original to data, the config file original was parsed from.
+// YAML files are patched in place, so their comments and the layout of the unmodified parts are kept.
+// TOML files aren't rewritten, an *EditError describes the modifications instead. JSON files are marshaled again.
+// Data is returned as is, if nothing was modified. Files of older versions are never modified, they have to be migrated first.
+func Patch(data []byte, format Format, original *JimConfig, modified *JimConfig) ([]byte, error) {
+	before, err := treeOf(original)
+	if err != nil {
+		return nil, err
+	}
+	after, err := treeOf(modified)
+	if err != nil {
+		return nil, err
+	}
+	changes := diff(nil, before, after)
+	if len(changes) == 0 {
+		return data, nil
+	}
+	if original.Version < Version {
+		return nil, errors.Errorf("the file uses version %d of the config format, run 'jim migrate' to upgrade it to version %d first", original.Version, Version)
+	}
+
+	switch format {
+	case YAML:
+		patched, err := patchYAML(data, changes, after)
+		if err == nil {
+			err = verifyPatch(patched, after)
+		}
+		if err != nil {
+			return nil, editError(format, changes, before, after)
+		}
+		return patched, nil
+	case TOML:
+		return nil, editError(format, changes, before, after)
+	default:
+		return json.Marshal(modified)
+	}
+}
+
+// treeOf converts the config to nested yaml.MapSlice, []interface{} and scalars, keeping the order of the fields
+func treeOf(config *JimConfig) (interface{}, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := yaml.UnmarshalWithOptions(data, &tree, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// diff returns the changes turning before into after. Mappings and sequences of mappings are compared item by item,
+// other sequences are replaced as a whole, unless items were appended only.
+func diff(path []interface{}, before interface{}, after interface{}) []change {
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	at := func(element interface{}) []interface{} {
+		return append(append([]interface{}(nil), path...), element)
+	}
+
+	switch after := after.(type) {
+	case yaml.MapSlice:
+		before, ok := before.(yaml.MapSlice)
+		if !ok {
+			break
+		}
+		var changes []change
+		for _, item := range after {
+			if value, ok := lookupItem(before, item.Key); ok {
+				changes = append(changes, diff(at(item.Key), value, item.Value)...)
+			} else {
+				changes = append(changes, change{path: at(item.Key), value: item.Value})
+			}
+		}
+		for _, item := range before {
+			if _, ok := lookupItem(after, item.Key); !ok {
+				changes = append(changes, change{path: at(item.Key), removed: true})
+			}
+		}
+		return changes
+	case []interface{}:
+		before, ok := before.([]interface{})
+		if !ok || len(after) < len(before) {
+			break
+		}
+		var changes []change
+		for i := range before {
+			if reflect.DeepEqual(before[i], after[i]) {
+				continue
+			}
+			_, wasMapping := before[i].(yaml.MapSlice)
+			_, isMapping := after[i].(yaml.MapSlice)
+			if !wasMapping || !isMapping {
+				return []change{{path: path, value: after}}
+			}
+			changes = append(changes, diff(at(i), before[i], after[i])...)
+		}
+		for i := len(before); i < len(after); i++ {
+			changes = append(changes, change{path: at(i), value: after[i], appended: true})
+		}
+		return changes
+	}
+	return []change{{path: path, value: after}}
+}
+
+func lookupItem(m yaml.MapSlice, key interface{}) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// valueAt returns the value at path in the tree
+func valueAt(tree interface{}, path []interface{}) interface{} {
+	for _, element := range path {
+		switch element := element.(type) {
+		case int:
+			items, _ := tree.([]interface{})
+			if element >= len(items) {
+				return nil
+			}
+			tree = items[element]
+		default:
+			m, _ := tree.(yaml.MapSlice)
+			tree, _ = lookupItem(m, element)
+		}
+	}
+	return tree
+}
+
+// verifyPatch makes sure, the patched file parses to the modified config. Trailing new lines of strings are ignored,
+// as the parser adds the blank lines following a literal block scalar to its value.
+func verifyPatch(patched []byte, after interface{}) error {
+	parsed, err := UnmarshalJimConfigFormat(patched, YAML)
+	if err != nil {
+		return err
+	}
+	tree, err := treeOf(&parsed)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(trimNewLines(tree), trimNewLines(after)) {
+		return errors.New("the patched file differs from the modified config")
+	}
+	return nil
+}
+
+func trimNewLines(tree interface{}) interface{} {
+	switch tree := tree.(type) {
+	case yaml.MapSlice:
+		trimmed := make(yaml.MapSlice, len(tree))
+		for i, item := range tree {
+			trimmed[i] = yaml.MapItem{Key: item.Key, Value: trimNewLines(item.Value)}
+		}
+		return trimmed
+	case []interface{}:
+		trimmed := make([]interface{}, len(tree))
+		for i, item := range tree {
+			trimmed[i] = trimNewLines(item)
+		}
+		return trimmed
+	case string:
+		return strings.TrimRight(tree, "\n")
+	default:
+		return tree
+	}
+}
+
+// textEdit replaces the bytes from start to end of a file with text
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// yamlPatch collects the text edits of the modifications of a yaml file
+type yamlPatch struct {
+	data []byte
+	// lineStarts holds the offsets of the lines, the first line has index 0
+	lineStarts []int
+	after      interface{}
+	edits      []textEdit
+	// replaced holds the paths of the values, which were replaced or inserted as a whole
+	replaced [][]interface{}
+}
+
+var errUnsupportedYAML = errors.New("the yaml file can't be patched")
+
+// patchYAML applies the changes to the yaml file data. Modified values are replaced including the comments
+// within them, added ones are inserted behind their siblings. Flow style mappings and sequences are replaced as a whole.
+func patchYAML(data []byte, changes []change, after interface{}) ([]byte, error) {
+	file, err := parser.ParseBytes(data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Docs) != 1 {
+		return nil, errUnsupportedYAML
+	}
+
+	p := &yamlPatch{data: data, lineStarts: []int{0}, after: after}
+	for i, c := range data {
+		if c == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+	for _, c := range changes {
+		if err := p.apply(file.Docs[0].Body, c); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(p.edits, func(i, j int) bool { return p.edits[i].start < p.edits[j].start })
+	var out bytes.Buffer
+	last := 0
+	for _, edit := range p.edits {
+		if edit.start < last {
+			return nil, errUnsupportedYAML
+		}
+		out.Write(data[last:edit.start])
+		if edit.start == len(data) && len(data) != 0 && data[len(data)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+		out.WriteString(edit.text)
+		last = edit.end
+	}
+	out.Write(data[last:])
+	return out.Bytes(), nil
+}
+
+// apply follows the path of the change through the block style mappings and sequences of the document
+func (p *yamlPatch) apply(root ast.Node, c change) error {
+	for _, prefix := range p.replaced {
+		if hasPrefix(c.path, prefix) {
+			return nil
+		}
+	}
+	// replaces a value, which contains the changed one, and skips the further changes within it
+	replace := func(depth int, edit func(value interface{}) error) error {
+		p.replaced = append(p.replaced, c.path[:depth+1])
+		return edit(valueAt(p.after, c.path[:depth+1]))
+	}
+
+	node := root
+	for depth, element := range c.path {
+		last := depth == len(c.path)-1
+		switch element := element.(type) {
+		case int:
+			seq, ok := node.(*ast.SequenceNode)
+			if !ok || seq.IsFlowStyle {
+				return errUnsupportedYAML
+			}
+			if element >= len(seq.Values) {
+				if !last || !c.appended {
+					return errUnsupportedYAML
+				}
+				return p.appendItem(seq, c.value)
+			}
+			item := seq.Values[element]
+			if last {
+				return p.replaceItem(seq, item, c.value)
+			}
+			// the first key of an item shares the line with the dash
+			if !isBlockMapping(item) || (c.removed && depth == len(c.path)-2 && p.startsItem(item, c.path[depth+1])) {
+				return replace(depth, func(value interface{}) error { return p.replaceItem(seq, item, value) })
+			}
+			node = item
+		default:
+			key := fmt.Sprint(element)
+			values, ok := mappingValues(node)
+			if !ok {
+				return errUnsupportedYAML
+			}
+			mv := findKey(values, key)
+			switch {
+			case last && c.removed:
+				if mv != nil {
+					p.removeKey(mv)
+				}
+				return nil
+			case c.removed && mv == nil:
+				return nil
+			case mv == nil:
+				return replace(depth, func(value interface{}) error { return p.insertKey(values, key, value) })
+			case last:
+				return p.replaceKey(mv, key, c.value)
+			}
+			next := c.path[depth+1]
+			if _, isIndex := next.(int); (isIndex && !isBlockSequence(mv.Value)) || (!isIndex && !isBlockMapping(mv.Value)) {
+				return replace(depth, func(value interface{}) error { return p.replaceKey(mv, key, value) })
+			}
+			node = mv.Value
+		}
+	}
+	return errUnsupportedYAML
+}
+
+func hasPrefix(path []interface{}, prefix []interface{}) bool {
+	return len(path) >= len(prefix) && reflect.DeepEqual(path[:len(prefix)], prefix)
+}
+
+func mappingValues(node ast.Node) ([]*ast.MappingValueNode, bool) {
+	switch node := node.(type) {
+	case *ast.MappingNode:
+		return node.Values, !node.IsFlowStyle
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{node}, true
+	default:
+		return nil, false
+	}
+}
+
+func findKey(values []*ast.MappingValueNode, key string) *ast.MappingValueNode {
+	for _, mv := range values {
+		if mv.Key.GetToken().Value == key {
+			return mv
+		}
+	}
+	return nil
+}
+
+func isBlockMapping(node ast.Node) bool {
+	values, ok := mappingValues(node)
+	return ok && len(values) != 0
+}
+
+func isBlockSequence(node ast.Node) bool {
+	seq, ok := node.(*ast.SequenceNode)
+	return ok && !seq.IsFlowStyle && len(seq.Values) != 0
+}
+
+// startsItem returns true, if key is the first key of the mapping item
+func (p *yamlPatch) startsItem(item ast.Node, key interface{}) bool {
+	values, _ := mappingValues(item)
+	return len(values) != 0 && values[0].Key.GetToken().Value == fmt.Sprint(key)
+}
+
+func (p *yamlPatch) offset(line int, column int) int {
+	return p.lineStarts[line-1] + column - 1
+}
+
+// blockEnd returns the offset behind the block starting at line, which spans the following lines indented deeper than
+// indent. With dashes, lines starting with a dash at indent belong to the block, as sequences may be indented like their key.
+// Comments and blank lines at the end of the block belong to the following one.
+func (p *yamlPatch) blockEnd(line int, indent int, dashes bool) int {
+	last := line
+	for l := line + 1; l <= len(p.lineStarts); l++ {
+		text := p.lineText(l)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineIndent := len(text) - len(trimmed)
+		if lineIndent > indent || (dashes && lineIndent == indent && strings.HasPrefix(trimmed, "-")) {
+			last = l
+			continue
+		}
+		break
+	}
+	if last == len(p.lineStarts) {
+		return len(p.data)
+	}
+	return p.lineStarts[last]
+}
+
+func (p *yamlPatch) lineText(line int) string {
+	end := len(p.data)
+	if line < len(p.lineStarts) {
+		end = p.lineStarts[line]
+	}
+	return strings.TrimRight(string(p.data[p.lineStarts[line-1]:end]), "\r\n")
+}
+
+// keyEnd returns the offset behind the key and its value
+func (p *yamlPatch) keyEnd(mv *ast.MappingValueNode) int {
+	pos := mv.Key.GetToken().Position
+	_, isSequence := mv.Value.(*ast.SequenceNode)
+	return p.blockEnd(pos.Line, pos.Column-1, isSequence)
+}
+
+func (p *yamlPatch) replaceKey(mv *ast.MappingValueNode, key string, value interface{}) error {
+	pos := mv.Key.GetToken().Position
+	text, err := renderYAML(yaml.MapSlice{{Key: key, Value: value}}, pos.Column-1, false)
+	if err != nil {
+		return err
+	}
+	p.edits = append(p.edits, textEdit{start: p.offset(pos.Line, pos.Column), end: p.keyEnd(mv), text: text})
+	return nil
+}
+
+func (p *yamlPatch) removeKey(mv *ast.MappingValueNode) {
+	pos := mv.Key.GetToken().Position
+	p.edits = append(p.edits, textEdit{start: p.lineStarts[pos.Line-1], end: p.keyEnd(mv)})
+}
+
+// insertKey adds the key behind the last key of the mapping
+func (p *yamlPatch) insertKey(values []*ast.MappingValueNode, key string, value interface{}) error {
+	indent := values[0].Key.GetToken().Position.Column - 1
+	text, err := renderYAML(yaml.MapSlice{{Key: key, Value: value}}, indent, true)
+	if err != nil {
+		return err
+	}
+	end := p.keyEnd(values[len(values)-1])
+	p.edits = append(p.edits, textEdit{start: end, end: end, text: text})
+	return nil
+}
+
+// itemStart returns the position of the first token of a sequence item
+func itemStart(item ast.Node) (line int, column int) {
+	if values, ok := mappingValues(item); ok && len(values) != 0 {
+		pos := values[0].Key.GetToken().Position
+		return pos.Line, pos.Column
+	}
+	if m, ok := item.(*ast.MappingNode); ok && m.Start != nil {
+		return m.Start.Position.Line, m.Start.Position.Column
+	}
+	pos := item.GetToken().Position
+	return pos.Line, pos.Column
+}
+
+func (p *yamlPatch) replaceItem(seq *ast.SequenceNode, item ast.Node, value interface{}) error {
+	line, column := itemStart(item)
+	text, err := renderYAML(value, column-1, false)
+	if err != nil {
+		return err
+	}
+	dash := seq.GetToken().Position.Column
+	p.edits = append(p.edits, textEdit{start: p.offset(line, column), end: p.blockEnd(line, dash-1, false), text: text})
+	return nil
+}
+
+// appendItem adds the item behind the last item of the sequence, indented like the first item
+func (p *yamlPatch) appendItem(seq *ast.SequenceNode, value interface{}) error {
+	if len(seq.Values) == 0 {
+		return errUnsupportedYAML
+	}
+	dash := seq.GetToken().Position.Column
+	_, column := itemStart(seq.Values[0])
+	if column <= dash {
+		return errUnsupportedYAML
+	}
+	text, err := renderYAML(value, column-1, false)
+	if err != nil {
+		return err
+	}
+	text = strings.Repeat(" ", dash-1) + "-" + strings.Repeat(" ", column-dash-1) + text
+
+	line, _ := itemStart(seq.Values[len(seq.Values)-1])
+	end := p.blockEnd(line, dash-1, false)
+	p.edits = append(p.edits, textEdit{start: end, end: end, text: text})
+	return nil
+}
+
+// renderYAML marshals the value in block style. The lines following the first one are indented by indent spaces,
+// the first one as well with indentFirst.
+func renderYAML(value interface{}, indent int, indentFirst bool) (string, error) {
+	data, err := yaml.MarshalWithOptions(value, yaml.IndentSequence(true))
+	if err != nil {
+		return "", err
+	}
+	prefix := strings.Repeat(" ", indent)
+	lines := strings.SplitAfter(string(data), "\n")
+	var text strings.Builder
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		if (i > 0 || indentFirst) && line != "\n" {
+			text.WriteString(prefix)
+		}
+		text.WriteString(line)
+	}
+	if !strings.HasSuffix(text.String(), "\n") {
+		text.WriteString("\n")
+	}
+	return text.String(), nil
+}
+
+// editError describes the changes, so they can be made by hand
+func editError(format Format, changes []change, before interface{}, after interface{}) error {
+	e := &EditError{Format: format}
+	for _, c := range changes {
+		if _, ok := c.value.(yaml.MapSlice); c.appended && !ok {
+			// strings added to a list are shown with the whole list
+			c = change{path: c.path[:len(c.path)-1], value: valueAt(after, c.path[:len(c.path)-1])}
+		}
+
+		// paths within existing entries are described by the tag of the entry
+		where, rest := "", c.path
+		if len(c.path) > 2 && c.path[0] == "entries" {
+			if tag, ok := valueAt(before, []interface{}{"entries", c.path[1], "tag"}).(string); ok {
+				where, rest = fmt.Sprintf(" of the entry '%s'", tag), c.path[2:]
+			}
+		}
+
+		switch {
+		case c.removed:
+			e.Edits = append(e.Edits, fmt.Sprintf("- remove %s%s", dottedPath(rest), where))
+			continue
+		case c.appended:
+			rest = rest[:len(rest)-1]
+		}
+		verb := "set"
+		if c.appended {
+			verb = "add to"
+		}
+		snippet, err := renderSnippet(format, c)
+		if err != nil {
+			return err
+		}
+		e.Edits = append(e.Edits, fmt.Sprintf("- %s %s%s:\n%s", verb, dottedPath(rest), where, snippet))
+	}
+	return e
+}
+
+// renderSnippet renders the changed value nested within the keys of its path, indented by four spaces
+func renderSnippet(format Format, c change) (string, error) {
+	var value interface{} = plainValue(c.value)
+	if c.appended {
+		value = []interface{}{value}
+	}
+	path := c.path
+	if c.appended {
+		path = path[:len(path)-1]
+	}
+	// yaml snippets start at the last sequence item, toml ones need the whole path for the table headers
+	for i := len(path) - 1; i >= 0; i-- {
+		key, ok := path[i].(string)
+		if !ok {
+			if format == YAML {
+				break
+			}
+			continue
+		}
+		value = map[string]interface{}{key: value}
+	}
+
+	var data []byte
+	var err error
+	if format == TOML {
+		data, err = toml.Marshal(value)
+	} else {
+		data, err = yaml.MarshalWithOptions(value, yaml.IndentSequence(true))
+	}
+	if err != nil {
+		return "", err
+	}
+	var snippet []string
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i, line := range lines {
+		if format == TOML && isEmptyTable(lines[i:]) {
+			// tables are declared by their subtables as well, e.g. [entries.server] declares entries
+			continue
+		}
+		if line != "" {
+			line = "    " + line
+		}
+		snippet = append(snippet, line)
+	}
+	return strings.Join(snippet, "\n"), nil
+}
+
+// isEmptyTable returns true, if the first line is the header of a toml table without keys
+func isEmptyTable(lines []string) bool {
+	isHeader := func(line string) bool {
+		return strings.HasPrefix(line, "[") && !strings.HasPrefix(line, "[[")
+	}
+	if !isHeader(lines[0]) {
+		return false
+	}
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) != "" {
+			return strings.HasPrefix(line, "[")
+		}
+	}
+	return true
+}
+
+// plainValue converts yaml.MapSlice to maps, which can be marshaled to toml
+func plainValue(tree interface{}) interface{} {
+	switch tree := tree.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(tree))
+		for _, item := range tree {
+			m[fmt.Sprint(item.Key)] = plainValue(item.Value)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(tree))
+		for i, item := range tree {
+			items[i] = plainValue(item)
+		}
+		return items
+	default:
+		return tree
+	}
+}
+
+func dottedPath(path []interface{}) string {
+	var b strings.Builder
+	for _, element := range path {
+		if i, ok := element.(int); ok {
+			fmt.Fprintf(&b, "[%d]", i)
+			continue
+		}
+		if b.Len() != 0 {
+			b.WriteString(".")
+		}
+		fmt.Fprint(&b, element)
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const pinnedKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAINew"
+
+// patchFixture applies the modification to the parsed fixture and patches it into the file
+func patchFixture(t *testing.T, name string, modify func(config *JimConfig)) ([]byte, []byte, *JimConfig, error) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := FormatOf(name, data)
+	original, err := UnmarshalJimConfigFormat(data, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := UnmarshalJimConfigFormat(data, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify(&modified)
+	patched, err := Patch(data, format, &original, &modified)
+	return data, patched, &modified, err
+}
+
+func TestPatchPinsHostKeyInCommentedYAML(t *testing.T) {
+	data, patched, modified, err := patchFixture(t, "commented.yaml", func(config *JimConfig) {
+		config.Entries[0].Server.HostKeys = []string{pinnedKey}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Replace(string(data), "      env: {LANG: C.UTF-8}\n",
+		"      env: {LANG: C.UTF-8}\n      host_keys:\n        - "+pinnedKey+"\n", 1)
+	if string(patched) != want {
+		t.Errorf("patched file:\n%s\nwant:\n%s", patched, want)
+	}
+
+	parsed, err := UnmarshalJimConfigFormat(patched, YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, *modified) {
+		t.Errorf("the patched file parses to\n%+v\nwant\n%+v", parsed, *modified)
+	}
+}
+
+func TestPatchYAMLKeepsComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *JimConfig)
+		want   string
+	}{
+		{"append to a list", func(config *JimConfig) {
+			config.Entries[1].Server.HostKeys = append(config.Entries[1].Server.HostKeys, pinnedKey)
+		}, "        # pinned on setup\n        - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOld\n        - " + pinnedKey + "\n"},
+		{"add a section", func(config *JimConfig) {
+			config.Recording = &JimRecording{Key: "c2VjcmV0"}
+		}, "\nrecording:\n  key: c2VjcmV0\n"},
+		{"add an entry", func(config *JimConfig) {
+			config.Entries = append(config.Entries, JimConfigElement{Group: "CRM", Env: "PROD", Tag: "crm-db1-prod", Server: JimConfigEntry{Host: "10.2.0.3", Username: "root"}})
+		}, "\n  - group: CRM\n    env: PROD\n    tag: crm-db1-prod\n    server:\n      host: 10.2.0.3\n"},
+		{"remove a key", func(config *JimConfig) {
+			config.Entries[0].Server.KeyRef = ""
+		}, "      password: \"\"\n      env: {LANG: C.UTF-8}\n"},
+		{"replace a flow mapping", func(config *JimConfig) {
+			config.Entries[0].Server.Env["TZ"] = "UTC"
+		}, "      env:\n        LANG: C.UTF-8\n        TZ: UTC\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, patched, _, err := patchFixture(t, "commented.yaml", test.modify)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(patched), test.want) {
+				t.Errorf("patched file lacks %q:\n%s", test.want, patched)
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				if strings.Contains(line, "#") && !strings.Contains(string(patched), line) {
+					t.Errorf("patched file lost the comment %q", line)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchDescribesTOMLEdits(t *testing.T) {
+	_, patched, _, err := patchFixture(t, "inventory.toml", func(config *JimConfig) {
+		config.Entries[1].Server.HostKeys = []string{pinnedKey}
+	})
+	var editErr *EditError
+	if !errors.As(err, &editErr) {
+		t.Fatalf("patching a toml file returned %v, want an EditError", err)
+	}
+	if patched != nil {
+		t.Errorf("patching a toml file returned contents")
+	}
+	want := "- set server.host_keys of the entry 'crm-db1-int':\n    [entries.server]\n    host_keys = ['" + pinnedKey + "']"
+	if len(editErr.Edits) != 1 || editErr.Edits[0] != want {
+		t.Errorf("edits are %q, want %q", editErr.Edits, want)
+	}
+}
+
+func TestPatchUnmodified(t *testing.T) {
+	for _, name := range []string{"inventory.json", "inventory.toml", "commented.yaml"} {
+		data, patched, _, err := patchFixture(t, name, func(config *JimConfig) {})
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if string(patched) != string(data) {
+			t.Errorf("%s was modified:\n%s", name, patched)
+		}
+	}
+}
+
+func TestPatchRefusesOlderVersions(t *testing.T) {
+	data := []byte(`[{"group": "billing", "env": "prod", "tag": "web1", "server": {"host": "web1.int", "port": "22", "dir": "/", "username": "deploy", "password": ""}}]`)
+	original, err := UnmarshalJimConfigFormat(data, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := UnmarshalJimConfigFormat(data, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if patched, err := Patch(data, JSON, &original, &modified); err != nil || string(patched) != string(data) {
+		t.Errorf("patching an unmodified version 1 file returned %s, %v", patched, err)
+	}
+	modified.Entries[0].Server.HostKeys = []string{pinnedKey}
+	if _, err := Patch(data, JSON, &original, &modified); err == nil || !strings.Contains(err.Error(), "jim migrate") {
+		t.Errorf("patching a version 1 file returned %v, want an error about the migration", err)
+	}
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONSchema is the subset of JSON Schema (draft-07), which is needed to describe the config file.
+// Fields of the model are described by their type, the jsonschema struct tag adds constraints,
+// e.g. `jsonschema:"required,minimum=1,enum=local,enum=remote"`.
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+	// Properties describes the fields of an object
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	// AdditionalProperties is either false, if an object must not have other fields than its properties,
+	// or the schema of the values of a map
+	AdditionalProperties interface{}   `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema   `json:"items,omitempty"`
+	Enum                 []interface{} `json:"enum,omitempty"`
+	Const                interface{}   `json:"const,omitempty"`
+	Minimum              *int          `json:"minimum,omitempty"`
+	Maximum              *int          `json:"maximum,omitempty"`
+}
+
+// SchemaViolation describes a part of a config file, which doesn't match the schema
+type SchemaViolation struct {
+	// Pointer locates the offending value as JSON pointer, e.g. /entries/3/server/port
+	Pointer string
+	Msg     string
+}
+
+func (v SchemaViolation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Pointer, v.Msg)
+}
+
+// Schema returns the JSON Schema of the config file in the current version, generated from the JimConfig type
+func Schema() *JSONSchema {
+	schema := schemaOf(reflect.TypeOf(JimConfig{}))
+	schema.Schema = "http://json-schema.org/draft-07/schema#"
+	schema.Title = "jim config"
+	schema.Description = fmt.Sprintf("Version %d of the config file format of jim", Version)
+	schema.Properties["version"].Const = Version
+	return schema
+}
+
+// ValidateSchema checks the config file in the given format against the schema.
+// The file has to use the current version, syntax errors are returned as error.
+func ValidateSchema(data []byte, format Format) ([]SchemaViolation, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return Schema().Validate(doc), nil
+}
+
+// schemaOf describes the go type t
+func schemaOf(t reflect.Type) *JSONSchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			property := schemaOf(field.Type)
+			if applyConstraints(property, field.Tag.Get("jsonschema")) {
+				schema.Required = append(schema.Required, name)
+			}
+			schema.Properties[name] = property
+		}
+		return schema
+	default:
+		panic(fmt.Sprintf("the config model uses the type %s, which can't be described by the schema", t))
+	}
+}
+
+// applyConstraints adds the constraints of a jsonschema struct tag to the schema. Returns true, if the field is required.
+func applyConstraints(schema *JSONSchema, tag string) bool {
+	required := false
+	for _, constraint := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(constraint, "=")
+		switch key {
+		case "":
+		case "required":
+			required = true
+		case "minimum", "maximum":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				panic(fmt.Sprintf("invalid jsonschema constraint %s", constraint))
+			}
+			if key == "minimum" {
+				schema.Minimum = &n
+			} else {
+				schema.Maximum = &n
+			}
+		case "enum":
+			schema.Enum = append(schema.Enum, value)
+		default:
+			panic(fmt.Sprintf("unknown jsonschema constraint %s", constraint))
+		}
+	}
+	return required
+}
+
+// Validate checks the document, as returned by the json, yaml or toml parsers, against the schema
+func (s *JSONSchema) Validate(doc interface{}) []SchemaViolation {
+	var violations []SchemaViolation
+	s.validate(doc, "", &violations)
+	return violations
+}
+
+func (s *JSONSchema) validate(value interface{}, pointer string, violations *[]SchemaViolation) {
+	report := func(format string, args ...interface{}) {
+		location := pointer
+		if location == "" {
+			location = "/"
+		}
+		*violations = append(*violations, SchemaViolation{Pointer: location, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if actual := typeOf(value); s.Type != "" && actual != s.Type {
+		report("expected %s, got %s", s.Type, actual)
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				report("missing required property '%s'", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := pointer + "/" + escapePointer(name)
+			if property, ok := s.Properties[name]; ok {
+				property.validate(v[name], child, violations)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case *JSONSchema:
+				additional.validate(v[name], child, violations)
+			case bool:
+				if !additional {
+					report("unknown property '%s'", name)
+				}
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s/%d", pointer, i), violations)
+			}
+		}
+	}
+
+	if s.Const != nil && !equalValues(value, s.Const) {
+		report("expected %v, got %v", s.Const, value)
+	}
+	if len(s.Enum) != 0 {
+		allowed := false
+		var names []string
+		for _, e := range s.Enum {
+			allowed = allowed || equalValues(value, e)
+			names = append(names, fmt.Sprintf("'%v'", e))
+		}
+		if !allowed {
+			report("'%v' is not one of %s", value, strings.Join(names, ", "))
+		}
+	}
+	if n, ok := asInt(value); ok && s.Type == "integer" {
+		if s.Minimum != nil && n < *s.Minimum {
+			report("%d is less than the minimum %d", n, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			report("%d is greater than the maximum %d", n, *s.Maximum)
+		}
+	}
+}
+
+// typeOf returns the JSON Schema type of a value returned by the json, yaml or toml parsers
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		if _, ok := asInt(value); ok {
+			return "integer"
+		}
+		return "number"
+	}
+}
+
+func equalValues(a interface{}, b interface{}) bool {
+	if x, ok := asInt(a); ok {
+		y, ok := asInt(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+// escapePointer escapes a property name for use in a JSON pointer
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFixturesMatchSchema(t *testing.T) {
+	for _, name := range []string{"inventory.json", "inventory.yaml", "inventory.toml", "commented.yaml"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		violations, err := ValidateSchema(data, FormatOf(name, data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(violations) != 0 {
+			t.Errorf("%s violates the schema: %v", name, violations)
+		}
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	const server = `"host": "web1.int", "dir": "/", "username": "deploy", "password": ""`
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		want   []SchemaViolation
+	}{
+		{"port as string", JSON,
+			`{"version": 2, "entries": [{"group": "a", "env": "b", "tag": "c", "server": {` + server + `, "port": "22"}}]}`,
+			[]SchemaViolation{{Pointer: "/entries/0/server/port", Msg: "expected integer, got string"}}},
+		{"port out of range", JSON,
+			`{"version": 2, "entries": [{"group": "a", "env": "b", "tag": "c", "server": {` + server + `, "port": 70000}}]}`,
+			[]SchemaViolation{{Pointer: "/entries/0/server/port", Msg: "70000 is greater than the maximum 65535"}}},
+		{"unknown field", JSON,
+			`{"version": 2, "entries": [{"group": "a", "env": "b", "tag": "c", "server": {` + server + `}}, {"group": "a", "env": "b", "tag": "d", "server": {` + server + `, "hostname": "x"}}]}`,
+			[]SchemaViolation{{Pointer: "/entries/1/server", Msg: "unknown property 'hostname'"}}},
+		{"missing tag", JSON,
+			`{"version": 2, "entries": [{"group": "a", "env": "b", "server": {` + server + `}}]}`,
+			[]SchemaViolation{{Pointer: "/entries/0", Msg: "missing required property 'tag'"}}},
+		{"other version", JSON,
+			`{"version": 3, "entries": []}`,
+			[]SchemaViolation{{Pointer: "/version", Msg: "expected 2, got 3"}}},
+		{"unknown forward type", JSON,
+			`{"version": 2, "entries": [{"group": "a", "env": "b", "tag": "c", "server": {` + server + `, "forwards": [{"type": "dynamic", "listen": "1080", "target": "x:1"}]}}]}`,
+			[]SchemaViolation{{Pointer: "/entries/0/server/forwards/0/type", Msg: "'dynamic' is not one of 'local', 'remote'"}}},
+		{"quoted yaml port", YAML,
+			"version: 2\nentries:\n  - group: a\n    env: b\n    tag: c\n    server:\n      host: web1.int\n      port: \"22\"\n",
+			[]SchemaViolation{{Pointer: "/entries/0/server/port", Msg: "expected integer, got string"}}},
+		{"unknown toml key", TOML,
+			"version = 2\nentires = []\nentries = []\n",
+			[]SchemaViolation{{Pointer: "/", Msg: "unknown property 'entires'"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations, err := ValidateSchema([]byte(test.data), test.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(violations, test.want) {
+				t.Errorf("violations = %v, want %v", violations, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaSyntaxError(t *testing.T) {
+	if _, err := ValidateSchema([]byte(`{"version": 2,`), JSON); err == nil {
+		t.Errorf("a syntax error wasn't returned")
+	}
+}
+
+func TestSchemaDescribesModel(t *testing.T) {
+	schema := Schema()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"$schema":"http://json-schema.org/draft-07/schema#"`) {
+		t.Errorf("the schema doesn't declare its draft: %s", data)
+	}
+
+	if !reflect.DeepEqual(schema.Required, []string{"version", "entries"}) {
+		t.Errorf("required = %v, want version and entries", schema.Required)
+	}
+	port := schema.Properties["entries"].Items.Properties["server"].Properties["port"]
+	if port.Type != "integer" || port.Minimum == nil || *port.Minimum != 1 || port.Maximum == nil || *port.Maximum != 65535 {
+		t.Errorf("unexpected schema of the port %+v", port)
+	}
+	if env := schema.Properties["entries"].Items.Properties["server"].Properties["env"]; !reflect.DeepEqual(env.AdditionalProperties, &JSONSchema{Type: "string"}) {
+		t.Errorf("the values of env are described by %v, want strings", env.AdditionalProperties)
+	}
+}
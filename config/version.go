@@ -0,0 +1,268 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Version is the version of the config file format, which jim writes.
+// Config files without version, including plain lists of config elements, are version 1.
+const Version = 2
+
+// Change describes a modification made to a config file, when it's migrated to the current version
+type Change struct {
+	// Path locates the modified value in the config file, e.g. entries[3].server.port
+	Path string
+	// Old is the value before the migration, empty if the value was added
+	Old string
+	// New is the value after the migration, empty if the value was removed
+	New string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case c.New == "":
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Migrate parses given byte[] in the given format and upgrades it to the current version.
+// Returns the changes made to the config file, which are empty if it's already up to date.
+func Migrate(data []byte, format Format) (JimConfig, []Change, error) {
+	r, changes, err := unmarshalVersioned(data, format)
+	if err != nil {
+		return r, nil, err
+	}
+	r.Version = Version
+	return r, changes, nil
+}
+
+// unmarshalVersioned parses a config file of any supported version. The returned config keeps the version of the file,
+// older versions are upgraded on the way and the necessary changes are returned.
+func unmarshalVersioned(data []byte, format Format) (JimConfig, []Change, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return JimConfig{}, nil, err
+	}
+
+	version, err := documentVersion(doc, format)
+	if err != nil {
+		return JimConfig{}, nil, err
+	}
+
+	switch {
+	case version == Version:
+		r, err := unmarshalDocument(data, format)
+		return r, nil, err
+	case version > Version:
+		return JimConfig{}, nil, &ParseError{Format: format, Msg: fmt.Sprintf("the config file has version %d, this version of jim supports version %d at most, please update jim", version, Version)}
+	case version < 1:
+		return JimConfig{}, nil, &ParseError{Format: format, Msg: fmt.Sprintf("the config file has the unknown version %d", version)}
+	}
+
+	upgraded, changes, err := upgradeV1(doc)
+	if err != nil {
+		return JimConfig{}, nil, &ParseError{Format: format, Msg: err.Error()}
+	}
+
+	// the upgraded document is parsed in its original format, so the parser is exactly as lenient as for the file itself
+	var encoded []byte
+	switch format {
+	case YAML:
+		encoded, err = yaml.Marshal(upgraded)
+	case TOML:
+		encoded, err = toml.Marshal(upgraded)
+	default:
+		encoded, err = json.Marshal(upgraded)
+	}
+	if err != nil {
+		return JimConfig{}, nil, &ParseError{Format: format, Msg: err.Error()}
+	}
+
+	r, err := unmarshalDocument(encoded, format)
+	if err != nil {
+		// positions refer to the upgraded document, which the user has never seen
+		if parseErr, ok := err.(*ParseError); ok {
+			parseErr.Line, parseErr.Column = 0, 0
+		}
+		return r, nil, err
+	}
+	r.Version = 1
+	return r, changes, nil
+}
+
+// parseDocument parses the config file without mapping it to the model, so its version can be inspected
+func parseDocument(data []byte, format Format) (interface{}, error) {
+	var doc interface{}
+	switch format {
+	case YAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, yamlParseError(err)
+		}
+	case TOML:
+		var table map[string]interface{}
+		if err := toml.Unmarshal(data, &table); err != nil {
+			return nil, tomlParseError(err)
+		}
+		doc = table
+	default:
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, jsonParseError(data, err)
+		}
+	}
+	return doc, nil
+}
+
+// documentVersion returns the version declared by the document, 1 if it doesn't declare any
+func documentVersion(doc interface{}, format Format) (int, error) {
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return 1, nil
+	}
+	value, ok := object["version"]
+	if !ok {
+		return 1, nil
+	}
+	version, ok := asInt(value)
+	if !ok {
+		return 0, &ParseError{Format: format, Msg: fmt.Sprintf("the version must be a number, got '%v'", value)}
+	}
+	return version, nil
+}
+
+// upgradeV1 turns a version 1 document into a version 2 document.
+// Plain lists of config elements are wrapped into an object and ports are converted to numbers.
+// Empty ports are removed, so they are inherited from the defaults.
+func upgradeV1(doc interface{}) (map[string]interface{}, []Change, error) {
+	var changes []Change
+	var object map[string]interface{}
+	switch d := doc.(type) {
+	case nil:
+		object = map[string]interface{}{"entries": []interface{}{}}
+	case []interface{}:
+		object = map[string]interface{}{"entries": d}
+		changes = append(changes, Change{Path: "entries", Old: "plain list of entries", New: "list of entries in a versioned document"})
+	case map[string]interface{}:
+		object = d
+	default:
+		return nil, nil, fmt.Errorf("expected an object or a list of entries, got '%v'", doc)
+	}
+
+	object["version"] = Version
+	changes = append(changes, Change{Path: "version", New: strconv.Itoa(Version)})
+
+	convert := func(path string, entry interface{}) error {
+		change, err := upgradePortV1(path, entry)
+		if change != nil {
+			changes = append(changes, *change)
+		}
+		return err
+	}
+
+	if entries, ok := object["entries"].([]interface{}); ok {
+		for i, el := range entries {
+			element, ok := el.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			path := fmt.Sprintf("entries[%d].server.port", i)
+			if tag, ok := element["tag"].(string); ok {
+				path = fmt.Sprintf("%s (tag '%s')", path, tag)
+			}
+			if err := convert(path, element["server"]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if defaults, ok := object["defaults"].(map[string]interface{}); ok {
+		if err := convert("defaults.global.port", defaults["global"]); err != nil {
+			return nil, nil, err
+		}
+		if groups, ok := defaults["groups"].(map[string]interface{}); ok {
+			for _, group := range sortedKeys(groups) {
+				if err := convert(fmt.Sprintf("defaults.groups.%s.port", group), groups[group]); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		if groupEnvs, ok := defaults["group_envs"].(map[string]interface{}); ok {
+			for _, group := range sortedKeys(groupEnvs) {
+				envs, ok := groupEnvs[group].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for _, env := range sortedKeys(envs) {
+					if err := convert(fmt.Sprintf("defaults.group_envs.%s.%s.port", group, env), envs[env]); err != nil {
+						return nil, nil, err
+					}
+				}
+			}
+		}
+	}
+	return object, changes, nil
+}
+
+// upgradePortV1 converts the port of a version 1 entry from string to number, path locates the port for the user
+func upgradePortV1(path string, entry interface{}) (*Change, error) {
+	server, ok := entry.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	value, ok := server["port"].(string)
+	if !ok {
+		// ports written as number were accepted by yaml and toml before, they don't need to be converted
+		return nil, nil
+	}
+
+	if strings.TrimSpace(value) == "" {
+		delete(server, "port")
+		return &Change{Path: path, Old: `""`}, nil
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("%s: the port must be a number, got '%s'", path, value)
+	}
+	server["port"] = port
+	return &Change{Path: path, Old: strconv.Quote(value), New: strconv.Itoa(port)}, nil
+}
+
+// sortedKeys returns the keys of the map in a stable order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// asInt converts the numbers returned by the json, yaml and toml parsers to int
+func asInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	case int:
+		return v, true
+	default:
+		return 0, false
+	}
+}
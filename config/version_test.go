@@ -0,0 +1,164 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigratePlainListV1(t *testing.T) {
+	data := []byte(`[
+  {"group": "billing", "env": "prod", "tag": "web1", "server": {"host": "web1.int", "port": "2222", "dir": "/", "username": "deploy", "password": ""}},
+  {"group": "billing", "env": "prod", "tag": "web2", "server": {"host": "web2.int", "port": " ", "dir": "/", "username": "deploy", "password": ""}}
+]`)
+	migrated, changes, err := Migrate(data, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migrated.Version != Version {
+		t.Errorf("version = %d, want %d", migrated.Version, Version)
+	}
+	if len(migrated.Entries) != 2 || migrated.Entries[0].Server.Port != 2222 || migrated.Entries[1].Server.Port != 0 {
+		t.Fatalf("unexpected entries %+v", migrated.Entries)
+	}
+	if resolved, _ := migrated.Resolve(&migrated.Entries[1]); resolved.Port != DefaultPort {
+		t.Errorf("the removed port resolves to %d, want %d", resolved.Port, DefaultPort)
+	}
+
+	want := []Change{
+		{Path: "entries", Old: "plain list of entries", New: "list of entries in a versioned document"},
+		{Path: "version", New: "2"},
+		{Path: "entries[0].server.port (tag 'web1')", Old: `"2222"`, New: "2222"},
+		{Path: "entries[1].server.port (tag 'web2')", Old: `""`},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestMigrateDefaultPortsV1(t *testing.T) {
+	data := []byte(`defaults:
+  global: { port: "2200" }
+  groups:
+    web: { port: "2201" }
+  group_envs:
+    web:
+      prod: { port: "" }
+entries:
+  - group: web
+    env: prod
+    tag: web1
+    server: { host: web1.int, port: 22 }
+`)
+	migrated, changes, err := Migrate(data, YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port := migrated.Defaults.Global.Port; port != 2200 {
+		t.Errorf("global port = %d, want 2200", port)
+	}
+	if port := migrated.Defaults.Groups["web"].Port; port != 2201 {
+		t.Errorf("group port = %d, want 2201", port)
+	}
+	if port := migrated.Entries[0].Server.Port; port != 22 {
+		t.Errorf("numeric ports must be kept, got %d", port)
+	}
+
+	want := []Change{
+		{Path: "version", New: "2"},
+		{Path: "defaults.global.port", Old: `"2200"`, New: "2200"},
+		{Path: "defaults.groups.web.port", Old: `"2201"`, New: "2201"},
+		{Path: "defaults.group_envs.web.prod.port", Old: `""`},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestMigrateCurrentVersion(t *testing.T) {
+	data := []byte(`{"version": 2, "entries": [{"group": "g", "env": "e", "tag": "a", "server": {"host": "h", "port": 22, "dir": "", "username": "", "password": ""}}]}`)
+	migrated, changes, err := Migrate(data, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("a current config must not be changed, got %v", changes)
+	}
+	if migrated.Entries[0].Server.Port != 22 {
+		t.Errorf("port = %d, want 22", migrated.Entries[0].Server.Port)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"invalid port", `[{"group": "g", "env": "e", "tag": "a", "server": {"host": "h", "port": "ssh"}}]`, "entries[0].server.port (tag 'a'): the port must be a number, got 'ssh'"},
+		{"invalid default port", `{"defaults": {"global": {"port": "x"}}, "entries": []}`, "defaults.global.port: the port must be a number, got 'x'"},
+		{"newer version", `{"version": 3, "entries": []}`, "supports version 2 at most"},
+		{"unknown version", `{"version": 0, "entries": []}`, "unknown version 0"},
+		{"version no number", `{"version": "two", "entries": []}`, "the version must be a number"},
+		{"no object", `"entries"`, "expected an object or a list of entries"},
+	}
+	for _, test := range tests {
+		_, _, err := Migrate([]byte(test.data), JSON)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %q doesn't contain %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestUpgradeV1(t *testing.T) {
+	upgraded, changes, err := upgradeV1(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"version": Version, "entries": []interface{}{}}; !reflect.DeepEqual(upgraded, want) {
+		t.Errorf("upgraded empty document = %v, want %v", upgraded, want)
+	}
+	if want := []Change{{Path: "version", New: "2"}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+
+	doc := map[string]interface{}{
+		"entries": []interface{}{
+			map[string]interface{}{"tag": "a", "server": map[string]interface{}{"port": "22"}},
+			"no element",
+			map[string]interface{}{"server": map[string]interface{}{"port": 2222}},
+		},
+	}
+	upgraded, changes, err = upgradeV1(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := upgraded["entries"].([]interface{})
+	if port := entries[0].(map[string]interface{})["server"].(map[string]interface{})["port"]; port != 22 {
+		t.Errorf("port = %v, want the number 22", port)
+	}
+	if want := (Change{Path: "entries[0].server.port (tag 'a')", Old: `"22"`, New: "22"}); len(changes) != 2 || changes[1] != want {
+		t.Errorf("changes = %v, want the version and %v", changes, want)
+	}
+}
+
+func TestResolveDefaultPort(t *testing.T) {
+	config := JimConfig{Version: Version, Entries: []JimConfigElement{
+		{Group: "g", Env: "e", Tag: "a", Server: JimConfigEntry{Host: "h"}},
+	}}
+	resolved, sources := config.Resolve(&config.Entries[0])
+	if resolved.Port != DefaultPort || sources["port"] != "the default ssh port" {
+		t.Errorf("port = %d from %q, want %d from the default", resolved.Port, sources["port"], DefaultPort)
+	}
+
+	config.Defaults = &JimDefaults{Global: &JimConfigEntry{Port: 2200}}
+	if resolved, _ := config.Resolve(&config.Entries[0]); resolved.Port != 2200 {
+		t.Errorf("port = %d, want the default 2200", resolved.Port)
+	}
+}
@@ -1,13 +1,31 @@
 package domain
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Match is used in the client server communication as the reponse format of the connect command
 type Match struct {
 	Tag    string
 	Server Server
+	// Jumps lists the jump hosts to connect through, starting with the first hop
+	Jumps []Hop
+	// Labels holds the labels of the entry
+	Labels map[string]string
+	// Aliases lists the further names of the entry
+	Aliases []string
+}
+
+// Hop is a jump host on the way to the matched server
+type Hop struct {
+	Tag    string
+	Server Server
 }
 
 // Server holds all the information necessary to connect to a server via ssh
@@ -17,6 +35,103 @@ type Server struct {
 	Port     int
 	Username string
 	Password []byte
+	// PrivateKey holds the unencrypted private key in PEM format, if the server uses key authentication
+	PrivateKey []byte
+	// HostKeys holds the pinned host keys in authorized_keys format
+	HostKeys []string
+	// Forwards lists the port forwards declared for the server
+	Forwards []Forward
+	// Record is true, if connect sessions have to be recorded
+	Record bool
+	// Shell is the shell started for interactive sessions. Empty, if the login shell is used.
+	Shell string
+	// StartupCommand is run before the shell of an interactive session is started
+	StartupCommand string
+	// Env holds environment variables set for sessions
+	Env map[string]string
+	// Sources maps the names of the settings in the config file to the level they were taken from,
+	// e.g. the entry itself or the defaults of its group. Environment variables are keyed by env.NAME.
+	Sources map[string]string
+}
+
+const (
+	// LocalForward listens on the local machine and forwards to an address reachable from the server, like ssh -L
+	LocalForward = "local"
+	// RemoteForward listens on the server and forwards to an address reachable from the local machine, like ssh -R
+	RemoteForward = "remote"
+)
+
+// Forward describes a port forward through a server
+type Forward struct {
+	// Type is either LocalForward or RemoteForward
+	Type string
+	// Listen is the address to listen on in the format [bind_address:]port
+	Listen string
+	// Target is the address to forward connections to in the format host:port
+	Target string
+}
+
+// ListenAddress returns the address to listen on. Binds to the loopback interface, if only a port is given.
+func (f Forward) ListenAddress() string {
+	if _, err := strconv.Atoi(f.Listen); err == nil {
+		return net.JoinHostPort("localhost", f.Listen)
+	}
+	return f.Listen
+}
+
+// Validate checks the type and addresses of the forward
+func (f Forward) Validate() error {
+	if f.Type != LocalForward && f.Type != RemoteForward {
+		return errors.Errorf("unknown forward type '%s', must be '%s' or '%s'", f.Type, LocalForward, RemoteForward)
+	}
+	if _, port, err := net.SplitHostPort(f.ListenAddress()); err != nil || !isValidPort(port) {
+		return errors.Errorf("invalid listen address '%s', must be [bind_address:]port", f.Listen)
+	}
+	if _, port, err := net.SplitHostPort(f.Target); err != nil || !isValidPort(port) {
+		return errors.Errorf("invalid target address '%s', must be host:port", f.Target)
+	}
+	return nil
+}
+
+func (f Forward) String() string {
+	if f.Type == RemoteForward {
+		return fmt.Sprintf("R %s -> %s", f.ListenAddress(), f.Target)
+	}
+	return fmt.Sprintf("L %s -> %s", f.ListenAddress(), f.Target)
+}
+
+func isValidPort(port string) bool {
+	p, err := strconv.Atoi(port)
+	return err == nil && p >= 0 && p <= 65535
+}
+
+const (
+	TunnelConnecting = iota
+	TunnelUp
+	TunnelReconnecting
+)
+
+// Tunnel describes a port forward kept open by the daemon
+type Tunnel struct {
+	ID      int
+	Tag     string
+	Forward Forward
+	State   int
+	// Since is the time, the tunnel was started
+	Since time.Time
+	// Connections is the number of currently forwarded connections
+	Connections int
+	// BytesSent counts the bytes forwarded towards the target, BytesReceived the bytes from the target
+	BytesSent     int64
+	BytesReceived int64
+	// LastError describes why the latest connection attempt failed or the connection broke down
+	LastError string
+}
+
+// HostKeys lists the pinned host keys of a config entry
+type HostKeys struct {
+	Tag  string
+	Keys []string
 }
 
 type GroupList []Group
@@ -42,6 +157,30 @@ func (a ConnectionList) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 type ConnectionInfo struct {
 	Tag      string
 	HostInfo string
+	// Source is the config file declaring the entry
+	Source string
+	// Aliases lists the further names of the entry
+	Aliases []string
+}
+
+// TagConflict describes a tag declared by multiple config files
+type TagConflict struct {
+	Tag string
+	// Sources lists the config files declaring the tag, the entry of the first one is used
+	Sources []string
+}
+
+const (
+	ImportAdded = iota
+	ImportUpdated
+	ImportSkipped
+)
+
+// ImportedEntry tells, what happened to an imported entry
+type ImportedEntry struct {
+	Tag string
+	// Action is one of ImportAdded, ImportUpdated or ImportSkipped
+	Action int
 }
 
 const (
@@ -79,12 +218,24 @@ func NewServerState(state int) (*ServerState, error) {
 	}
 }
 
+var labelName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedLabelNames are the filter categories, which can't be used as label names
+var reservedLabelNames = map[string]bool{"group": true, "env": true, "host": true, "tag": true}
+
+// IsValidLabelName returns true, if name can be used as name of a label and filtered by
+func IsValidLabelName(name string) bool {
+	return labelName.MatchString(name) && !reservedLabelNames[strings.ToLower(name)]
+}
+
 type Filter struct {
 	EnvFilter   string
 	GroupFilter string
 	TagFilter   string
 	HostFilter  string
 	FreeFilter  string
+	// LabelFilters maps the names of labels to the filtered values
+	LabelFilters map[string]string
 }
 
 func NewFilter(envFilter string, groupFilter string, tagFilter string, hostFilter string, freeFilter string) Filter {
@@ -117,8 +268,12 @@ func (f Filter) HasFreeFilter() bool {
 	return f.FreeFilter != ""
 }
 
+func (f Filter) HasLabelFilters() bool {
+	return len(f.LabelFilters) != 0
+}
+
 func (f Filter) IsAnyFilterSet() bool {
-	return f.HasEnvFilter() || f.HasTagFilter() || f.HasGroupFilter() || f.HasHostFilter() || f.HasFreeFilter()
+	return f.HasEnvFilter() || f.HasTagFilter() || f.HasGroupFilter() || f.HasHostFilter() || f.HasFreeFilter() || f.HasLabelFilters()
 }
 
 type Step = int
@@ -130,6 +285,8 @@ const (
 	Validate
 	BuildIndex
 	Done
+	// PasswordRequired reports, that the remaining config files require another password
+	PasswordRequired
 )
 
 // DecryptStep holds updates given by the server
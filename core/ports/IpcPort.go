@@ -6,13 +6,16 @@ import (
 
 // IpcPort defines the port for the interprocess communication with the jim daemon.
 type IpcPort interface {
-	// LoadConfigFile requests the daemon process to load a config file
-	LoadConfigFile(path string) error
+	// LoadConfigFiles requests the daemon process to load the config files, ordered by precedence
+	LoadConfigFiles(paths []string) error
 	// AttemptDecryption requests a decryption attempt from the daemon, using the passed password
 	AttemptDecryption(password []byte) (chan domain.DecryptStep, error)
 	// GetMatchingServer requests a server entry from the daemon, that matches the given query string.
 	// Requires the daemon to be in ready state.
 	GetMatchingServer(query string) (*domain.Match, error)
+	// GetMatchingServers requests all server entries from the daemon, that match the filter.
+	// Requires the daemon to be in ready state.
+	GetMatchingServers(filter *domain.Filter, limit int) ([]domain.Match, error)
 	// GetEntries requests all entries of the loaded config from the daemon.
 	// Requires the daemon to be in ready state.
 	GetEntries(filter *domain.Filter, limit int) (*domain.GroupList, error)
@@ -22,6 +25,39 @@ type IpcPort interface {
 	// IsServerReady queries the server state. The server is in ready state,
 	// if a config file was loaded successfully and decrypted.
 	IsServerReady() bool
+	// GetHostKeys requests the pinned host keys from the daemon. An empty tag returns the keys of all entries.
+	// Requires the daemon to be in ready state.
+	GetHostKeys(tag string) ([]domain.HostKeys, error)
+	// AddHostKey requests the daemon to pin the host key in authorized_keys format for the entry with given tag.
+	// Requires the daemon to be in ready state.
+	AddHostKey(tag string, key string) error
+	// RevokeHostKey requests the daemon to remove the host key with given fingerprint from the entry with given tag.
+	// An empty fingerprint removes all keys. Requires the daemon to be in ready state.
+	RevokeHostKey(tag string, fingerprint string) error
+	// ImportHostKeys requests the daemon to pin the host keys listed in the known_hosts file at path.
+	// Returns the newly pinned keys. Requires the daemon to be in ready state.
+	ImportHostKeys(path string) ([]domain.HostKeys, error)
+	// StartTunnels requests the daemon to open the forwards through the entry with given tag.
+	// Without forwards, the forwards declared for the entry are opened. Requires the daemon to be in ready state.
+	StartTunnels(tag string, forwards []domain.Forward) ([]domain.Tunnel, error)
+	// StopTunnels requests the daemon to close the tunnels with given ids, all tunnels of the entry with given tag,
+	// or all tunnels if all is set. Returns the closed tunnels.
+	StopTunnels(ids []int, tag string, all bool) ([]domain.Tunnel, error)
+	// GetTunnels requests all open tunnels from the daemon
+	GetTunnels() ([]domain.Tunnel, error)
+	// GetRecordingKey requests the key to encrypt and decrypt recordings from the daemon. Returns nil, if there is none.
+	// If create is set and recordings are to be encrypted, a missing key is created. Requires the daemon to be in ready state.
+	GetRecordingKey(create bool) ([]byte, error)
+	// GetConflicts requests the tags declared by multiple config files from the daemon.
+	// Requires the daemon to be in ready state.
+	GetConflicts() ([]domain.TagConflict, error)
+	// ImportEntries makes the daemon merge the entries and keys of the config into the config files.
+	// Existing entries are only updated, if update is set. With dryRun set, the config files are not modified.
+	// Requires the daemon to be in ready state.
+	ImportEntries(jimConfig []byte, update bool, dryRun bool) ([]domain.ImportedEntry, error)
+	// ReloadRekeyedFile requests the daemon to read the config file at path again, after its password or
+	// key slots changed. A decrypted config file stays decrypted.
+	ReloadRekeyedFile(path string, password []byte) error
 	// ServerStatus queries and returns the server state.
 	ServerStatus() (*domain.ServerState, error)
 	// Close closes the underlying ipc connection
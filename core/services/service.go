@@ -2,11 +2,13 @@ package services
 
 import (
 	factory "github.com/CryoCodec/jim/adapters"
+	"github.com/CryoCodec/jim/config"
 	"github.com/CryoCodec/jim/core/domain"
 	"github.com/CryoCodec/jim/core/ports"
 	"github.com/CryoCodec/jim/files"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -20,6 +22,10 @@ type UiService interface {
 	// Requires the daemon to be in ready state.
 	GetMatchingServer(query string) (*domain.Match, error)
 
+	// GetMatchingServers requests all server entries from the daemon, that match the filters.
+	// Accepts the same filters as GetEntries. Requires the daemon to be in ready state.
+	GetMatchingServers(filters []string, limit int) ([]domain.Match, error)
+
 	// MatchClosestN gets a list of n potentially matching entries in the config file.
 	// Requires the daemon to be in ready state.
 	MatchClosestN(query string) []string
@@ -29,11 +35,58 @@ type UiService interface {
 	// to accept a password.
 	Decrypt(password []byte) (chan domain.DecryptStep, error)
 
-	// ReloadConfigFile makes the server reload the config file.
+	// ReloadConfigFile makes the server reload the config files.
 	// This method sets the server to a new state, requiring a password
 	// for decryption.
 	ReloadConfigFile() error
 
+	// GetHostKeys fetches the pinned host keys. An empty tag returns the keys of all entries.
+	// Requires the daemon to be in ready state.
+	GetHostKeys(tag string) ([]domain.HostKeys, error)
+
+	// AddHostKey pins the host key in authorized_keys format for the entry with given tag.
+	// Requires the daemon to be in ready state.
+	AddHostKey(tag string, key string) error
+
+	// RevokeHostKey removes the host key with given fingerprint from the entry with given tag.
+	// An empty fingerprint removes all keys. Requires the daemon to be in ready state.
+	RevokeHostKey(tag string, fingerprint string) error
+
+	// ImportHostKeys pins the host keys listed in the known_hosts file at path for all matching entries.
+	// Returns the newly pinned keys. Requires the daemon to be in ready state.
+	ImportHostKeys(path string) ([]domain.HostKeys, error)
+
+	// StartTunnels opens the forwards through the entry with given tag, which the daemon keeps open
+	// until they are stopped or the vault is locked. Without forwards, the forwards declared for the entry are opened.
+	// Requires the daemon to be in ready state.
+	StartTunnels(tag string, forwards []domain.Forward) ([]domain.Tunnel, error)
+
+	// StopTunnels closes the tunnels with given ids, all tunnels of the entry with given tag,
+	// or all tunnels if all is set. Returns the closed tunnels.
+	StopTunnels(ids []int, tag string, all bool) ([]domain.Tunnel, error)
+
+	// GetTunnels fetches all tunnels kept open by the daemon, sorted by id.
+	GetTunnels() ([]domain.Tunnel, error)
+
+	// GetRecordingKey fetches the key to encrypt and decrypt recordings. Returns nil, if there is none.
+	// If create is set and recordings are to be encrypted, a missing key is created.
+	// Requires the daemon to be in ready state.
+	GetRecordingKey(create bool) ([]byte, error)
+
+	// GetConflicts fetches the tags declared by multiple config files.
+	// Requires the daemon to be in ready state.
+	GetConflicts() ([]domain.TagConflict, error)
+
+	// ImportEntries merges the entries and keys of the config into the config files. Entries, whose tag already exists,
+	// are skipped unless update is set. With dryRun set, the result is validated without modifying the config files.
+	// Requires the daemon to be in ready state.
+	ImportEntries(jimConfig *config.JimConfig, update bool, dryRun bool) ([]domain.ImportedEntry, error)
+
+	// ReloadRekeyedFile makes the daemon read the config file at path again, after its password or key slots
+	// changed. The path has to be given as listed in JIM_CONFIG_FILE.
+	// A decrypted config file stays decrypted, so the vault doesn't have to be unlocked again.
+	ReloadRekeyedFile(path string, password []byte) error
+
 	// IsServerReady queries the server state. If it has successfully loaded the
 	// config file and is decrypted, it is considered ready.
 	IsServerReady() bool
@@ -73,6 +126,21 @@ func (u *UiServiceImpl) GetMatchingServer(query string) (*domain.Match, error) {
 	return u.ipcPort.GetMatchingServer(query)
 }
 
+func (u *UiServiceImpl) GetMatchingServers(filters []string, limit int) ([]domain.Match, error) {
+	filter, err := parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := u.ipcPort.GetMatchingServers(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Tag < matches[j].Tag })
+	return matches, nil
+}
+
 func (u *UiServiceImpl) MatchClosestN(query string) []string {
 	return u.ipcPort.MatchClosestN(query)
 }
@@ -89,12 +157,12 @@ func (u *UiServiceImpl) Decrypt(password []byte) (chan domain.DecryptStep, error
 }
 
 func (u *UiServiceImpl) ReloadConfigFile() error {
-	path, err := files.GetJimConfigFilePath()
+	paths, err := files.GetJimConfigFilePaths()
 	if err != nil {
 		return err
 	}
 
-	err = u.ipcPort.LoadConfigFile(path)
+	err = u.ipcPort.LoadConfigFiles(paths)
 	if err != nil {
 		return err
 	}
@@ -102,6 +170,60 @@ func (u *UiServiceImpl) ReloadConfigFile() error {
 	return nil
 }
 
+func (u *UiServiceImpl) GetHostKeys(tag string) ([]domain.HostKeys, error) {
+	return u.ipcPort.GetHostKeys(tag)
+}
+
+func (u *UiServiceImpl) AddHostKey(tag string, key string) error {
+	return u.ipcPort.AddHostKey(tag, key)
+}
+
+func (u *UiServiceImpl) RevokeHostKey(tag string, fingerprint string) error {
+	return u.ipcPort.RevokeHostKey(tag, fingerprint)
+}
+
+func (u *UiServiceImpl) ImportHostKeys(path string) ([]domain.HostKeys, error) {
+	// the daemon runs in a different working directory
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return u.ipcPort.ImportHostKeys(absPath)
+}
+
+func (u *UiServiceImpl) StartTunnels(tag string, forwards []domain.Forward) ([]domain.Tunnel, error) {
+	return u.ipcPort.StartTunnels(tag, forwards)
+}
+
+func (u *UiServiceImpl) StopTunnels(ids []int, tag string, all bool) ([]domain.Tunnel, error) {
+	return u.ipcPort.StopTunnels(ids, tag, all)
+}
+
+func (u *UiServiceImpl) GetTunnels() ([]domain.Tunnel, error) {
+	tunnels, err := u.ipcPort.GetTunnels()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].ID < tunnels[j].ID })
+	return tunnels, nil
+}
+
+func (u *UiServiceImpl) GetRecordingKey(create bool) ([]byte, error) {
+	return u.ipcPort.GetRecordingKey(create)
+}
+
+func (u *UiServiceImpl) GetConflicts() ([]domain.TagConflict, error) {
+	return u.ipcPort.GetConflicts()
+}
+
+func (u *UiServiceImpl) ImportEntries(jimConfig *config.JimConfig, update bool, dryRun bool) ([]domain.ImportedEntry, error) {
+	data, err := jimConfig.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return u.ipcPort.ImportEntries(data, update, dryRun)
+}
+
 func (u *UiServiceImpl) IsServerReady() bool {
 	return u.ipcPort.IsServerReady()
 }
@@ -114,6 +236,11 @@ func (u *UiServiceImpl) GetState() (*domain.ServerState, error) {
 
 	return state, nil
 }
+
+func (u *UiServiceImpl) ReloadRekeyedFile(path string, password []byte) error {
+	return u.ipcPort.ReloadRekeyedFile(path, password)
+}
+
 func (u *UiServiceImpl) ShutDown() {
 	u.ipcPort.Close()
 }
@@ -154,7 +281,14 @@ func parseFilters(filters []string) (*domain.Filter, error) {
 		case "host":
 			filter.HostFilter = slice[1]
 		default:
-			return nil, errors.Errorf("Encountered invalid filter category: %s in %s", slice[1], filterString)
+			// every other category filters a label
+			if !domain.IsValidLabelName(slice[0]) {
+				return nil, errors.Errorf("Encountered invalid filter category: %s in %s", slice[0], filterString)
+			}
+			if filter.LabelFilters == nil {
+				filter.LabelFilters = make(map[string]string)
+			}
+			filter.LabelFilters[slice[0]] = slice[1]
 		}
 	}
 	return filter, nil
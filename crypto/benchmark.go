@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	// minArgon2idMemory is the least memory in KiB CalibrateKDF picks for Argon2id
+	minArgon2idMemory = 16 * 1024
+	// maxScryptN bounds CalibrateKDF for scrypt, it takes 1 GiB of memory with r=8
+	maxScryptN = 1 << 20
+)
+
+// CalibrateKDF measures the key derivation on this machine and returns parameters, which take about target
+// to derive a key. Argon2id keeps the default memory, unless a single pass already takes longer than target,
+// and raises the number of passes. Scrypt raises N. The returned duration is the measured time of the parameters.
+func CalibrateKDF(algorithm KDFAlgorithm, target time.Duration) (KDFParams, time.Duration, error) {
+	if algorithm == KDFScrypt {
+		return calibrateScrypt(target)
+	}
+	return calibrateArgon2id(target)
+}
+
+func calibrateArgon2id(target time.Duration) (KDFParams, time.Duration, error) {
+	params := DefaultArgon2idParams
+	params.Time = 1
+	if threads := runtime.NumCPU(); threads < params.Threads {
+		params.Threads = threads
+	}
+
+	elapsed, err := measure(params)
+	if err != nil {
+		return params, 0, err
+	}
+	for elapsed > target && params.Memory/2 >= minArgon2idMemory {
+		params.Memory /= 2
+		if elapsed, err = measure(params); err != nil {
+			return params, 0, err
+		}
+	}
+
+	// the time grows linearly with the passes
+	if passes := int((target + elapsed/2) / elapsed); passes > 1 {
+		params.Time = passes
+		if params.Time > 1000 {
+			params.Time = 1000
+		}
+		if elapsed, err = measure(params); err != nil {
+			return params, 0, err
+		}
+	}
+	return params, elapsed, nil
+}
+
+func calibrateScrypt(target time.Duration) (KDFParams, time.Duration, error) {
+	params := DefaultScryptParams
+	params.N = 1 << 14
+
+	elapsed, err := measure(params)
+	if err != nil {
+		return params, 0, err
+	}
+	// the time grows linearly with N, stop before doubling N overshoots the target by more than undershooting it
+	for elapsed*3/2 < target && params.N < maxScryptN {
+		params.N *= 2
+		if elapsed, err = measure(params); err != nil {
+			return params, 0, err
+		}
+	}
+	return params, elapsed, nil
+}
+
+func measure(params KDFParams) (time.Duration, error) {
+	start := time.Now()
+	if _, err := deriveKey([]byte("benchmark"), make([]byte, legacySaltSize), params); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,426 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+)
+
+// An encrypted file starts with a header, which describes how the file was encrypted.
+// The contents are encrypted with a random data key, which is wrapped by up to MaxSlots key slots.
+// All numbers are big endian:
+//
+//	magic    4 bytes  "JIME"
+//	version  1 byte   FormatVersion
+//	slots    1 byte count, followed by the slots
+//	nonce    1 byte length, followed by the nonce of the contents
+//
+// Each slot wraps the data key with AES-GCM under a key derived from the secret of the slot,
+// slots of recipients derive it from an X25519 key exchange, see recipients.go.
+// Magic, version and the slot up to the wrapped key are authenticated as additional data of the wrapped key:
+//
+//	type     1 byte   SlotType
+//	kdf      1 byte   KDFAlgorithm
+//	params   2 bytes length, followed by the parameters of the KDF
+//	salt     1 byte length, followed by the salt
+//	wrapped  1 byte length, followed by nonce, encrypted data key and GCM tag
+//
+// The cipher text including the GCM tag follows the header, magic and version are its additional data.
+// So slots can be added and removed without encrypting the contents again.
+//
+// Version 1 files derive the key of the contents directly from the password and lack the slots,
+// instead kdf, params and salt follow the version. The whole header is their additional data.
+// Files written before the header was introduced consist of nonce, cipher text and a salt of 32 bytes,
+// their key was derived by scrypt with N=2^20, r=8, p=1.
+var magic = []byte("JIME")
+
+// FormatVersion is the version of the header written by Encrypt
+const FormatVersion = 2
+
+// passwordFormatVersion is the version of files encrypted with a key derived from the password
+const passwordFormatVersion = 1
+
+// MaxSlots is the maximum number of key slots of a file
+const MaxSlots = 8
+
+const (
+	nonceSize      = 12
+	tagSize        = 16
+	legacySaltSize = 32
+	minSaltSize    = 16
+)
+
+// KDFAlgorithm identifies the function, which derives the key from the password
+type KDFAlgorithm byte
+
+const (
+	// KDFScrypt derives keys with scrypt, its parameters are encoded as N, r and p of 4 bytes each
+	KDFScrypt KDFAlgorithm = 1
+	// KDFArgon2id derives keys with Argon2id, its parameters are encoded as time and memory of 4 bytes each
+	// followed by the threads as 1 byte
+	KDFArgon2id KDFAlgorithm = 2
+	// KDFHKDF derives keys from secrets with high entropy, like keyfiles, with HKDF-SHA256. It has no parameters.
+	KDFHKDF KDFAlgorithm = 3
+	// KDFX25519 derives keys of recipient slots from the X25519 shared secret, see recipients.go. It has no parameters.
+	KDFX25519 KDFAlgorithm = 4
+)
+
+// KDFAlgorithms lists the names of the supported algorithms
+var KDFAlgorithms = []string{KDFArgon2id.String(), KDFScrypt.String()}
+
+func (a KDFAlgorithm) String() string {
+	switch a {
+	case KDFScrypt:
+		return "scrypt"
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFHKDF:
+		return "hkdf-sha256"
+	case KDFX25519:
+		return "x25519"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseKDFAlgorithm returns the algorithm of given name
+func ParseKDFAlgorithm(name string) (KDFAlgorithm, error) {
+	for _, a := range []KDFAlgorithm{KDFScrypt, KDFArgon2id} {
+		if strings.EqualFold(name, a.String()) {
+			return a, nil
+		}
+	}
+	return 0, errors.Errorf("unknown key derivation function '%s', use one of: %s", name, strings.Join(KDFAlgorithms, ", "))
+}
+
+// KDFParams are the parameters of the key derivation
+type KDFParams struct {
+	Algorithm KDFAlgorithm
+	// N is the CPU/memory cost, r the block size and p the parallelization of scrypt
+	N, R, P int
+	// Time is the number of passes, Memory the memory in KiB and Threads the parallelism of Argon2id
+	Time, Memory, Threads int
+}
+
+// DefaultScryptParams equal the parameters of legacy files
+var DefaultScryptParams = KDFParams{Algorithm: KDFScrypt, N: 1 << 20, R: 8, P: 1}
+
+// DefaultArgon2idParams follow the recommendation of RFC 9106 for memory constrained environments
+var DefaultArgon2idParams = KDFParams{Algorithm: KDFArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// DefaultKDFParams are used by Encrypt
+var DefaultKDFParams = DefaultArgon2idParams
+
+// DefaultParams returns the default parameters of an algorithm
+func DefaultParams(algorithm KDFAlgorithm) KDFParams {
+	if algorithm == KDFScrypt {
+		return DefaultScryptParams
+	}
+	return DefaultArgon2idParams
+}
+
+func (p KDFParams) String() string {
+	switch p.Algorithm {
+	case KDFScrypt:
+		return fmt.Sprintf("scrypt (N=%d, r=%d, p=%d)", p.N, p.R, p.P)
+	case KDFArgon2id:
+		return fmt.Sprintf("argon2id (time=%d, memory=%d MiB, threads=%d)", p.Time, p.Memory/1024, p.Threads)
+	default:
+		return p.Algorithm.String()
+	}
+}
+
+// Header describes an encrypted file
+type Header struct {
+	// Version is the format version, 0 for files without header
+	Version int
+	// Slots wrap the data key. Files of older versions have a single password slot, which derives the key
+	// of the contents directly.
+	Slots []Slot
+	// nonce of the contents
+	nonce []byte
+	// aad is the additional data of the contents
+	aad []byte
+}
+
+var (
+	// ErrTruncated is returned for data, which is too short to be an encrypted file
+	ErrTruncated = errors.New("the file is truncated")
+	// ErrNotEncrypted is returned for data, which looks like plain text
+	ErrNotEncrypted = errors.New("the file is not encrypted")
+	// ErrDecryptionFailed is returned, if the password is wrong or the cipher text was modified
+	ErrDecryptionFailed = errors.New("wrong password or the file is damaged")
+)
+
+// ParseHeader reads the header of an encrypted file and returns it together with the cipher text.
+// Files without header are detected as legacy files with version 0.
+// It fails for truncated files, unknown versions and parameters outside of sane bounds,
+// which makes it cheap to check a file before asking for its password.
+func ParseHeader(data []byte) (Header, []byte, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return parseLegacy(data)
+	}
+
+	r := reader{data: data[len(magic):]}
+	version := int(r.byte())
+	if r.err != nil {
+		return Header{}, nil, r.err
+	}
+	header := Header{Version: version}
+	switch version {
+	case FormatVersion:
+		count := int(r.byte())
+		if r.err == nil && (count == 0 || count > MaxSlots) {
+			return Header{}, nil, errors.Errorf("invalid number of key slots %d", count)
+		}
+		for i := 0; i < count && r.err == nil; i++ {
+			start := r.data
+			slot, err := readSlot(&r, SlotType(r.byte()))
+			if err != nil {
+				return Header{}, nil, err
+			}
+			wrapped := r.bytes(int(r.byte()))
+			if r.err == nil && len(wrapped) != nonceSize+KeySize+tagSize {
+				return Header{}, nil, errors.Errorf("invalid size %d of the wrapped key in slot %d", len(wrapped), i)
+			}
+			slot.wrapped = wrapped
+			slot.aad = append(append([]byte(nil), data[:len(magic)+1]...), start[:len(start)-len(r.data)-len(wrapped)-1]...)
+			header.Slots = append(header.Slots, slot)
+		}
+		header.nonce = r.bytes(int(r.byte()))
+		header.aad = data[:len(magic)+1]
+	case passwordFormatVersion:
+		slot, err := readSlot(&r, SlotPassword)
+		if err != nil {
+			return Header{}, nil, err
+		}
+		header.Slots = []Slot{slot}
+		header.nonce = r.bytes(int(r.byte()))
+		if r.err == nil {
+			header.aad = data[:len(data)-len(r.data)]
+		}
+	default:
+		return Header{}, nil, errors.Errorf("the file has the unsupported format version %d, update jim to read it", version)
+	}
+	if r.err != nil {
+		return Header{}, nil, r.err
+	}
+	if len(header.nonce) != nonceSize {
+		return Header{}, nil, errors.Errorf("invalid nonce size %d, expected %d bytes", len(header.nonce), nonceSize)
+	}
+	if len(r.data) < tagSize {
+		return Header{}, nil, ErrTruncated
+	}
+	return header, r.data, nil
+}
+
+// readSlot reads KDF and salt of a slot of given type
+func readSlot(r *reader, slotType SlotType) (Slot, error) {
+	algorithm := KDFAlgorithm(r.byte())
+	params := r.bytes(int(r.uint16()))
+	salt := r.bytes(int(r.byte()))
+	if r.err != nil {
+		return Slot{}, r.err
+	}
+	if slotType < SlotPassword || slotType > SlotRecipient {
+		return Slot{}, errors.Errorf("the file uses the unknown key slot type %d, update jim to read it", slotType)
+	}
+	kdf, err := decodeKDFParams(algorithm, params)
+	if err != nil {
+		return Slot{}, err
+	}
+	if len(salt) < minSaltSize {
+		return Slot{}, errors.Errorf("the salt of %d bytes is too short", len(salt))
+	}
+	// only recipient slots derive their key from X25519, their salt holds two public keys
+	if (slotType == SlotRecipient) != (kdf.Algorithm == KDFX25519) {
+		return Slot{}, errors.Errorf("the key derivation function %s doesn't fit the %s slot", kdf.Algorithm, slotType)
+	}
+	if slotType == SlotRecipient && len(salt) != 2*curve25519.PointSize {
+		return Slot{}, errors.Errorf("invalid salt size %d of the recipient slot", len(salt))
+	}
+	return Slot{Type: slotType, KDF: kdf, salt: salt}, nil
+}
+
+// parseLegacy splits files without header into nonce, cipher text and salt
+func parseLegacy(data []byte) (Header, []byte, error) {
+	if looksLikeText(data) {
+		return Header{}, nil, ErrNotEncrypted
+	}
+	if len(data) < nonceSize+tagSize+legacySaltSize {
+		return Header{}, nil, ErrTruncated
+	}
+	header := Header{
+		Slots: []Slot{{Type: SlotPassword, KDF: DefaultScryptParams, salt: data[len(data)-legacySaltSize:]}},
+		nonce: data[:nonceSize],
+	}
+	return header, data[nonceSize : len(data)-legacySaltSize], nil
+}
+
+// encodeSlot writes the authenticated fields of a slot after magic and version
+func encodeSlot(slot *Slot) []byte {
+	params := encodeKDFParams(slot.KDF)
+	buf := bytes.NewBuffer(nil)
+	buf.Write(magic)
+	buf.WriteByte(FormatVersion)
+	buf.WriteByte(byte(slot.Type))
+	buf.WriteByte(byte(slot.KDF.Algorithm))
+	binary.Write(buf, binary.BigEndian, uint16(len(params)))
+	buf.Write(params)
+	buf.WriteByte(byte(len(slot.salt)))
+	buf.Write(slot.salt)
+	return buf.Bytes()
+}
+
+// encodeHeader writes the header of a file with given slots and nonce of the contents
+func encodeHeader(slots []Slot, nonce []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(magic)
+	buf.WriteByte(FormatVersion)
+	buf.WriteByte(byte(len(slots)))
+	for i := range slots {
+		buf.Write(slots[i].aad[len(magic)+1:])
+		buf.WriteByte(byte(len(slots[i].wrapped)))
+		buf.Write(slots[i].wrapped)
+	}
+	buf.WriteByte(byte(len(nonce)))
+	buf.Write(nonce)
+	return buf.Bytes()
+}
+
+func encodeKDFParams(params KDFParams) []byte {
+	if params.Algorithm == KDFHKDF || params.Algorithm == KDFX25519 {
+		return nil
+	}
+	if params.Algorithm == KDFArgon2id {
+		encoded := make([]byte, 9)
+		binary.BigEndian.PutUint32(encoded[0:], uint32(params.Time))
+		binary.BigEndian.PutUint32(encoded[4:], uint32(params.Memory))
+		encoded[8] = byte(params.Threads)
+		return encoded
+	}
+	encoded := make([]byte, 12)
+	binary.BigEndian.PutUint32(encoded[0:], uint32(params.N))
+	binary.BigEndian.PutUint32(encoded[4:], uint32(params.R))
+	binary.BigEndian.PutUint32(encoded[8:], uint32(params.P))
+	return encoded
+}
+
+func decodeKDFParams(algorithm KDFAlgorithm, encoded []byte) (KDFParams, error) {
+	var params KDFParams
+	switch algorithm {
+	case KDFScrypt:
+		if len(encoded) != 12 {
+			return KDFParams{}, errors.Errorf("invalid length %d of the scrypt parameters", len(encoded))
+		}
+		params = KDFParams{
+			Algorithm: KDFScrypt,
+			N:         int(binary.BigEndian.Uint32(encoded[0:])),
+			R:         int(binary.BigEndian.Uint32(encoded[4:])),
+			P:         int(binary.BigEndian.Uint32(encoded[8:])),
+		}
+	case KDFHKDF:
+		if len(encoded) != 0 {
+			return KDFParams{}, errors.Errorf("invalid length %d of the hkdf parameters", len(encoded))
+		}
+		params = KDFParams{Algorithm: KDFHKDF}
+	case KDFX25519:
+		if len(encoded) != 0 {
+			return KDFParams{}, errors.Errorf("invalid length %d of the x25519 parameters", len(encoded))
+		}
+		params = KDFParams{Algorithm: KDFX25519}
+	case KDFArgon2id:
+		if len(encoded) != 9 {
+			return KDFParams{}, errors.Errorf("invalid length %d of the argon2id parameters", len(encoded))
+		}
+		params = KDFParams{
+			Algorithm: KDFArgon2id,
+			Time:      int(binary.BigEndian.Uint32(encoded[0:])),
+			Memory:    int(binary.BigEndian.Uint32(encoded[4:])),
+			Threads:   int(encoded[8]),
+		}
+	default:
+		return KDFParams{}, errors.Errorf("the file uses the unknown key derivation function %d, update jim to read it", algorithm)
+	}
+	return params, params.Validate()
+}
+
+// Validate bounds the parameters, so a manipulated header can't make the daemon allocate unlimited memory
+// or compute for hours
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFScrypt:
+		if p.N < 2 || p.N > 1<<22 || p.N&(p.N-1) != 0 {
+			return errors.Errorf("invalid scrypt parameter N=%d, it has to be a power of 2 up to 2^22", p.N)
+		}
+		if p.R < 1 || p.P < 1 || p.R > 64 || p.P > 64 {
+			return errors.Errorf("invalid scrypt parameters r=%d, p=%d", p.R, p.P)
+		}
+	case KDFArgon2id:
+		if p.Threads < 1 || p.Threads > 255 {
+			return errors.Errorf("invalid argon2id threads %d, expected 1 to 255", p.Threads)
+		}
+		if p.Time < 1 || p.Time > 1000 {
+			return errors.Errorf("invalid argon2id time %d, expected 1 to 1000", p.Time)
+		}
+		if p.Memory < 8*p.Threads || p.Memory > 4*1024*1024 {
+			return errors.Errorf("invalid argon2id memory of %d KiB, expected %d KiB to 4 GiB", p.Memory, 8*p.Threads)
+		}
+	case KDFHKDF, KDFX25519:
+	default:
+		return errors.Errorf("unknown key derivation function %d", p.Algorithm)
+	}
+	return nil
+}
+
+// looksLikeText reports whether data is printable UTF-8, e.g. a config file, which was never encrypted
+func looksLikeText(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// reader reads the fields of the header and remembers, if it ran out of data
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = ErrTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
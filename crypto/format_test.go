@@ -0,0 +1,304 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+)
+
+// testParams keep the key derivation of the tests fast
+var testParams = KDFParams{Algorithm: KDFArgon2id, Time: 1, Memory: 8, Threads: 1}
+
+var testScryptParams = KDFParams{Algorithm: KDFScrypt, N: 2, R: 1, P: 1}
+
+// encryptV1 writes a version 1 file, whose contents are encrypted with a key derived from the password
+func encryptV1(t *testing.T, password, plaintext []byte, params KDFParams) []byte {
+	t.Helper()
+	salt := make([]byte, minSaltSize)
+	rand.Read(salt)
+	encoded := encodeKDFParams(params)
+
+	header := bytes.NewBuffer(nil)
+	header.Write(magic)
+	header.WriteByte(passwordFormatVersion)
+	header.WriteByte(byte(params.Algorithm))
+	binary.Write(header, binary.BigEndian, uint16(len(encoded)))
+	header.Write(encoded)
+	header.WriteByte(byte(len(salt)))
+	header.Write(salt)
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
+	header.WriteByte(byte(len(nonce)))
+	header.Write(nonce)
+
+	key, err := deriveKey(password, salt, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gcm.Seal(header.Bytes(), nonce, plaintext, header.Bytes())
+}
+
+// encryptLegacy writes a file without header: nonce, cipher text and salt
+func encryptLegacy(t *testing.T, password, plaintext []byte) []byte {
+	t.Helper()
+	salt := make([]byte, legacySaltSize)
+	rand.Read(salt)
+	key, err := deriveKey(password, salt, DefaultScryptParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
+	return append(gcm.Seal(nonce, nonce, plaintext, nil), salt...)
+}
+
+func TestParseHeaderVersions(t *testing.T) {
+	password := []byte("secret")
+	plaintext := []byte(`{"version": 2, "entries": []}`)
+
+	tests := []struct {
+		name    string
+		encrypt func(t *testing.T) []byte
+		version int
+		kdf     KDFParams
+	}{
+		{"v2", func(t *testing.T) []byte {
+			data, err := EncryptWithParams(password, plaintext, testParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return data
+		}, FormatVersion, testParams},
+		{"v1 argon2id", func(t *testing.T) []byte { return encryptV1(t, password, plaintext, testParams) }, passwordFormatVersion, testParams},
+		{"v1 scrypt", func(t *testing.T) []byte { return encryptV1(t, password, plaintext, testScryptParams) }, passwordFormatVersion, testScryptParams},
+		{"v0", func(t *testing.T) []byte {
+			if testing.Short() {
+				t.Skip("scrypt with the parameters of legacy files needs a GiB of memory")
+			}
+			return encryptLegacy(t, password, plaintext)
+		}, 0, DefaultScryptParams},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.encrypt(t)
+			header, _, err := ParseHeader(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Version != test.version {
+				t.Errorf("version = %d, want %d", header.Version, test.version)
+			}
+			if len(header.Slots) != 1 || header.Slots[0].Type != SlotPassword || header.Slots[0].KDF != test.kdf {
+				t.Errorf("slots = %+v, want a password slot with %s", header.Slots, test.kdf)
+			}
+
+			// each derivation of a legacy key takes seconds
+			if test.version != 0 {
+				if _, _, err := Open([]byte("wrong"), data); err != ErrDecryptionFailed {
+					t.Errorf("opening with a wrong password returned %v", err)
+				}
+			}
+			vault, opened, err := Open(password, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Errorf("opened %q, want %q", opened, plaintext)
+			}
+
+			// older files are written back in the current format, keeping the parameters of the password
+			upgraded := vault.Bytes()
+			if header, _, err := ParseHeader(upgraded); err != nil || header.Version != FormatVersion || header.Slots[0].KDF != test.kdf {
+				t.Errorf("the written file has the header %+v, %v", header, err)
+			}
+			if reopened, err := Decrypt(password, upgraded); err != nil || !bytes.Equal(reopened, plaintext) {
+				t.Errorf("reopening the written file returned %q, %v", reopened, err)
+			}
+		})
+	}
+}
+
+func TestParseHeaderTruncated(t *testing.T) {
+	data, err := EncryptWithParams([]byte("secret"), []byte("contents"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, ciphertext, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerSize := len(data) - len(ciphertext)
+	if header.Version != FormatVersion {
+		t.Fatalf("version = %d", header.Version)
+	}
+
+	for n := len(magic); n < headerSize+tagSize; n++ {
+		if _, _, err := ParseHeader(data[:n]); err != ErrTruncated {
+			t.Errorf("parsing the first %d of %d bytes returned %v, want ErrTruncated", n, len(data), err)
+		}
+	}
+
+	legacy := make([]byte, nonceSize+tagSize+legacySaltSize-1)
+	if _, _, err := ParseHeader(legacy); err != ErrTruncated {
+		t.Errorf("parsing a short file without header returned %v, want ErrTruncated", err)
+	}
+}
+
+func TestParseHeaderNotEncrypted(t *testing.T) {
+	for _, plaintext := range []string{
+		`{"version": 2, "entries": []}`,
+		"version: 2\nentries:\n  - tag: web1\n",
+		"[[entries]]\ntag = \"web1\"\n",
+		"JIM",
+	} {
+		if _, _, err := ParseHeader([]byte(plaintext)); err != ErrNotEncrypted {
+			t.Errorf("parsing %q returned %v, want ErrNotEncrypted", plaintext, err)
+		}
+	}
+}
+
+func TestParseHeaderInvalid(t *testing.T) {
+	data, err := EncryptWithParams([]byte("secret"), []byte("contents"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := func(offset int, value byte) []byte {
+		m := append([]byte(nil), data...)
+		m[offset] = value
+		return m
+	}
+
+	tests := map[string][]byte{
+		"unknown version":      modified(len(magic), 3),
+		"no slots":             modified(len(magic)+1, 0),
+		"too many slots":       modified(len(magic)+1, MaxSlots+1),
+		"unknown slot type":    modified(len(magic)+2, 9),
+		"unknown kdf":          modified(len(magic)+3, 9),
+		"x25519 password slot": modified(len(magic)+3, byte(KDFX25519)),
+	}
+	for name, data := range tests {
+		if _, _, err := ParseHeader(data); err == nil || err == ErrTruncated {
+			t.Errorf("%s: expected an error, got %v", name, err)
+		}
+	}
+
+	// the parameters of a v1 file follow magic, version, kdf and their length
+	huge := testParams
+	huge.Memory = 8 * 1024 * 1024
+	v1 := encryptV1(t, []byte("secret"), []byte("contents"), testParams)
+	copy(v1[len(magic)+4:], encodeKDFParams(huge))
+	if _, _, err := ParseHeader(v1); err == nil {
+		t.Errorf("expected an error for argon2id with %d KiB", huge.Memory)
+	}
+}
+
+func TestTamperedHeaderIsRejected(t *testing.T) {
+	password := []byte("secret")
+	plaintext := []byte("contents")
+
+	// a keyfile, which is a valid recovery key as well, derives the same key in a keyfile and a recovery slot
+	keyfile := []byte("ABCD-EFGH-IJKL-MNOP")
+	vault, err := NewVault(password, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddKeyfileSlot(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, ciphertext, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(keyfile, data); err != nil {
+		t.Fatalf("the keyfile doesn't open the file: %s", err)
+	}
+
+	t.Run("slot type", func(t *testing.T) {
+		tampered := append([]byte(nil), data...)
+		offset := bytes.Index(tampered, header.Slots[1].aad[len(magic)+1:])
+		tampered[offset] = byte(SlotRecovery)
+		if header, _, err := ParseHeader(tampered); err != nil || header.Slots[1].Type != SlotRecovery {
+			t.Fatalf("the tampered header is invalid: %v", err)
+		}
+		if _, err := Decrypt(keyfile, tampered); err != ErrDecryptionFailed {
+			t.Errorf("the slot with tampered type was opened: %v", err)
+		}
+		if _, err := Decrypt(password, tampered); err != nil {
+			t.Errorf("the untouched slot doesn't open the file: %s", err)
+		}
+	})
+
+	t.Run("wrapped key", func(t *testing.T) {
+		tampered := append([]byte(nil), data...)
+		offset := bytes.Index(tampered, header.Slots[0].wrapped)
+		tampered[offset+nonceSize] ^= 1
+		if _, err := Decrypt(password, tampered); err != ErrDecryptionFailed {
+			t.Errorf("the tampered wrapped key was accepted: %v", err)
+		}
+	})
+
+	t.Run("contents", func(t *testing.T) {
+		tampered := append([]byte(nil), data...)
+		tampered[len(tampered)-len(ciphertext)] ^= 1
+		if _, err := Decrypt(password, tampered); err != ErrDecryptionFailed {
+			t.Errorf("the tampered contents were accepted: %v", err)
+		}
+	})
+
+	t.Run("additional data of the contents", func(t *testing.T) {
+		if !bytes.Equal(header.aad, contentsAAD()) {
+			t.Fatalf("aad = %x, want magic and version", header.aad)
+		}
+		key, err := DecryptWithKey(deriveTestKey(t, password, header.Slots[0]), header.Slots[0].wrapped, header.Slots[0].aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decryptWithNonce(key, header.nonce, ciphertext, header.aad); err != nil {
+			t.Fatalf("the contents can't be decrypted with the data key: %s", err)
+		}
+		aad := append([]byte(nil), header.aad...)
+		aad[0] ^= 1
+		if _, err := decryptWithNonce(key, header.nonce, ciphertext, aad); err == nil {
+			t.Errorf("the contents were decrypted with tampered additional data")
+		}
+	})
+
+	t.Run("v1 header", func(t *testing.T) {
+		v1 := encryptV1(t, password, plaintext, testParams)
+		header, ciphertext, err := ParseHeader(v1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(header.aad, v1[:len(v1)-len(ciphertext)]) {
+			t.Fatalf("the additional data of a v1 file has to be the whole header")
+		}
+		key := deriveTestKey(t, password, header.Slots[0])
+		aad := append([]byte(nil), header.aad...)
+		aad[len(aad)-1] ^= 1
+		if _, err := decryptWithNonce(key, header.nonce, ciphertext, aad); err == nil {
+			t.Errorf("the contents were decrypted with a tampered header")
+		}
+	})
+}
+
+func deriveTestKey(t *testing.T, secret []byte, slot Slot) []byte {
+	t.Helper()
+	key, err := deriveKey(slotSecret(slot.Type, secret), slot.salt, slot.KDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DecryptPrivateKey parses a PEM encoded private key, which may be protected by a passphrase.
+// The key is returned unencrypted as PKCS#8 PEM block, which is understood by ssh.ParsePrivateKey.
+// Supports RSA, ECDSA and Ed25519 keys in all formats OpenSSH writes.
+func DecryptPrivateKey(pemBytes, passphrase []byte) ([]byte, error) {
+	var rawKey interface{}
+	var err error
+	if len(passphrase) == 0 {
+		rawKey, err = ssh.ParseRawPrivateKey(pemBytes)
+	} else {
+		rawKey, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the ssh package returns ed25519 keys as pointer, which x509 doesn't accept
+	if key, ok := rawKey.(*ed25519.PrivateKey); ok {
+		rawKey = *key
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key type %T: %w", rawKey, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,271 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	b64 "encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Recipients unlock a file with their own X25519 identity, similar to age. The slot of a recipient holds
+// the data key wrapped with a key derived by HKDF-SHA256 from the X25519 shared secret of an ephemeral key
+// and the public key of the recipient. The salt of the slot is the ephemeral public key followed by the
+// public key of the recipient, so the slot of a recipient is found without trying each slot.
+//
+// The identity file holds the private key encrypted with the passphrase of its owner, like an encrypted
+// config file, preceded by a comment with the public key:
+//
+//	# jim identity
+//	# public key: jim1...
+//	<base64 encoded encrypted private key>
+
+// recipientPrefix starts the text form of a public key
+const recipientPrefix = "jim1"
+
+// recipientChecksumSize is the number of bytes of the SHA-256 checksum, which follows the key in the text form
+const recipientChecksumSize = 4
+
+// identityPublicKeyComment precedes the public key in an identity file
+const identityPublicKeyComment = "# public key: "
+
+var recipientEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Recipient is the X25519 public key of an identity
+type Recipient [curve25519.PointSize]byte
+
+// Identity is an X25519 private key, which unlocks the slots of its recipient
+type Identity struct {
+	privateKey []byte
+	recipient  Recipient
+}
+
+// ParseRecipient reads the text form of a public key as printed by Recipient.String
+func ParseRecipient(s string) (Recipient, error) {
+	var r Recipient
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(strings.ToLower(s), recipientPrefix) {
+		return r, errors.Errorf("the public key '%s' doesn't start with %s", s, recipientPrefix)
+	}
+	decoded, err := recipientEncoding.DecodeString(strings.ToUpper(s[len(recipientPrefix):]))
+	if err != nil || len(decoded) != len(r)+recipientChecksumSize {
+		return r, errors.Errorf("the public key '%s' is malformed", s)
+	}
+	copy(r[:], decoded)
+	if checksum := recipientChecksum(r); !bytes.Equal(checksum, decoded[len(r):]) {
+		return r, errors.Errorf("the public key '%s' has a wrong checksum, it might be mistyped", s)
+	}
+	return r, nil
+}
+
+// String returns the text form of the public key, which is shared with the owners of encrypted files
+func (r Recipient) String() string {
+	encoded := recipientEncoding.EncodeToString(append(r[:], recipientChecksum(r)...))
+	return recipientPrefix + strings.ToLower(encoded)
+}
+
+// GenerateIdentity creates a new random identity
+func GenerateIdentity() (*Identity, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(privateKey); err != nil {
+		return nil, err
+	}
+	return newIdentity(privateKey)
+}
+
+// Recipient returns the public key of the identity
+func (id *Identity) Recipient() Recipient {
+	return id.recipient
+}
+
+// Secret returns the private key, which is passed to Open like a password to unlock the slot of the recipient
+func (id *Identity) Secret() []byte {
+	return id.privateKey
+}
+
+// EncryptIdentity returns the identity file, whose private key is encrypted with the passphrase
+func EncryptIdentity(id *Identity, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("the passphrase must not be empty")
+	}
+	cipherText, err := Encrypt(passphrase, id.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("# jim identity\n%s%s\n%s\n", identityPublicKeyComment, id.recipient, b64.StdEncoding.EncodeToString(cipherText))), nil
+}
+
+// IdentityRecipient reads the public key of an identity file without its passphrase
+func IdentityRecipient(identityFile []byte) (Recipient, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(identityFile))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, identityPublicKeyComment) {
+			return ParseRecipient(strings.TrimPrefix(line, identityPublicKeyComment))
+		}
+	}
+	return Recipient{}, errors.New("the file is no jim identity, it lacks the public key")
+}
+
+// DecryptIdentity decrypts the private key of an identity file with its passphrase
+func DecryptIdentity(identityFile, passphrase []byte) (*Identity, error) {
+	recipient, err := IdentityRecipient(identityFile)
+	if err != nil {
+		return nil, err
+	}
+	var encoded strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(identityFile))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			encoded.WriteString(line)
+		}
+	}
+	cipherText, err := b64.StdEncoding.DecodeString(encoded.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "corrupt identity file, failed at base64 decode")
+	}
+	privateKey, err := Decrypt(passphrase, cipherText)
+	if err != nil {
+		if err == ErrDecryptionFailed {
+			return nil, errors.New("wrong passphrase or the identity file is damaged")
+		}
+		return nil, err
+	}
+	id, err := newIdentity(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if id.recipient != recipient {
+		return nil, errors.New("the public key of the identity file doesn't match its private key")
+	}
+	return id, nil
+}
+
+// Recipient returns the public key of the recipient, which unlocks the slot, false for other slot types
+func (s Slot) Recipient() (Recipient, bool) {
+	var r Recipient
+	if s.Type != SlotRecipient {
+		return r, false
+	}
+	copy(r[:], s.salt[curve25519.PointSize:])
+	return r, true
+}
+
+// AddRecipientSlot wraps the data key for the recipient. Returns the index of the slot.
+func (v *Vault) AddRecipientSlot(recipient Recipient) (int, error) {
+	if _, ok := v.recipientSlot(recipient); ok {
+		return 0, errors.Errorf("%s is a recipient already", recipient)
+	}
+	ephemeral, err := GenerateIdentity()
+	if err != nil {
+		return 0, err
+	}
+	shared, err := curve25519.X25519(ephemeral.privateKey, recipient[:])
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid public key %s", recipient)
+	}
+	salt := append(ephemeral.recipient[:], recipient[:]...)
+	key, err := deriveRecipientKey(shared, salt)
+	if err != nil {
+		return 0, err
+	}
+	if err := v.addSlot(SlotRecipient, KDFParams{Algorithm: KDFX25519}, salt, key); err != nil {
+		return 0, err
+	}
+	return len(v.slots) - 1, nil
+}
+
+// RemoveRecipient removes the slot of the recipient, the last slot can't be removed
+func (v *Vault) RemoveRecipient(recipient Recipient) error {
+	index, ok := v.recipientSlot(recipient)
+	if !ok {
+		return errors.Errorf("%s is no recipient", recipient)
+	}
+	return v.RemoveSlot(index)
+}
+
+// NewVaultForRecipients creates a vault with a random data key, which is wrapped for each of the recipients
+func NewVaultForRecipients(recipients []Recipient) (*Vault, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{dataKey: dataKey, unlocked: -1}
+	for _, recipient := range recipients {
+		if _, err := v.AddRecipientSlot(recipient); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (v *Vault) recipientSlot(recipient Recipient) (int, bool) {
+	for i, slot := range v.slots {
+		if r, ok := slot.Recipient(); ok && r == recipient {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// unlocksRecipientSlot reports whether the secret is the private key of the recipient of the slot
+func unlocksRecipientSlot(secret []byte, slot Slot) bool {
+	if len(secret) != curve25519.ScalarSize {
+		return false
+	}
+	id, err := newIdentity(secret)
+	if err != nil {
+		return false
+	}
+	r, _ := slot.Recipient()
+	return subtle.ConstantTimeCompare(id.recipient[:], r[:]) == 1
+}
+
+// deriveX25519 derives the key of a recipient slot from the private key of the recipient
+func deriveX25519(privateKey, salt []byte) ([]byte, error) {
+	if len(privateKey) != curve25519.ScalarSize || len(salt) != 2*curve25519.PointSize {
+		return nil, ErrDecryptionFailed
+	}
+	shared, err := curve25519.X25519(privateKey, salt[:curve25519.PointSize])
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return deriveRecipientKey(shared, salt)
+}
+
+func deriveRecipientKey(shared, salt []byte) ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte("jim x25519 recipient")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newIdentity(privateKey []byte) (*Identity, error) {
+	if len(privateKey) != curve25519.ScalarSize {
+		return nil, errors.Errorf("invalid private key size %d", len(privateKey))
+	}
+	public, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{privateKey: privateKey}
+	copy(id.recipient[:], public)
+	return id, nil
+}
+
+func recipientChecksum(r Recipient) []byte {
+	sum := sha256.Sum256(r[:])
+	return sum[:recipientChecksumSize]
+}
@@ -0,0 +1,225 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// cheapIdentityKDF makes EncryptIdentity derive the key of identity files with testParams
+func cheapIdentityKDF(t *testing.T) {
+	defaults := DefaultKDFParams
+	DefaultKDFParams = testParams
+	t.Cleanup(func() { DefaultKDFParams = defaults })
+}
+
+func generateIdentity(t *testing.T) *Identity {
+	t.Helper()
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestRecipientRoundTrip(t *testing.T) {
+	id := generateIdentity(t)
+	text := id.Recipient().String()
+	if !strings.HasPrefix(text, recipientPrefix) || text != strings.ToLower(text) {
+		t.Errorf("the public key %s has to start with %s and be lower case", text, recipientPrefix)
+	}
+
+	for _, s := range []string{text, strings.ToUpper(text), "  " + text + "\n"} {
+		recipient, err := ParseRecipient(s)
+		if err != nil {
+			t.Errorf("ParseRecipient(%q) failed: %s", s, err)
+		} else if recipient != id.Recipient() {
+			t.Errorf("ParseRecipient(%q) returned another key", s)
+		}
+	}
+}
+
+func TestParseRecipientErrors(t *testing.T) {
+	text := generateIdentity(t).Recipient().String()
+
+	// replacing a character of the key keeps it valid base32, but breaks the checksum
+	i := len(recipientPrefix) + 10
+	replacement := "a"
+	if text[i] == 'a' {
+		replacement = "b"
+	}
+	mistyped := text[:i] + replacement + text[i+1:]
+
+	tests := map[string]string{
+		"age1qyqszqgpqyqszqgpqyqszqgpqyqszqgp": "doesn't start with jim1",
+		text[:len(text)-4]:                     "is malformed",
+		text + "aaaa":                          "is malformed",
+		recipientPrefix + "!!!!":               "is malformed",
+		mistyped:                               "has a wrong checksum",
+	}
+	for s, want := range tests {
+		if _, err := ParseRecipient(s); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseRecipient(%q) returned %v, want an error containing %q", s, err, want)
+		}
+	}
+}
+
+func TestRecipientSlots(t *testing.T) {
+	alice, bob, eve := generateIdentity(t), generateIdentity(t), generateIdentity(t)
+	plaintext := []byte("team inventory")
+
+	vault, err := NewVaultForRecipients([]Recipient{alice.Recipient(), bob.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vault.UnlockedSlot() != -1 {
+		t.Errorf("a vault created for recipients counts as unlocked by slot %d", vault.UnlockedSlot())
+	}
+	data, err := vault.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, _, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range []*Identity{alice, bob} {
+		if recipient, ok := header.Slots[i].Recipient(); !ok || recipient != id.Recipient() {
+			t.Errorf("slot %d doesn't name its recipient", i)
+		}
+		opened, decrypted, err := Open(id.Secret(), data)
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("recipient %d opened %q, %v", i, decrypted, err)
+			continue
+		}
+		if opened.UnlockedSlot() != i {
+			t.Errorf("recipient %d unlocked slot %d", i, opened.UnlockedSlot())
+		}
+	}
+	if _, _, err := Open(eve.Secret(), data); err != ErrDecryptionFailed {
+		t.Errorf("a wrong identity returned %v, want ErrDecryptionFailed", err)
+	}
+
+	if _, err := vault.AddRecipientSlot(alice.Recipient()); err == nil {
+		t.Errorf("a recipient was added twice")
+	}
+	if err := vault.RemoveRecipient(eve.Recipient()); err == nil {
+		t.Errorf("removed a recipient, which has no slot")
+	}
+	if err := vault.RemoveRecipient(bob.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+	removed := vault.Bytes()
+	if _, err := Decrypt(bob.Secret(), removed); err != ErrDecryptionFailed {
+		t.Errorf("the removed recipient still opens the file: %v", err)
+	}
+	if _, err := Decrypt(alice.Secret(), removed); err != nil {
+		t.Errorf("the remaining recipient can't open the file: %s", err)
+	}
+	if err := vault.RemoveRecipient(alice.Recipient()); err != ErrLastSlot {
+		t.Errorf("removing the last recipient returned %v, want ErrLastSlot", err)
+	}
+
+	if _, err := NewVaultForRecipients(nil); err == nil {
+		t.Errorf("created a vault without recipients")
+	}
+}
+
+func TestRecipientSlotNextToPassword(t *testing.T) {
+	id := generateIdentity(t)
+	vault, err := NewVault([]byte("secret"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddRecipientSlot(id.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a password of the size of a private key must not be mistaken for an identity
+	if _, _, err := Open(bytes.Repeat([]byte("p"), len(id.Secret())), data); err != ErrDecryptionFailed {
+		t.Errorf("opening with a wrong password returned %v", err)
+	}
+	if _, err := Decrypt(id.Secret(), data); err != nil {
+		t.Errorf("the identity can't open the file: %s", err)
+	}
+	if _, err := Decrypt([]byte("secret"), data); err != nil {
+		t.Errorf("the password can't open the file: %s", err)
+	}
+}
+
+func TestIdentityFile(t *testing.T) {
+	cheapIdentityKDF(t)
+	id := generateIdentity(t)
+	passphrase := []byte("correct horse")
+
+	identityFile, err := EncryptIdentity(id, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(identityFile, []byte(identityPublicKeyComment+id.Recipient().String())) {
+		t.Errorf("the identity file lacks the public key:\n%s", identityFile)
+	}
+
+	recipient, err := IdentityRecipient(identityFile)
+	if err != nil || recipient != id.Recipient() {
+		t.Errorf("IdentityRecipient returned %s, %v", recipient, err)
+	}
+
+	decrypted, err := DecryptIdentity(identityFile, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted.Secret(), id.Secret()) || decrypted.Recipient() != id.Recipient() {
+		t.Errorf("the decrypted identity differs from the encrypted one")
+	}
+
+	// the decrypted identity unlocks the files shared with it
+	vault, err := NewVaultForRecipients([]Recipient{id.Recipient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(decrypted.Secret(), data); err != nil {
+		t.Errorf("the decrypted identity can't open the file: %s", err)
+	}
+}
+
+func TestIdentityFileErrors(t *testing.T) {
+	cheapIdentityKDF(t)
+	id, other := generateIdentity(t), generateIdentity(t)
+	passphrase := []byte("correct horse")
+	identityFile, err := EncryptIdentity(id, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := EncryptIdentity(id, nil); err == nil {
+		t.Errorf("encrypted an identity with an empty passphrase")
+	}
+	if _, err := DecryptIdentity(identityFile, []byte("wrong")); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("a wrong passphrase returned %v", err)
+	}
+
+	swapped := bytes.Replace(identityFile, []byte(id.Recipient().String()), []byte(other.Recipient().String()), 1)
+	if _, err := DecryptIdentity(swapped, passphrase); err == nil || !strings.Contains(err.Error(), "doesn't match its private key") {
+		t.Errorf("an identity file with another public key returned %v", err)
+	}
+
+	withoutPublicKey := bytes.Replace(identityFile, []byte(identityPublicKeyComment), []byte("# "), 1)
+	if _, err := IdentityRecipient(withoutPublicKey); err == nil || !strings.Contains(err.Error(), "lacks the public key") {
+		t.Errorf("an identity file without public key returned %v", err)
+	}
+
+	corrupt := append(append([]byte(nil), identityFile...), "!!!\n"...)
+	if _, err := DecryptIdentity(corrupt, passphrase); err == nil || !strings.Contains(err.Error(), "base64") {
+		t.Errorf("a corrupt identity file returned %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the size of the keys used with EncryptWithKey
+const KeySize = 32
+
+// GenerateKey creates a random key for EncryptWithKey
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncryptWithKey encrypts data with AES-GCM using a random key, e.g. created by GenerateKey.
+// The additional data is authenticated, but not encrypted. It has to be passed to DecryptWithKey as well.
+// Returns the nonce followed by the cipher text.
+func EncryptWithKey(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// DecryptWithKey decrypts data, which was encrypted with the EncryptWithKey function.
+func DecryptWithKey(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("the cipher text is too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("invalid key size %d, expected %d bytes", len(key), KeySize)
+	}
+
+	blockCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(blockCipher)
+}
@@ -1,86 +1,57 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
 
 	"golang.org/x/crypto/scrypt"
 )
 
 // Encrypt encrypts a given plain text byte[] with a password.
-// It uses Scrypt as KDF.
+// It uses Argon2id with the DefaultKDFParams as KDF.
 // For decryption use the Decrypt function.
 func Encrypt(password, data []byte) ([]byte, error) {
-	key, salt, err := deriveKey(password, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	blockCipher, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
+	return EncryptWithParams(password, data, DefaultKDFParams)
+}
 
-	gcm, err := cipher.NewGCM(blockCipher)
+// EncryptWithParams encrypts a given plain text byte[] with a random data key, which is wrapped in a password slot.
+// The key of the slot is derived from the password with given parameters, see format.go.
+func EncryptWithParams(password, data []byte, params KDFParams) ([]byte, error) {
+	vault, err := NewVault(password, params)
 	if err != nil {
 		return nil, err
 	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = rand.Read(nonce); err != nil {
-		return nil, err
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-
-	ciphertext = append(ciphertext, salt...)
-
-	return ciphertext, nil
+	return vault.Seal(data)
 }
 
 // Decrypt decrypts a given cipher text byte[], which was encrypted with the Encrypt function.
-// For encryption use the encryption function.
+// The password may be the secret of any slot of the file. Files written by older versions of jim
+// are decrypted as well. For encryption use the encryption function.
 func Decrypt(password, data []byte) ([]byte, error) {
-	salt, data := data[len(data)-32:], data[:len(data)-32]
-
-	key, _, err := deriveKey(password, salt)
-	if err != nil {
-		return nil, err
-	}
-
-	blockCipher, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(blockCipher)
-	if err != nil {
-		return nil, err
-	}
-
-	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	_, plaintext, err := Open(password, data)
+	return plaintext, err
+}
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+// decryptWithNonce decrypts contents, whose nonce is stored apart from the cipher text
+func decryptWithNonce(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
-
-	return plaintext, nil
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
 }
 
-func deriveKey(password, salt []byte) ([]byte, []byte, error) {
-	if salt == nil {
-		salt = make([]byte, 32)
-		if _, err := rand.Read(salt); err != nil {
-			return nil, nil, err
-		}
+func deriveKey(password, salt []byte, params KDFParams) ([]byte, error) {
+	switch params.Algorithm {
+	case KDFScrypt:
+		return scrypt.Key(password, salt, params.N, params.R, params.P, KeySize)
+	case KDFArgon2id:
+		return argon2.IDKey(password, salt, uint32(params.Time), uint32(params.Memory), uint8(params.Threads), KeySize), nil
+	case KDFHKDF:
+		return deriveHKDF(password, salt)
+	case KDFX25519:
+		return deriveX25519(password, salt)
+	default:
+		return nil, errors.Errorf("unknown key derivation function %d", params.Algorithm)
 	}
-
-	key, err := scrypt.Key(password, salt, 1048576, 8, 1, 32)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return key, salt, nil
 }
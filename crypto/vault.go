@@ -0,0 +1,341 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SlotType tells, which kind of secret unlocks a key slot
+type SlotType byte
+
+const (
+	// SlotPassword is unlocked by a password
+	SlotPassword SlotType = 1
+	// SlotKeyfile is unlocked by the contents of a file
+	SlotKeyfile SlotType = 2
+	// SlotRecovery is unlocked by a generated recovery key
+	SlotRecovery SlotType = 3
+	// SlotRecipient is unlocked by the identity of a recipient
+	SlotRecipient SlotType = 4
+)
+
+func (t SlotType) String() string {
+	switch t {
+	case SlotPassword:
+		return "password"
+	case SlotKeyfile:
+		return "keyfile"
+	case SlotRecovery:
+		return "recovery key"
+	case SlotRecipient:
+		return "recipient"
+	default:
+		return "unknown"
+	}
+}
+
+// Slot wraps the data key of a file with a key derived from the secret of the slot
+type Slot struct {
+	Type SlotType
+	KDF  KDFParams
+	salt []byte
+	// wrapped is the nonce followed by the encrypted data key, empty for files of older versions
+	wrapped []byte
+	// aad are magic, version and the slot fields preceding the wrapped key
+	aad []byte
+}
+
+// recoveryKeySize is the number of random bytes of a recovery key
+const recoveryKeySize = 20
+
+// minKeyfileSize is the least number of bytes a keyfile must hold
+const minKeyfileSize = 16
+
+var (
+	// ErrLastSlot is returned, if the last slot of a file should be removed
+	ErrLastSlot = errors.New("the last key slot can't be removed")
+	// ErrTooManySlots is returned, if a file has MaxSlots already
+	ErrTooManySlots = errors.Errorf("a file can't have more than %d key slots", MaxSlots)
+)
+
+// Vault is an opened encrypted file. It holds the data key, so the file can be encrypted again and
+// its slots can be changed without knowing the secrets of the other slots.
+type Vault struct {
+	dataKey []byte
+	slots   []Slot
+	// unlocked is the index of the slot, which opened the vault, -1 if it was removed
+	unlocked int
+	// nonce and ciphertext are the encrypted contents, they don't change with the slots
+	nonce      []byte
+	ciphertext []byte
+}
+
+// NewVault creates a vault with a random data key and a password slot, whose key is derived with given parameters
+func NewVault(password []byte, params KDFParams) (*Vault, error) {
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{dataKey: dataKey}
+	if v.unlocked, err = v.AddPasswordSlot(password, params); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Open decrypts the file with the secret of any of its slots, which is a password, the contents of a keyfile,
+// a recovery key or the private key of a recipient's identity. Files of older versions are converted, their password slot keeps salt and parameters,
+// so the secret doesn't have to be derived again.
+// Returns the vault and the decrypted contents.
+func Open(secret, data []byte) (*Vault, []byte, error) {
+	header, ciphertext, err := ParseHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header.Version < FormatVersion {
+		slot := header.Slots[0]
+		key, err := deriveKey(secret, slot.salt, slot.KDF)
+		if err != nil {
+			return nil, nil, err
+		}
+		plaintext, err := decryptWithNonce(key, header.nonce, ciphertext, header.aad)
+		if err != nil {
+			return nil, nil, ErrDecryptionFailed
+		}
+
+		dataKey, err := GenerateKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		v := &Vault{dataKey: dataKey}
+		if err := v.addSlot(slot.Type, slot.KDF, slot.salt, key); err != nil {
+			return nil, nil, err
+		}
+		if _, err := v.Seal(plaintext); err != nil {
+			return nil, nil, err
+		}
+		return v, plaintext, nil
+	}
+
+	// the slots not derived from passwords are cheap to try
+	var order []int
+	for _, cheap := range []bool{true, false} {
+		for i, slot := range header.Slots {
+			if (slot.KDF.Algorithm == KDFHKDF || slot.KDF.Algorithm == KDFX25519) == cheap {
+				order = append(order, i)
+			}
+		}
+	}
+	for _, i := range order {
+		slot := header.Slots[i]
+		if slot.Type == SlotRecipient && !unlocksRecipientSlot(secret, slot) {
+			continue
+		}
+		key, err := deriveKey(slotSecret(slot.Type, secret), slot.salt, slot.KDF)
+		if err != nil {
+			return nil, nil, err
+		}
+		dataKey, err := DecryptWithKey(key, slot.wrapped, slot.aad)
+		if err != nil {
+			continue
+		}
+		plaintext, err := decryptWithNonce(dataKey, header.nonce, ciphertext, header.aad)
+		if err != nil {
+			return nil, nil, ErrDecryptionFailed
+		}
+		v := &Vault{dataKey: dataKey, slots: header.Slots, unlocked: i, nonce: header.nonce, ciphertext: ciphertext}
+		return v, plaintext, nil
+	}
+	return nil, nil, ErrDecryptionFailed
+}
+
+// Reload adopts the slots of data, which another process changed, e.g. to add a slot. The contents of data have to be
+// encrypted with the data key of the vault, so no secret is needed. Returns the decrypted contents.
+func (v *Vault) Reload(data []byte) ([]byte, error) {
+	header, ciphertext, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version < FormatVersion {
+		return nil, ErrDecryptionFailed
+	}
+	plaintext, err := decryptWithNonce(v.dataKey, header.nonce, ciphertext, header.aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	v.slots = header.Slots
+	v.unlocked = -1
+	v.nonce = header.nonce
+	v.ciphertext = ciphertext
+	return plaintext, nil
+}
+
+// Seal encrypts the contents with the data key and returns the file
+func (v *Vault) Seal(plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(v.dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	v.nonce = nonce
+	v.ciphertext = gcm.Seal(nil, nonce, plaintext, contentsAAD())
+	return v.Bytes(), nil
+}
+
+// Bytes returns the file with the current slots and the contents encrypted last
+func (v *Vault) Bytes() []byte {
+	return append(encodeHeader(v.slots, v.nonce), v.ciphertext...)
+}
+
+// Slots returns the key slots of the vault
+func (v *Vault) Slots() []Slot {
+	return append([]Slot(nil), v.slots...)
+}
+
+// UnlockedSlot returns the index of the slot, which opened the vault, or -1 if the slot was removed.
+// New vaults count as opened by their password slot, vaults created for recipients by none.
+func (v *Vault) UnlockedSlot() int {
+	return v.unlocked
+}
+
+// AddPasswordSlot adds a slot unlocked by the password, whose key is derived with given parameters.
+// Returns the index of the slot.
+func (v *Vault) AddPasswordSlot(password []byte, params KDFParams) (int, error) {
+	if len(password) == 0 {
+		return 0, errors.New("the password must not be empty")
+	}
+	return v.addSecretSlot(SlotPassword, password, params)
+}
+
+// AddKeyfileSlot adds a slot unlocked by the contents of a keyfile. Returns the index of the slot.
+func (v *Vault) AddKeyfileSlot(keyfile []byte) (int, error) {
+	if len(keyfile) < minKeyfileSize {
+		return 0, errors.Errorf("the keyfile has to hold at least %d bytes", minKeyfileSize)
+	}
+	return v.addSecretSlot(SlotKeyfile, keyfile, KDFParams{Algorithm: KDFHKDF})
+}
+
+// AddRecoverySlot adds a slot unlocked by a new recovery key, which is returned together with the index of the slot.
+// The recovery key is shown only once, it is typed like a password.
+func (v *Vault) AddRecoverySlot() (string, int, error) {
+	random := make([]byte, recoveryKeySize)
+	if _, err := rand.Read(random); err != nil {
+		return "", 0, err
+	}
+	recoveryKey := slotSecret(SlotRecovery, []byte(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random)))
+
+	index, err := v.addSecretSlot(SlotRecovery, recoveryKey, KDFParams{Algorithm: KDFHKDF})
+	return string(recoveryKey), index, err
+}
+
+// ReplacePassword replaces the password slot, which opened the vault, by a slot with the new password
+// and the same parameters. The other slots keep working.
+func (v *Vault) ReplacePassword(password []byte) error {
+	if v.unlocked < 0 || v.slots[v.unlocked].Type != SlotPassword {
+		return errors.New("the vault was not opened with a password")
+	}
+	slots := v.slots
+	v.slots = append(append([]Slot(nil), slots[:v.unlocked]...), slots[v.unlocked+1:]...)
+	index, err := v.AddPasswordSlot(password, slots[v.unlocked].KDF)
+	if err != nil {
+		v.slots = slots
+		return err
+	}
+	// the new slot takes the position of the old one
+	replaced := v.slots[index]
+	copy(v.slots[v.unlocked+1:], v.slots[v.unlocked:index])
+	v.slots[v.unlocked] = replaced
+	return nil
+}
+
+// RemoveSlot removes the slot with given index, the last slot can't be removed
+func (v *Vault) RemoveSlot(index int) error {
+	if index < 0 || index >= len(v.slots) {
+		return errors.Errorf("there is no key slot %d", index)
+	}
+	if len(v.slots) == 1 {
+		return ErrLastSlot
+	}
+	v.slots = append(append([]Slot(nil), v.slots[:index]...), v.slots[index+1:]...)
+	switch {
+	case v.unlocked == index:
+		v.unlocked = -1
+	case v.unlocked > index:
+		v.unlocked--
+	}
+	return nil
+}
+
+func (v *Vault) addSecretSlot(slotType SlotType, secret []byte, params KDFParams) (int, error) {
+	if err := params.Validate(); err != nil {
+		return 0, err
+	}
+	salt := make([]byte, legacySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+	key, err := deriveKey(slotSecret(slotType, secret), salt, params)
+	if err != nil {
+		return 0, err
+	}
+	if err := v.addSlot(slotType, params, salt, key); err != nil {
+		return 0, err
+	}
+	return len(v.slots) - 1, nil
+}
+
+// addSlot wraps the data key with the key derived from the secret of the slot
+func (v *Vault) addSlot(slotType SlotType, params KDFParams, salt []byte, key []byte) error {
+	if len(v.slots) >= MaxSlots {
+		return ErrTooManySlots
+	}
+	slot := Slot{Type: slotType, KDF: params, salt: salt}
+	slot.aad = encodeSlot(&slot)
+	wrapped, err := EncryptWithKey(key, v.dataKey, slot.aad)
+	if err != nil {
+		return err
+	}
+	slot.wrapped = wrapped
+	v.slots = append(v.slots, slot)
+	return nil
+}
+
+// slotSecret normalizes the secret for slots of given type, recovery keys are accepted without dashes and in lower case
+func slotSecret(slotType SlotType, secret []byte) []byte {
+	if slotType != SlotRecovery {
+		return secret
+	}
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(string(secret))))
+	var groups []string
+	for i := 0; i < len(normalized); i += 4 {
+		end := i + 4
+		if end > len(normalized) {
+			end = len(normalized)
+		}
+		groups = append(groups, normalized[i:end])
+	}
+	return []byte(strings.Join(groups, "-"))
+}
+
+// deriveHKDF derives a key from a secret with high entropy
+func deriveHKDF(secret, salt []byte) ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte("jim key slot")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func contentsAAD() []byte {
+	return append(append([]byte(nil), magic...), FormatVersion)
+}
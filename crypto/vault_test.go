@@ -0,0 +1,296 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOpenWithEachSlotType(t *testing.T) {
+	password := []byte("secret")
+	plaintext := []byte("contents")
+	keyfile := bytes.Repeat([]byte("k"), minKeyfileSize)
+
+	vault, err := NewVault(password, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddKeyfileSlot(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	recoveryKey, _, err := vault.AddRecoverySlot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddRecipientSlot(id.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddPasswordSlot([]byte("scrypt secret"), testScryptParams); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		slot   int
+	}{
+		{"password", password, 0},
+		{"keyfile", keyfile, 1},
+		{"recovery key", []byte(recoveryKey), 2},
+		{"recovery key typed without dashes", []byte(strings.ToLower(strings.ReplaceAll(recoveryKey, "-", ""))), 2},
+		{"recipient", id.Secret(), 3},
+		{"scrypt password", []byte("scrypt secret"), 4},
+	}
+	for _, test := range tests {
+		opened, decrypted, err := Open(test.secret, data)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%s: decrypted %q, want %q", test.name, decrypted, plaintext)
+		}
+		if opened.UnlockedSlot() != test.slot {
+			t.Errorf("%s: unlocked slot %d, want %d", test.name, opened.UnlockedSlot(), test.slot)
+		}
+	}
+
+	other, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, wrong := range [][]byte{[]byte("wrong"), bytes.Repeat([]byte("x"), minKeyfileSize), other.Secret()} {
+		if _, _, err := Open(wrong, data); err != ErrDecryptionFailed {
+			t.Errorf("opening with a wrong secret returned %v", err)
+		}
+	}
+}
+
+func TestAddSlotValidation(t *testing.T) {
+	vault, err := NewVault([]byte("secret"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddPasswordSlot(nil, testParams); err == nil {
+		t.Errorf("an empty password was accepted")
+	}
+	if _, err := vault.AddKeyfileSlot(make([]byte, minKeyfileSize-1)); err == nil {
+		t.Errorf("a short keyfile was accepted")
+	}
+	if _, err := vault.AddPasswordSlot([]byte("secret"), KDFParams{Algorithm: KDFScrypt, N: 3, R: 1, P: 1}); err == nil {
+		t.Errorf("invalid scrypt parameters were accepted")
+	}
+	if n := len(vault.Slots()); n != 1 {
+		t.Errorf("failed additions left %d slots", n)
+	}
+}
+
+func TestRemoveSlot(t *testing.T) {
+	password := []byte("secret")
+	keyfile := bytes.Repeat([]byte("k"), minKeyfileSize)
+
+	vault, err := NewVault(password, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.RemoveSlot(0); err != ErrLastSlot {
+		t.Errorf("removing the only slot returned %v, want ErrLastSlot", err)
+	}
+	if _, err := vault.AddKeyfileSlot(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.RemoveSlot(2); err == nil {
+		t.Errorf("removing a slot, which doesn't exist, succeeded")
+	}
+	// the last password slot may be removed, as long as another slot is left
+	if err := vault.RemoveSlot(0); err != nil {
+		t.Fatal(err)
+	}
+	if vault.UnlockedSlot() != -1 {
+		t.Errorf("the removed slot is still reported as unlocked slot %d", vault.UnlockedSlot())
+	}
+	if err := vault.RemoveSlot(0); err != ErrLastSlot {
+		t.Errorf("removing the last slot returned %v, want ErrLastSlot", err)
+	}
+
+	// slots change without encrypting the contents again
+	removed := vault.Bytes()
+	if len(removed) >= len(data) {
+		t.Errorf("the file didn't shrink after removing a slot")
+	}
+	if _, err := Decrypt(password, removed); err != ErrDecryptionFailed {
+		t.Errorf("the removed password still opens the file: %v", err)
+	}
+	if _, err := Decrypt(keyfile, removed); err != nil {
+		t.Errorf("the keyfile doesn't open the file anymore: %s", err)
+	}
+	if err := vault.ReplacePassword([]byte("new")); err == nil {
+		t.Errorf("replaced the password of a vault, whose password slot was removed")
+	}
+}
+
+func TestRemoveSlotBeforeUnlockedSlot(t *testing.T) {
+	vault, err := NewVault([]byte("secret"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddKeyfileSlot(bytes.Repeat([]byte("k"), minKeyfileSize)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, _, err := Open(bytes.Repeat([]byte("k"), minKeyfileSize), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := opened.RemoveSlot(0); err != nil {
+		t.Fatal(err)
+	}
+	if opened.UnlockedSlot() != 0 {
+		t.Errorf("unlocked slot = %d, want the keyfile slot to move to 0", opened.UnlockedSlot())
+	}
+}
+
+func TestMaxSlots(t *testing.T) {
+	vault, err := NewVault([]byte("secret"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < MaxSlots; i++ {
+		if _, _, err := vault.AddRecoverySlot(); err != nil {
+			t.Fatalf("adding slot %d failed: %s", i, err)
+		}
+	}
+	if _, _, err := vault.AddRecoverySlot(); err != ErrTooManySlots {
+		t.Errorf("adding slot %d returned %v, want ErrTooManySlots", MaxSlots+1, err)
+	}
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddRecipientSlot(id.Recipient()); err != ErrTooManySlots {
+		t.Errorf("adding a recipient to a full vault returned %v, want ErrTooManySlots", err)
+	}
+
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header, _, err := ParseHeader(data); err != nil || len(header.Slots) != MaxSlots {
+		t.Errorf("a full vault can't be parsed: %v", err)
+	}
+}
+
+func TestReloadAfterReplacePassword(t *testing.T) {
+	oldPassword, newPassword := []byte("old secret"), []byte("new secret")
+	keyfile := bytes.Repeat([]byte("k"), minKeyfileSize)
+
+	vault, err := NewVault(oldPassword, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddKeyfileSlot(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the daemon keeps the vault it opened, while the password is changed by another process
+	daemon, _, err := Open(oldPassword, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changer, plaintext, err := Open(oldPassword, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := changer.ReplacePassword(newPassword); err != nil {
+		t.Fatal(err)
+	}
+	if slots := changer.Slots(); slots[0].Type != SlotPassword || slots[0].KDF != testParams || slots[1].Type != SlotKeyfile {
+		t.Errorf("the new password slot doesn't replace the old one in place: %+v", slots)
+	}
+	rekeyed, err := changer.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := daemon.Reload(rekeyed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reloaded, plaintext) {
+		t.Errorf("reloaded %q, want %q", reloaded, plaintext)
+	}
+
+	// the daemon writes modifications with the adopted slots
+	written, err := daemon.Seal([]byte("modified"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, err := Decrypt(newPassword, written); err != nil || string(decrypted) != "modified" {
+		t.Errorf("the new password opens %q, %v", decrypted, err)
+	}
+	if _, err := Decrypt(oldPassword, written); err != ErrDecryptionFailed {
+		t.Errorf("the old password still opens the file: %v", err)
+	}
+	if _, err := Decrypt(keyfile, written); err != nil {
+		t.Errorf("the keyfile doesn't open the file anymore: %s", err)
+	}
+}
+
+func TestReloadWithOtherDataKey(t *testing.T) {
+	vault, err := NewVault([]byte("secret"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := EncryptWithParams([]byte("secret"), []byte("contents"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.Reload(other); err != ErrDecryptionFailed {
+		t.Errorf("reloading a file with another data key returned %v, want ErrDecryptionFailed", err)
+	}
+	if _, err := vault.Reload(encryptV1(t, []byte("secret"), []byte("contents"), testParams)); err != ErrDecryptionFailed {
+		t.Errorf("reloading a v1 file returned %v, want ErrDecryptionFailed", err)
+	}
+}
+
+func TestReplacePasswordOfKeyfileVault(t *testing.T) {
+	keyfile := bytes.Repeat([]byte("k"), minKeyfileSize)
+	vault, err := NewVault([]byte("secret"), testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.AddKeyfileSlot(keyfile); err != nil {
+		t.Fatal(err)
+	}
+	data, err := vault.Seal([]byte("contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, _, err := Open(keyfile, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := opened.ReplacePassword([]byte("new")); err == nil {
+		t.Errorf("replaced the password of a vault opened with a keyfile")
+	}
+}
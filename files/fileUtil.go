@@ -18,24 +18,43 @@ func Exists(filename string) bool {
 	return !info.IsDir()
 }
 
-// GetJimConfigFilePath returns the filepath to the encrypted jim config.
-// Highest priority has the env variable JIM_CONFIG_FILE.
-// If the variable is not set the default location  ~/.jim/config.json.enc is used.
-func GetJimConfigFilePath() (string, error) {
-	path := os.Getenv("JIM_CONFIG_FILE") // env variable has highest priority
-	if path == "" {                      // fallback to the standard location
-		path = filepath.Join(GetJimConfigDir(), "config.json.enc")
-	}
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return "", fmt.Errorf(
-			`No encrypted config file was found at the configured path '%s'. 
+// GetJimConfigFilePaths returns the filepaths to the encrypted jim configs, ordered by precedence.
+// Highest priority has the env variable JIM_CONFIG_FILE, which may list multiple files separated by the
+// OS specific path list separator, e.g. JIM_CONFIG_FILE=~/.jim/personal.json.enc:~/team/inventory.json.enc
+// If the variable is not set the default location  ~/.jim/config.json.enc is used,
+// or ~/.jim/config.yaml.enc, ~/.jim/config.yml.enc and ~/.jim/config.toml.enc if it doesn't exist.
+func GetJimConfigFilePaths() ([]string, error) {
+	var paths []string
+	for _, path := range filepath.SplitList(os.Getenv("JIM_CONFIG_FILE")) { // env variable has highest priority
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 { // fallback to the standard location
+		path := filepath.Join(GetJimConfigDir(), "config.json.enc")
+		for _, name := range []string{"config.yaml.enc", "config.yml.enc", "config.toml.enc"} {
+			if candidate := filepath.Join(GetJimConfigDir(), name); !Exists(path) && Exists(candidate) {
+				path = candidate
+			}
+		}
+		paths = append(paths, path)
+	}
+
+	for i, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, fmt.Errorf(
+				`No encrypted config file was found at the configured path '%s'. 
 Either proceed with 
 jim doctor
 jim encrypt
 
 or set the path to the config file via the environment variable JIM_CONFIG_FILE`, path)
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			paths[i] = abs
+		}
 	}
-	return path, nil
+	return paths, nil
 }
 
 // GetJimConfigDir returns the filepath to jim's config directory ~/.jim
@@ -46,3 +65,36 @@ func GetJimConfigDir() string {
 	}
 	return filepath.Join(homeDir, ".jim")
 }
+
+// WriteFileAtomic writes data to a temporary file next to the destination and renames it afterwards,
+// so readers either see the old or the new contents, but never a partially written file.
+// The permissions of an existing destination file are preserved, otherwise perm is used.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// cleans up in case of failure, after a successful rename the file doesn't exist anymore
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
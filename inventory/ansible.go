@@ -0,0 +1,587 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+)
+
+const (
+	ansibleAll       = "all"
+	ansibleUngrouped = "ungrouped"
+)
+
+// ansibleConnectionVars are the variables read by FromAnsibleHosts
+var ansibleConnectionVars = []string{
+	"ansible_host", "ansible_ssh_host", "ansible_port", "ansible_ssh_port", "ansible_user", "ansible_ssh_user",
+	"ansible_password", "ansible_ssh_pass", "ansible_ssh_private_key_file", "ansible_private_key_file",
+	"ansible_ssh_common_args", "ansible_ssh_extra_args",
+}
+
+// AnsibleHost is a host of an Ansible inventory with the variables of its groups and its own variables
+type AnsibleHost struct {
+	Name string
+	// Groups lists the groups of the host including their parents, from the most specific to the least specific one.
+	// The implicit groups all and ungrouped are left out.
+	Groups []string
+	// Vars holds the effective variables of the host
+	Vars map[string]string
+}
+
+// ansibleInventory collects the groups and hosts of an inventory file in the order they are declared
+type ansibleInventory struct {
+	groups     map[string]*ansibleGroup
+	groupOrder []string
+	hostVars   map[string]map[string]string
+	hostOrder  []string
+}
+
+type ansibleGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{groups: make(map[string]*ansibleGroup), hostVars: make(map[string]map[string]string)}
+}
+
+func (inv *ansibleInventory) group(name string) *ansibleGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &ansibleGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+		inv.groupOrder = append(inv.groupOrder, name)
+	}
+	return g
+}
+
+func (inv *ansibleInventory) addHost(groupName string, name string, vars map[string]string) {
+	if _, ok := inv.hostVars[name]; !ok {
+		inv.hostVars[name] = make(map[string]string)
+		inv.hostOrder = append(inv.hostOrder, name)
+	}
+	for key, value := range vars {
+		inv.hostVars[name][key] = value
+	}
+	g := inv.group(groupName)
+	for _, host := range g.hosts {
+		if host == name {
+			return
+		}
+	}
+	g.hosts = append(g.hosts, name)
+}
+
+// ParseAnsibleInventory reads the hosts of an Ansible inventory file in INI or YAML format.
+// The format is determined by the file extension, files without .yml or .yaml extension are inspected.
+// Host ranges like web[01:03] are expanded. Variables are resolved like Ansible does, host variables
+// win over the variables of child groups, which win over the ones of their parents.
+// Returns warnings about connection variables using templates, which are not evaluated.
+func ParseAnsibleInventory(inventoryPath string) ([]AnsibleHost, []string, error) {
+	data, err := os.ReadFile(inventoryPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var inv *ansibleInventory
+	switch strings.ToLower(filepath.Ext(inventoryPath)) {
+	case ".yml", ".yaml":
+		inv, err = parseAnsibleYAML(data)
+	case ".ini", ".cfg":
+		inv, err = parseAnsibleINI(data)
+	default:
+		if inv, err = parseAnsibleYAML(data); err != nil {
+			inv, err = parseAnsibleINI(data)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return inv.resolve()
+}
+
+// parseAnsibleINI parses the INI format with [group], [group:vars] and [group:children] sections
+func parseAnsibleINI(data []byte) (*ansibleInventory, error) {
+	inv := newAnsibleInventory()
+	section, kind := ansibleUngrouped, "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: invalid section %s", lineNumber, line)
+			}
+			section, kind = strings.TrimSpace(line[1:len(line)-1]), "hosts"
+			if name, suffix, ok := strings.Cut(section, ":"); ok {
+				if suffix != "vars" && suffix != "children" {
+					return nil, errors.Errorf("line %d: invalid section %s", lineNumber, line)
+				}
+				section, kind = name, suffix
+			}
+			inv.group(section)
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, errors.Errorf("line %d: expected key=value in the vars of %s", lineNumber, section)
+			}
+			inv.group(section).vars[strings.TrimSpace(key)] = unquote(strings.TrimSpace(value))
+		case "children":
+			inv.group(line)
+			g := inv.group(section)
+			g.children = append(g.children, line)
+		default:
+			tokens, err := splitINIHostLine(line)
+			if err != nil {
+				return nil, errors.Errorf("line %d: %s", lineNumber, err)
+			}
+			vars := make(map[string]string)
+			for _, token := range tokens[1:] {
+				key, value, ok := strings.Cut(token, "=")
+				if !ok {
+					return nil, errors.Errorf("line %d: expected key=value after the host %s", lineNumber, tokens[0])
+				}
+				vars[key] = value
+			}
+			names, err := expandHostPattern(tokens[0])
+			if err != nil {
+				return nil, errors.Errorf("line %d: %s", lineNumber, err)
+			}
+			for _, name := range names {
+				inv.addHost(section, name, vars)
+			}
+		}
+	}
+	return inv, scanner.Err()
+}
+
+// splitINIHostLine splits a host line at whitespace, values may be quoted
+func splitINIHostLine(line string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	var quote rune
+	inToken := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inToken = r, true
+		case r == '#':
+			if !inToken {
+				return tokens, nil
+			}
+			current.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// parseAnsibleYAML parses the YAML format, in which each group may declare hosts, vars and children
+func parseAnsibleYAML(data []byte) (*ansibleInventory, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return nil, errors.New("the inventory doesn't declare any group")
+	}
+
+	inv := newAnsibleInventory()
+	for _, name := range sortedKeysOf(doc) {
+		if err := inv.parseYAMLGroup(name, doc[name]); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+func (inv *ansibleInventory) parseYAMLGroup(name string, node interface{}) error {
+	g := inv.group(name)
+	if node == nil {
+		return nil
+	}
+	fields, ok := node.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("the group %s must be a mapping", name)
+	}
+
+	vars, err := yamlVars(fields["vars"], "vars of group "+name)
+	if err != nil {
+		return err
+	}
+	for key, value := range vars {
+		g.vars[key] = value
+	}
+
+	if fields["hosts"] != nil {
+		hosts, ok := fields["hosts"].(map[string]interface{})
+		if !ok {
+			return errors.Errorf("the hosts of group %s must be a mapping", name)
+		}
+		for _, pattern := range sortedKeysOf(hosts) {
+			vars, err := yamlVars(hosts[pattern], "vars of host "+pattern)
+			if err != nil {
+				return err
+			}
+			names, err := expandHostPattern(pattern)
+			if err != nil {
+				return err
+			}
+			for _, hostName := range names {
+				inv.addHost(name, hostName, vars)
+			}
+		}
+	}
+
+	if fields["children"] != nil {
+		children, ok := fields["children"].(map[string]interface{})
+		if !ok {
+			return errors.Errorf("the children of group %s must be a mapping", name)
+		}
+		for _, child := range sortedKeysOf(children) {
+			g.children = append(g.children, child)
+			if err := inv.parseYAMLGroup(child, children[child]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// yamlVars converts a mapping of variables to strings, nested values are not supported
+func yamlVars(node interface{}, what string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if node == nil {
+		return vars, nil
+	}
+	fields, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("the %s must be a mapping", what)
+	}
+	for key, value := range fields {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			// nested values are never connection settings
+			continue
+		case nil:
+			vars[key] = ""
+		default:
+			vars[key] = fmt.Sprint(value)
+		}
+	}
+	return vars, nil
+}
+
+func sortedKeysOf(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expandHostPattern expands the ranges of a host pattern like web[01:10:2].example.com or db-[a:c]
+func expandHostPattern(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	if start < 0 {
+		return []string{pattern}, nil
+	}
+	end := strings.Index(pattern[start:], "]")
+	if end < 0 {
+		return nil, errors.Errorf("invalid host range in %s", pattern)
+	}
+	end += start
+
+	bounds := strings.Split(pattern[start+1:end], ":")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil, errors.Errorf("invalid host range in %s", pattern)
+	}
+	stride := 1
+	if len(bounds) == 3 {
+		var err error
+		if stride, err = strconv.Atoi(bounds[2]); err != nil || stride < 1 {
+			return nil, errors.Errorf("invalid stride in %s", pattern)
+		}
+	}
+
+	var values []string
+	from, errFrom := strconv.Atoi(bounds[0])
+	to, errTo := strconv.Atoi(bounds[1])
+	switch {
+	case errFrom == nil && errTo == nil:
+		// leading zeros of the start determine the width, e.g. [01:10] yields 01 to 10
+		width := 0
+		if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+			width = len(bounds[0])
+		}
+		for i := from; i <= to; i += stride {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+	case len(bounds[0]) == 1 && len(bounds[1]) == 1:
+		for c := bounds[0][0]; c <= bounds[1][0]; c += byte(stride) {
+			values = append(values, string(c))
+		}
+	default:
+		return nil, errors.Errorf("invalid host range in %s", pattern)
+	}
+
+	rests, err := expandHostPattern(pattern[end+1:])
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, value := range values {
+		for _, rest := range rests {
+			names = append(names, pattern[:start]+value+rest)
+		}
+	}
+	return names, nil
+}
+
+// resolve computes the groups and effective variables of each host
+func (inv *ansibleInventory) resolve() ([]AnsibleHost, []string, error) {
+	// every group without parent is a child of all
+	parents := make(map[string][]string)
+	for _, name := range inv.groupOrder {
+		for _, child := range inv.groups[name].children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	for _, name := range inv.groupOrder {
+		if name != ansibleAll && len(parents[name]) == 0 {
+			parents[name] = []string{ansibleAll}
+		}
+	}
+
+	// the depth of a group is the length of the longest path from all to the group
+	depths := make(map[string]int)
+	var depthOf func(name string, visiting map[string]bool) (int, error)
+	depthOf = func(name string, visiting map[string]bool) (int, error) {
+		if depth, ok := depths[name]; ok {
+			return depth, nil
+		}
+		if visiting[name] {
+			return 0, errors.Errorf("the children of group %s lead to a cycle", name)
+		}
+		visiting[name] = true
+		depth := 0
+		for _, parent := range parents[name] {
+			parentDepth, err := depthOf(parent, visiting)
+			if err != nil {
+				return 0, err
+			}
+			if parentDepth+1 > depth {
+				depth = parentDepth + 1
+			}
+		}
+		delete(visiting, name)
+		depths[name] = depth
+		return depth, nil
+	}
+
+	membership := make(map[string][]string)
+	for _, name := range inv.groupOrder {
+		if _, err := depthOf(name, map[string]bool{}); err != nil {
+			return nil, nil, err
+		}
+		for _, host := range inv.groups[name].hosts {
+			membership[host] = append(membership[host], name)
+		}
+	}
+
+	var hosts []AnsibleHost
+	var warnings []string
+	warned := make(map[string]bool)
+	for _, name := range inv.hostOrder {
+		groups := make(map[string]bool)
+		var collect func(group string)
+		collect = func(group string) {
+			if groups[group] {
+				return
+			}
+			groups[group] = true
+			for _, parent := range parents[group] {
+				collect(parent)
+			}
+		}
+		for _, group := range membership[name] {
+			collect(group)
+		}
+		collect(ansibleAll)
+
+		// variables of deeper groups win, groups of the same depth are applied in alphabetical order
+		ordered := make([]string, 0, len(groups))
+		for group := range groups {
+			ordered = append(ordered, group)
+		}
+		sort.Slice(ordered, func(i, j int) bool {
+			if depths[ordered[i]] != depths[ordered[j]] {
+				return depths[ordered[i]] < depths[ordered[j]]
+			}
+			return ordered[i] < ordered[j]
+		})
+
+		host := AnsibleHost{Name: name, Vars: make(map[string]string)}
+		for _, group := range ordered {
+			if g, ok := inv.groups[group]; ok {
+				for key, value := range g.vars {
+					host.Vars[key] = value
+				}
+			}
+		}
+		for key, value := range inv.hostVars[name] {
+			host.Vars[key] = value
+		}
+		for i := len(ordered) - 1; i >= 0; i-- {
+			if ordered[i] != ansibleAll && ordered[i] != ansibleUngrouped {
+				host.Groups = append(host.Groups, ordered[i])
+			}
+		}
+
+		for _, key := range ansibleConnectionVars {
+			if strings.Contains(host.Vars[key], "{{") {
+				if !warned[key] {
+					warnings = append(warnings, fmt.Sprintf("The variable %s uses a template, which is not evaluated", key))
+					warned[key] = true
+				}
+				delete(host.Vars, key)
+			}
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, warnings, nil
+}
+
+// ansibleVar returns the value of the first set variable
+func ansibleVar(vars map[string]string, names ...string) string {
+	for _, name := range names {
+		if value := vars[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// FromAnsibleHosts converts the hosts of an Ansible inventory to jim config entries. Connection settings are taken
+// from the variables ansible_host, ansible_port, ansible_user, ansible_password, ansible_ssh_private_key_file and
+// jump hosts from -J or ProxyJump in ansible_ssh_common_args. Group and env are determined from the inventory
+// groups by the mapping. Hosts without user and port use the current user and port 22, like Ansible does.
+func FromAnsibleHosts(hosts []AnsibleHost, mapping Mapping, passphrase PassphraseFunc) (config.JimConfig, []string, error) {
+	jimConfig := config.JimConfig{Version: config.Version}
+	var warnings []string
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	keys := newKeyLoader(&jimConfig, passphrase, &warnings)
+
+	for _, host := range hosts {
+		el := config.JimConfigElement{
+			Tag: host.Name,
+			Server: config.JimConfigEntry{
+				Host:     ansibleVar(host.Vars, "ansible_host", "ansible_ssh_host"),
+				Port:     22,
+				Username: ansibleVar(host.Vars, "ansible_user", "ansible_ssh_user"),
+				Password: ansibleVar(host.Vars, "ansible_password", "ansible_ssh_pass"),
+			},
+		}
+		if el.Server.Host == "" {
+			el.Server.Host = host.Name
+		}
+		if el.Server.Username == "" {
+			el.Server.Username = localUser
+		}
+		if port := ansibleVar(host.Vars, "ansible_port", "ansible_ssh_port"); port != "" {
+			var err error
+			if el.Server.Port, err = strconv.Atoi(port); err != nil {
+				return jimConfig, warnings, errors.Errorf("The port '%s' of '%s' is not numeric", port, host.Name)
+			}
+		}
+		if keyFile := ansibleVar(host.Vars, "ansible_ssh_private_key_file", "ansible_private_key_file"); keyFile != "" {
+			name, found, err := keys.load(expandHome(keyFile), host.Name)
+			if err != nil {
+				return jimConfig, warnings, err
+			}
+			if !found {
+				warnings = append(warnings, fmt.Sprintf("The private key file %s of '%s' does not exist", keyFile, host.Name))
+			}
+			el.Server.KeyRef = name
+		}
+		for _, hop := range proxyJumpOf(ansibleVar(host.Vars, "ansible_ssh_common_args", "ansible_ssh_extra_args")) {
+			_, name, _ := splitJumpHost(hop)
+			el.Server.Jump = append(el.Server.Jump, name)
+		}
+
+		el.Group, el.Env = mapping.GroupAndEnvOfGroups(host.Groups, host.Name)
+		jimConfig.Entries = append(jimConfig.Entries, el)
+	}
+	return jimConfig, warnings, nil
+}
+
+// proxyJumpOf returns the jump hosts passed as -J or -o ProxyJump in ssh arguments
+func proxyJumpOf(args string) []string {
+	tokens := strings.Fields(args)
+	for i, token := range tokens {
+		var value string
+		switch {
+		case token == "-J" && i+1 < len(tokens):
+			value = tokens[i+1]
+		case strings.HasPrefix(token, "-J"):
+			value = token[2:]
+		case token == "-o" && i+1 < len(tokens) && strings.HasPrefix(strings.ToLower(tokens[i+1]), "proxyjump="):
+			value = tokens[i+1][len("proxyjump="):]
+		case strings.HasPrefix(strings.ToLower(token), "-oproxyjump="):
+			value = token[len("-oproxyjump="):]
+		default:
+			continue
+		}
+		return strings.Split(strings.Trim(value, `"'`), ",")
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package inventory
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseAnsibleInventory(t *testing.T) {
+	want := []AnsibleHost{
+		{Name: "bastion.example.com", Vars: map[string]string{"ansible_port": "2200"}},
+		{Name: "billing-db1.example.com", Groups: []string{"db", "prod"}, Vars: map[string]string{
+			"ansible_host":                 "10.0.0.5",
+			"ansible_user":                 "dba",
+			"ansible_ssh_private_key_file": "~/.ssh/id_deploy",
+			"ansible_ssh_common_args":      "-o ProxyJump=jump@bastion.example.com:2200",
+		}},
+		{Name: "billing-web01.example.com", Groups: []string{"web", "prod"}, Vars: map[string]string{
+			"ansible_user":            "deploy",
+			"ansible_port":            "2222",
+			"ansible_ssh_common_args": "-o ProxyJump=jump@bastion.example.com:2200",
+		}},
+		{Name: "billing-web02.example.com", Groups: []string{"web", "prod"}, Vars: map[string]string{
+			"ansible_user":            "deploy",
+			"ansible_port":            "2222",
+			"ansible_ssh_common_args": "-o ProxyJump=jump@bastion.example.com:2200",
+		}},
+	}
+
+	for _, path := range []string{"testdata/ansible/hosts.ini", "testdata/ansible/hosts.yml"} {
+		hosts, warnings, err := ParseAnsibleInventory(path)
+		if err != nil {
+			t.Errorf("%s: %s", path, err)
+			continue
+		}
+		// the formats declare the hosts in a different order
+		sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+		if !reflect.DeepEqual(hosts, want) {
+			t.Errorf("%s: hosts =\n%+v\nwant\n%+v", path, hosts, want)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "ansible_password uses a template") {
+			t.Errorf("%s: warnings = %v, want a warning about the template", path, warnings)
+		}
+	}
+}
+
+func TestParseAnsibleInventoryWithoutExtension(t *testing.T) {
+	for _, fixture := range []string{"hosts.ini", "hosts.yml"} {
+		data, err := os.ReadFile(filepath.Join("testdata/ansible", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "hosts")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		hosts, _, err := ParseAnsibleInventory(path)
+		if err != nil {
+			t.Errorf("%s: %s", fixture, err)
+		} else if len(hosts) != 4 {
+			t.Errorf("%s: got %d hosts, want 4", fixture, len(hosts))
+		}
+	}
+}
+
+func TestParseAnsibleInventoryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ini  string
+		want string
+	}{
+		{"invalid section", "[web\nhost1\n", "line 1: invalid section [web"},
+		{"invalid section suffix", "[web:hosts]\n", "line 1: invalid section [web:hosts]"},
+		{"vars without value", "[web:vars]\nansible_user\n", "line 2: expected key=value in the vars of web"},
+		{"host vars without value", "host1 ansible_user\n", "line 1: expected key=value after the host host1"},
+		{"unterminated quote", "host1 ansible_user='deploy\n", "line 1: unterminated quote"},
+		{"invalid range", "web[01-03]\n", "line 1: invalid host range in web[01-03]"},
+		{"cycle", "[a:children]\nb\n[b:children]\na\n", "lead to a cycle"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "hosts.ini")
+		if err := os.WriteFile(path, []byte(test.ini), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := ParseAnsibleInventory(path)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v doesn't contain %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestExpandHostPattern(t *testing.T) {
+	tests := map[string][]string{
+		"web.example.com":       {"web.example.com"},
+		"web[1:3]":              {"web1", "web2", "web3"},
+		"web[01:10:4].int":      {"web01.int", "web05.int", "web09.int"},
+		"db-[a:c]":              {"db-a", "db-b", "db-c"},
+		"rack[1:2]-node[a:b]":   {"rack1-nodea", "rack1-nodeb", "rack2-nodea", "rack2-nodeb"},
+		"web[08:11].example.de": {"web08.example.de", "web09.example.de", "web10.example.de", "web11.example.de"},
+	}
+	for pattern, want := range tests {
+		got, err := expandHostPattern(pattern)
+		if err != nil {
+			t.Errorf("expandHostPattern(%q) failed: %s", pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expandHostPattern(%q) = %v, want %v", pattern, got, want)
+		}
+	}
+
+	for _, pattern := range []string{"web[1:3", "web[1]", "web[1:3:0]", "web[aa:c]"} {
+		if _, err := expandHostPattern(pattern); err == nil {
+			t.Errorf("expandHostPattern(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestProxyJumpOf(t *testing.T) {
+	tests := map[string][]string{
+		"":                                 nil,
+		"-o StrictHostKeyChecking=no":      nil,
+		"-J bastion":                       {"bastion"},
+		"-Jdeploy@bastion:2200,gateway":    {"deploy@bastion:2200", "gateway"},
+		"-o ProxyJump=bastion":             {"bastion"},
+		`-oProxyJump="bastion,gateway" -v`: {"bastion", "gateway"},
+	}
+	for args, want := range tests {
+		if got := proxyJumpOf(args); !reflect.DeepEqual(got, want) {
+			t.Errorf("proxyJumpOf(%q) = %v, want %v", args, got, want)
+		}
+	}
+}
+
+func TestFromAnsibleHosts(t *testing.T) {
+	fakeHome(t)
+	hosts, _, err := ParseAnsibleInventory("testdata/ansible/hosts.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jimConfig, warnings, err := FromAnsibleHosts(hosts, Mapping{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+	if len(jimConfig.Keys) != 1 || jimConfig.Keys[0].Name != "id_deploy" {
+		t.Errorf("keys = %+v, want id_deploy", jimConfig.Keys)
+	}
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	type entry struct {
+		tag, group, env, host string
+		port                  int
+		username, keyRef      string
+		jump                  []string
+	}
+	want := []entry{
+		{"bastion.example.com", DefaultGroup, DefaultEnv, "bastion.example.com", 2200, localUser, "", nil},
+		{"billing-web01.example.com", "web", "PROD", "billing-web01.example.com", 2222, "deploy", "", []string{"bastion.example.com"}},
+		{"billing-web02.example.com", "web", "PROD", "billing-web02.example.com", 2222, "deploy", "", []string{"bastion.example.com"}},
+		{"billing-db1.example.com", "db", "PROD", "10.0.0.5", 22, "dba", "id_deploy", []string{"bastion.example.com"}},
+	}
+	var got []entry
+	for _, el := range jimConfig.Entries {
+		got = append(got, entry{el.Tag, el.Group, el.Env, el.Server.Host, el.Server.Port, el.Server.Username, el.Server.KeyRef, el.Server.Jump})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", got, want)
+	}
+
+	mapped, _, err := FromAnsibleHosts(hosts, Mapping{Group: "billing", Env: "INT"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, el := range mapped.Entries {
+		if el.Group != "billing" || el.Env != "INT" {
+			t.Errorf("the mapping is not applied to %s: %s/%s", el.Tag, el.Group, el.Env)
+		}
+	}
+}
+
+func TestFromAnsibleHostsInvalidPort(t *testing.T) {
+	hosts := []AnsibleHost{{Name: "web1", Vars: map[string]string{"ansible_port": "ssh"}}}
+	if _, _, err := FromAnsibleHosts(hosts, Mapping{}, nil); err == nil || !strings.Contains(err.Error(), "The port 'ssh' of 'web1' is not numeric") {
+		t.Errorf("expected an error about the port, got %v", err)
+	}
+}
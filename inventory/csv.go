@@ -0,0 +1,156 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/pkg/errors"
+)
+
+// CSVFields lists the fields, which can be imported from CSV files.
+// Aliases and jump hosts are separated by semicolons, key_file is the path of a private key file.
+var CSVFields = []string{"tag", "aliases", "group", "env", "host", "port", "username", "password", "dir", "key_file", "jump"}
+
+// FromCSV converts the rows of a CSV file with header line to jim config entries. Columns maps the fields
+// to the names of the columns in the header, fields missing in columns are read from the column of the same name,
+// if there is one. Only host is required, the tag defaults to the host, the port to 22 and the username to the
+// current user. Without group and env columns, the mapping determines group and env from the tag.
+func FromCSV(r io.Reader, columns map[string]string, delimiter rune, mapping Mapping, passphrase PassphraseFunc) (config.JimConfig, []string, error) {
+	jimConfig := config.JimConfig{Version: config.Version}
+	var warnings []string
+
+	for field := range columns {
+		if !isCSVField(field) {
+			return jimConfig, nil, errors.Errorf("Unknown field '%s', the fields are: %s", field, strings.Join(CSVFields, ", "))
+		}
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return jimConfig, nil, errors.New("The file is empty")
+	}
+	if err != nil {
+		return jimConfig, nil, err
+	}
+
+	// index maps the fields to the index of their column
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		for _, field := range CSVFields {
+			column, ok := columns[field]
+			if (ok && column == name) || (!ok && strings.EqualFold(field, name)) {
+				index[field] = i
+			}
+		}
+	}
+	for field, column := range columns {
+		if _, ok := index[field]; !ok {
+			return jimConfig, nil, errors.Errorf("The column '%s' of field %s is missing in the header", column, field)
+		}
+	}
+	if _, ok := index["host"]; !ok {
+		return jimConfig, nil, errors.New("The header lacks a host column, map it with --columns host=<column>")
+	}
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	keys := newKeyLoader(&jimConfig, passphrase, &warnings)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return jimConfig, warnings, err
+		}
+		line, _ := reader.FieldPos(0)
+		value := func(field string) string {
+			if i, ok := index[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		host := value("host")
+		if host == "" {
+			warnings = append(warnings, fmt.Sprintf("Skipped line %d, it has no host", line))
+			continue
+		}
+
+		el := config.JimConfigElement{
+			Tag: value("tag"),
+			Server: config.JimConfigEntry{
+				Host:     host,
+				Port:     22,
+				Username: value("username"),
+				Password: value("password"),
+				Dir:      value("dir"),
+			},
+		}
+		if el.Tag == "" {
+			el.Tag = host
+		}
+		if el.Server.Username == "" {
+			el.Server.Username = localUser
+		}
+		if port := value("port"); port != "" {
+			if el.Server.Port, err = strconv.Atoi(port); err != nil {
+				return jimConfig, warnings, errors.Errorf("Line %d: the port '%s' is not numeric", line, port)
+			}
+		}
+		el.Aliases = splitList(value("aliases"))
+		el.Server.Jump = splitList(value("jump"))
+		if keyFile := value("key_file"); keyFile != "" {
+			name, found, err := keys.load(expandHome(keyFile), el.Tag)
+			if err != nil {
+				return jimConfig, warnings, err
+			}
+			if !found {
+				return jimConfig, warnings, errors.Errorf("Line %d: the key file %s does not exist", line, keyFile)
+			}
+			el.Server.KeyRef = name
+		}
+
+		el.Group, el.Env = mapping.GroupAndEnv(el.Tag)
+		if group := value("group"); group != "" && mapping.Group == "" {
+			el.Group = group
+		}
+		if env := value("env"); env != "" && mapping.Env == "" {
+			el.Env = env
+		}
+		jimConfig.Entries = append(jimConfig.Entries, el)
+	}
+	return jimConfig, warnings, nil
+}
+
+// splitList splits a cell holding a list separated by semicolons
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func isCSVField(field string) bool {
+	for _, f := range CSVFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package inventory
+
+import (
+	"os"
+	"os/user"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var csvColumns = map[string]string{
+	"tag":      "Name",
+	"host":     "Address",
+	"port":     "SSH Port",
+	"username": "Login",
+	"key_file": "Key",
+}
+
+func TestFromCSV(t *testing.T) {
+	fakeHome(t)
+	file, err := os.Open("testdata/hosts.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	jimConfig, warnings, err := FromCSV(file, csvColumns, ',', Mapping{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Skipped line 4, it has no host"}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %v, want %v", warnings, want)
+	}
+	if len(jimConfig.Keys) != 1 || jimConfig.Keys[0].Name != "id_deploy" {
+		t.Errorf("keys = %+v, want id_deploy", jimConfig.Keys)
+	}
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	type entry struct {
+		tag, group, env, host string
+		port                  int
+		username, keyRef      string
+		aliases, jump         []string
+	}
+	want := []entry{
+		{"billing-web1-prod", "billing", "PROD", "10.0.0.1", 2222, "deploy", "id_deploy", []string{"web1", "w1"}, []string{"bastion"}},
+		{"billing-db1-prod", "billing-db", "PROD", "10.0.0.5", 22, "dba", "", nil, []string{"bastion", "gateway"}},
+		{"bastion.example.com", DefaultGroup, DefaultEnv, "bastion.example.com", 22, localUser, "", nil, nil},
+	}
+	var got []entry
+	for _, el := range jimConfig.Entries {
+		got = append(got, entry{el.Tag, el.Group, el.Env, el.Server.Host, el.Server.Port, el.Server.Username, el.Server.KeyRef, el.Aliases, el.Server.Jump})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestFromCSVMapping(t *testing.T) {
+	data := "host;group;env\nbilling-web1-prod;billing;QA\n"
+	jimConfig, _, err := FromCSV(strings.NewReader(data), nil, ';', Mapping{Group: "ops"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el := jimConfig.Entries[0]; el.Group != "ops" || el.Env != "QA" {
+		t.Errorf("group and env = %s/%s, want the group of the mapping and the env of the column", el.Group, el.Env)
+	}
+}
+
+func TestFromCSVErrors(t *testing.T) {
+	fakeHome(t)
+	tests := []struct {
+		name    string
+		data    string
+		columns map[string]string
+		want    string
+	}{
+		{"empty file", "", nil, "The file is empty"},
+		{"unknown field", "host\n", map[string]string{"hostname": "host"}, "Unknown field 'hostname'"},
+		{"missing column", "host\n", map[string]string{"port": "SSH Port"}, "The column 'SSH Port' of field port is missing"},
+		{"no host column", "name,port\n", nil, "The header lacks a host column"},
+		{"invalid port", "host,port\nweb1,22\nweb2,ssh\n", nil, "Line 3: the port 'ssh' is not numeric"},
+		{"missing key file", "host,key_file\nweb1,~/.ssh/id_missing\n", nil, "Line 2: the key file ~/.ssh/id_missing does not exist"},
+	}
+	for _, test := range tests {
+		_, _, err := FromCSV(strings.NewReader(test.data), test.columns, ',', Mapping{}, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %v doesn't contain %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/CryoCodec/jim/sshclient"
+)
+
+var invalidAliasChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// ExportOptions controls, how the exported hosts authenticate
+type ExportOptions struct {
+	// Helper is the path of the jim binary, which runs 'jim proxy' for entries authenticating with a password
+	Helper string
+	// IdentityAgent is the path of jim's agent socket, which serves the private keys of the vault
+	IdentityAgent string
+}
+
+// sshConfigBlock is a Host block of the exported OpenSSH config
+type sshConfigBlock struct {
+	alias   string
+	aliases []string
+	comment string
+	options [][2]string
+}
+
+// WriteSSHConfig writes a Host block for each matched server and its jump hosts to w. No secrets are written:
+// servers using a private key get jim's agent as IdentityAgent, servers using a password, or being reachable only
+// through jump hosts using a password, are connected by 'jim proxy' as ProxyCommand. Entries whose sessions have
+// to be recorded are skipped, since jim can't record sessions of other ssh clients.
+// Tags become Host patterns without spaces, clashing ones are numbered. The aliases of the entries become additional
+// patterns of their Host lines, unless they clash with a tag or an earlier alias.
+// The returned warnings name the skipped entries.
+func WriteSSHConfig(w io.Writer, matches []domain.Match, options ExportOptions) ([]string, error) {
+	var warnings []string
+	aliases := make(map[string]string)
+	used := make(map[string]bool)
+	aliasOf := func(tag string) string {
+		if alias, ok := aliases[tag]; ok {
+			return alias
+		}
+		base := sanitizeAlias(tag)
+		if base == "" {
+			base = "host"
+		}
+		alias := base
+		for i := 2; used[alias]; i++ {
+			alias = fmt.Sprintf("%s-%d", base, i)
+		}
+		aliases[tag] = alias
+		used[alias] = true
+		return alias
+	}
+
+	var blocks []sshConfigBlock
+	exported := make(map[string]bool)
+	add := func(tag string, block sshConfigBlock) {
+		if !exported[tag] {
+			exported[tag] = true
+			blocks = append(blocks, block)
+		}
+	}
+
+	// the tags of the exported servers take precedence over the aliases
+	for _, match := range matches {
+		if match.Server.Record {
+			continue
+		}
+		if !viaProxy(&match) {
+			for _, hop := range match.Jumps {
+				aliasOf(hop.Tag)
+			}
+		}
+		aliasOf(match.Tag)
+	}
+
+	for _, match := range matches {
+		if match.Server.Record {
+			warnings = append(warnings, fmt.Sprintf("Skipped '%s', its sessions have to be recorded, use 'jim connect' instead", match.Tag))
+			continue
+		}
+
+		// additional names of the entry, which clash with other names are left out
+		var extraAliases []string
+		for _, name := range match.Aliases {
+			if alias := sanitizeAlias(name); alias != "" && !used[alias] {
+				used[alias] = true
+				extraAliases = append(extraAliases, alias)
+			}
+		}
+
+		if viaProxy(&match) {
+			block := proxyBlock(aliasOf(match.Tag), match.Tag, &match.Server, options)
+			block.aliases = extraAliases
+			add(match.Tag, block)
+			continue
+		}
+
+		var jumps []string
+		for i, hop := range match.Jumps {
+			var hopJumps []string
+			for _, previous := range match.Jumps[:i] {
+				hopJumps = append(hopJumps, aliasOf(previous.Tag))
+			}
+			block := directBlock(aliasOf(hop.Tag), hop.Tag, &hop.Server, hopJumps, options)
+			block.comment += fmt.Sprintf(", jump host of %s", match.Tag)
+			add(hop.Tag, block)
+			jumps = append(jumps, aliasOf(hop.Tag))
+		}
+		block := directBlock(aliasOf(match.Tag), match.Tag, &match.Server, jumps, options)
+		block.aliases = extraAliases
+		add(match.Tag, block)
+	}
+
+	if _, err := fmt.Fprintln(w, "# Generated by 'jim export ssh-config', the secrets stay in jim's vault."); err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		patterns := strings.Join(append([]string{block.alias}, block.aliases...), " ")
+		if _, err := fmt.Fprintf(w, "\n# %s\nHost %s\n", block.comment, patterns); err != nil {
+			return nil, err
+		}
+		for _, option := range block.options {
+			if _, err := fmt.Fprintf(w, "    %s %s\n", option[0], option[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// directBlock lets ssh connect to the server itself, authenticating with jim's agent, if the server uses a key
+func directBlock(alias string, tag string, server *domain.Server, jumps []string, options ExportOptions) sshConfigBlock {
+	block := sshConfigBlock{alias: alias, comment: tag}
+	block.options = append(block.options, [2]string{"HostName", server.Host})
+	block.options = append(block.options, [2]string{"Port", strconv.Itoa(server.Port)})
+	if server.Username != "" {
+		block.options = append(block.options, [2]string{"User", server.Username})
+	}
+	if len(jumps) != 0 {
+		block.options = append(block.options, [2]string{"ProxyJump", strings.Join(jumps, ",")})
+	}
+	if len(server.PrivateKey) != 0 {
+		block.options = append(block.options, [2]string{"IdentityAgent", quoteOption(options.IdentityAgent)})
+	}
+	return block
+}
+
+// proxyBlock lets ssh connect through 'jim proxy', which authenticates against the server and its jump hosts.
+// jim verifies the host keys of the servers, the key presented by the proxy itself is generated on each start.
+func proxyBlock(alias string, tag string, server *domain.Server, options ExportOptions) sshConfigBlock {
+	command := fmt.Sprintf("%s proxy %s", sshclient.Quote(options.Helper), sshclient.Quote(tag))
+	block := sshConfigBlock{alias: alias, comment: tag + ", authenticated by jim"}
+	if server.Username != "" {
+		block.options = append(block.options, [2]string{"User", server.Username})
+	}
+	block.options = append(block.options,
+		[2]string{"ProxyCommand", strings.ReplaceAll(command, "%", "%%")},
+		[2]string{"StrictHostKeyChecking", "no"},
+		[2]string{"UserKnownHostsFile", "/dev/null"},
+		[2]string{"LogLevel", "ERROR"},
+	)
+	return block
+}
+
+func usesPassword(server *domain.Server) bool {
+	return len(server.PrivateKey) == 0 && len(server.Password) != 0
+}
+
+// viaProxy returns true, if the server or one of its jump hosts uses a password, so jim has to connect to it
+func viaProxy(match *domain.Match) bool {
+	if usesPassword(&match.Server) {
+		return true
+	}
+	for _, hop := range match.Jumps {
+		if usesPassword(&hop.Server) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeAlias turns a tag or alias into a Host pattern without wildcards or spaces
+func sanitizeAlias(name string) string {
+	return strings.Trim(invalidAliasChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// quoteOption quotes values containing spaces for OpenSSH config files
+func quoteOption(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
@@ -0,0 +1,81 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// PassphraseFunc returns the passphrase of the private key at keyPath. An empty passphrase skips the key.
+type PassphraseFunc func(keyPath string) ([]byte, error)
+
+// keyLoader adds private key files to the keys section of a config. Each file is read once, keys are named
+// by the base name of their file, which gets a numeric suffix, if the name is taken already.
+type keyLoader struct {
+	jimConfig  *config.JimConfig
+	passphrase PassphraseFunc
+	warnings   *[]string
+	// names maps the paths of the loaded files to their key names, skipped files map to an empty name
+	names map[string]string
+	used  map[string]bool
+}
+
+func newKeyLoader(jimConfig *config.JimConfig, passphrase PassphraseFunc, warnings *[]string) *keyLoader {
+	return &keyLoader{
+		jimConfig:  jimConfig,
+		passphrase: passphrase,
+		warnings:   warnings,
+		names:      make(map[string]string),
+		used:       make(map[string]bool),
+	}
+}
+
+// load adds the key file used by the host to the config and returns the name of the key.
+// Returns false, if the file doesn't exist. A key, whose passphrase isn't given, is skipped with an empty name.
+func (l *keyLoader) load(keyPath string, host string) (string, bool, error) {
+	if name, ok := l.names[keyPath]; ok {
+		return name, true, nil
+	}
+	pemBytes, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	key := config.JimKey{PrivateKey: string(pemBytes)}
+	if _, err := crypto.DecryptPrivateKey(pemBytes, nil); err != nil {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return "", false, errors.Errorf("Failed to read the private key %s: %s", keyPath, err)
+		}
+		secret, err := l.passphrase(keyPath)
+		if err != nil {
+			return "", false, err
+		}
+		if len(secret) == 0 {
+			*l.warnings = append(*l.warnings, fmt.Sprintf("Skipped the private key %s of '%s', no passphrase was given", keyPath, host))
+			l.names[keyPath] = ""
+			return "", true, nil
+		}
+		if _, err := crypto.DecryptPrivateKey(pemBytes, secret); err != nil {
+			return "", false, errors.Errorf("Failed to decrypt the private key %s: %s", keyPath, err)
+		}
+		key.Passphrase = string(secret)
+	}
+
+	key.Name = filepath.Base(keyPath)
+	for i := 2; l.used[key.Name]; i++ {
+		key.Name = fmt.Sprintf("%s-%d", filepath.Base(keyPath), i)
+	}
+	l.used[key.Name] = true
+	l.names[keyPath] = key.Name
+	l.jimConfig.Keys = append(l.jimConfig.Keys, key)
+	return key.Name, true, nil
+}
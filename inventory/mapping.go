@@ -0,0 +1,112 @@
+package inventory
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultGroup is the group of imported entries, whose group can't be derived from their name
+	DefaultGroup = "Imported"
+	// DefaultEnv is the env of imported entries, whose env can't be derived from their name
+	DefaultEnv = "DEFAULT"
+)
+
+// knownEnvs maps the env names recognized in host names to the env of the imported entry
+var knownEnvs = map[string]string{
+	"dev":         "DEV",
+	"development": "DEV",
+	"test":        "TEST",
+	"qa":          "QA",
+	"int":         "INT",
+	"uat":         "UAT",
+	"stage":       "STAGE",
+	"staging":     "STAGE",
+	"preprod":     "PREPROD",
+	"prod":        "PROD",
+	"production":  "PROD",
+}
+
+// Mapping controls, how imported hosts are mapped to the group and env of jim entries
+type Mapping struct {
+	// Group is used for all imported entries, if set. Otherwise it's derived from the name of the host.
+	Group string
+	// Env is used for all imported entries, if set. Otherwise it's derived from the name of the host.
+	Env string
+}
+
+// GroupAndEnv returns the group and env of the host with given name.
+// The first label of the name is split at dashes, underscores and spaces, e.g. billing-web1-prod.example.com is split into
+// billing, web1 and prod. A part naming a well known env like prod, int or staging determines the env,
+// the first other part determines the group, if there are at least two parts.
+// Otherwise DefaultGroup and DefaultEnv are used.
+func (m Mapping) GroupAndEnv(name string) (string, string) {
+	group, env := deriveFromName(name)
+	return m.apply(group, env)
+}
+
+// GroupAndEnvOfGroups returns the group and env of a host, which is a member of the given inventory groups,
+// ordered from the most specific to the least specific group. A group named like a well known env determines
+// the env, the first other group determines the group. Whatever can't be determined from the groups,
+// is derived from the name of the host like GroupAndEnv does.
+func (m Mapping) GroupAndEnvOfGroups(groups []string, name string) (string, string) {
+	group, env := "", ""
+	for _, g := range groups {
+		if known, ok := knownEnvs[strings.ToLower(g)]; ok {
+			if env == "" {
+				env = known
+			}
+		} else if group == "" {
+			group = g
+		}
+	}
+
+	derivedGroup, derivedEnv := deriveFromName(name)
+	if group == "" {
+		group = derivedGroup
+	}
+	if env == "" {
+		env = derivedEnv
+	}
+	return m.apply(group, env)
+}
+
+// deriveFromName returns the group and env contained in the name of a host, or empty strings
+func deriveFromName(name string) (string, string) {
+	label := strings.SplitN(name, ".", 2)[0]
+	parts := strings.FieldsFunc(label, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+
+	group, env := "", ""
+	for _, part := range parts {
+		if known, ok := knownEnvs[strings.ToLower(part)]; ok && env == "" {
+			env = known
+		} else if group == "" && len(parts) > 1 && !isNumeric(part) {
+			group = part
+		}
+	}
+	return group, env
+}
+
+// apply overrides group and env with the ones of the mapping, empty values are replaced by the defaults
+func (m Mapping) apply(group string, env string) (string, string) {
+	if m.Group != "" {
+		group = m.Group
+	} else if group == "" {
+		group = DefaultGroup
+	}
+	if m.Env != "" {
+		env = m.Env
+	} else if env == "" {
+		env = DefaultEnv
+	}
+	return group, env
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
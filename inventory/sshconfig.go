@@ -0,0 +1,396 @@
+// Package inventory converts between jim's config and other formats describing servers, like OpenSSH config files.
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/CryoCodec/jim/config"
+	"github.com/pkg/errors"
+)
+
+// maxIncludeDepth limits nested Include directives like OpenSSH does
+const maxIncludeDepth = 16
+
+// SSHHost is a host declared in an OpenSSH config file with the settings of all Host blocks matching it
+type SSHHost struct {
+	// Alias is the first name of the host in its Host line
+	Alias string
+	// OtherNames lists the further names of the host in its Host line
+	OtherNames []string
+	HostName   string
+	// Port is 0, if the config file doesn't set it
+	Port int
+	User string
+	// ProxyJump lists the jump hosts in the format [user@]host[:port], starting with the first hop
+	ProxyJump []string
+	// IdentityFiles lists the paths of the private keys, in the order ssh tries them
+	IdentityFiles []string
+}
+
+// directive is a keyword with its arguments in an OpenSSH config file
+type directive struct {
+	keyword string
+	args    []string
+	// location is file:line, used for warnings
+	location string
+}
+
+// block is a Host or Match block of an OpenSSH config file
+type block struct {
+	patterns []string
+	// supported is false for Match blocks, which can't be evaluated without connecting
+	supported  bool
+	directives []directive
+}
+
+// ParseSSHConfig reads the OpenSSH config file at path and the files it includes.
+// Returns all hosts declared without wildcards in the order of their declaration, followed by the jump hosts,
+// which are only named in ProxyJump. The settings of all matching Host blocks are applied with the first
+// obtained value winning, like ssh does.
+// Directives, which can't be imported, are reported as warnings.
+func ParseSSHConfig(configPath string) ([]SSHHost, []string, error) {
+	var warnings []string
+	directives, err := readSSHConfig(configPath, 0)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	// directives before the first Host line apply to all hosts
+	blocks := []block{{patterns: []string{"*"}, supported: true}}
+	var aliases []string
+	otherNames := make(map[string][]string)
+	declared := make(map[string]bool)
+	for _, d := range directives {
+		switch d.keyword {
+		case "host":
+			blocks = append(blocks, block{patterns: d.args, supported: true})
+			alias := ""
+			for _, pattern := range d.args {
+				if strings.ContainsAny(pattern, "*?!") || declared[pattern] {
+					continue
+				}
+				declared[pattern] = true
+				if alias == "" {
+					alias = pattern
+					aliases = append(aliases, pattern)
+				} else {
+					otherNames[alias] = append(otherNames[alias], pattern)
+				}
+			}
+		case "match":
+			blocks = append(blocks, block{})
+			warnings = append(warnings, fmt.Sprintf("%s: Match blocks are not supported, their settings are ignored", d.location))
+		case "proxycommand":
+			warnings = append(warnings, fmt.Sprintf("%s: ProxyCommand is not supported, use ProxyJump instead", d.location))
+		default:
+			blocks[len(blocks)-1].directives = append(blocks[len(blocks)-1].directives, d)
+		}
+	}
+
+	resolve := func(alias string) SSHHost {
+		host := SSHHost{Alias: alias, OtherNames: otherNames[alias]}
+		for _, b := range blocks {
+			if b.supported && matchesHost(b.patterns, alias) {
+				applyDirectives(&host, b.directives, &warnings)
+			}
+		}
+		if host.HostName == "" {
+			host.HostName = alias
+		}
+		return host
+	}
+
+	var hosts []SSHHost
+	for _, alias := range aliases {
+		hosts = append(hosts, resolve(alias))
+	}
+
+	// jump hosts, which are not declared themselves, are added with the settings given in ProxyJump
+	for i := 0; i < len(hosts); i++ {
+		for _, hop := range hosts[i].ProxyJump {
+			username, alias, port := splitJumpHost(hop)
+			if declared[alias] {
+				continue
+			}
+			declared[alias] = true
+			host := resolve(alias)
+			if username != "" {
+				host.User = username
+			}
+			if port != 0 {
+				host.Port = port
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, warnings, nil
+}
+
+// readSSHConfig returns the directives of the config file, Include directives are replaced by the directives of the included files
+func readSSHConfig(configPath string, depth int) ([]directive, error) {
+	if depth > maxIncludeDepth {
+		return nil, errors.Errorf("Too many nested includes in %s", configPath)
+	}
+
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var directives []directive
+	scanner := bufio.NewScanner(file)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		keyword, args, err := parseSSHConfigLine(scanner.Text())
+		location := fmt.Sprintf("%s:%d", configPath, lineNr)
+		if err != nil {
+			return nil, errors.Errorf("%s: %s", location, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		if keyword != "include" {
+			directives = append(directives, directive{keyword: keyword, args: args, location: location})
+			continue
+		}
+		for _, pattern := range args {
+			// relative includes of user config files are relative to ~/.ssh
+			pattern = expandHome(pattern)
+			if !filepath.IsAbs(pattern) {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					return nil, err
+				}
+				pattern = filepath.Join(home, ".ssh", pattern)
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, errors.Errorf("%s: invalid include %s: %s", location, pattern, err)
+			}
+			for _, match := range matches {
+				included, err := readSSHConfig(match, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				directives = append(directives, included...)
+			}
+		}
+	}
+	return directives, scanner.Err()
+}
+
+// parseSSHConfigLine splits a line into the lower cased keyword and its arguments.
+// Keyword and arguments are separated by whitespace or an equal sign, arguments may be quoted.
+// Returns an empty keyword for blank lines and comments.
+func parseSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	var current strings.Builder
+	quoted, inArg := false, false
+	for _, c := range rest {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return "", nil, errors.New("unbalanced quotes")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return keyword, args, nil
+}
+
+// matchesHost tells, whether the host patterns of a Host line match the alias.
+// At least one pattern has to match, negated patterns must not match.
+func matchesHost(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		// path.Match implements the * and ? wildcards of ssh, host names don't contain slashes
+		ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(pattern, "!")), strings.ToLower(alias))
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// applyDirectives sets the supported settings of the host, which are not set yet. Identity files are accumulated.
+func applyDirectives(host *SSHHost, directives []directive, warnings *[]string) {
+	for _, d := range directives {
+		if len(d.args) == 0 {
+			continue
+		}
+		switch d.keyword {
+		case "hostname":
+			if host.HostName == "" {
+				host.HostName = strings.ReplaceAll(strings.ReplaceAll(d.args[0], "%h", host.Alias), "%%", "%")
+			}
+		case "port":
+			if host.Port == 0 {
+				port, err := strconv.Atoi(d.args[0])
+				if err != nil {
+					*warnings = append(*warnings, fmt.Sprintf("%s: ignoring invalid port %s", d.location, d.args[0]))
+					continue
+				}
+				host.Port = port
+			}
+		case "user":
+			if host.User == "" {
+				host.User = d.args[0]
+			}
+		case "proxyjump":
+			if host.ProxyJump == nil {
+				host.ProxyJump = []string{}
+				if !strings.EqualFold(d.args[0], "none") {
+					for _, hop := range strings.Split(d.args[0], ",") {
+						host.ProxyJump = append(host.ProxyJump, strings.TrimPrefix(hop, "ssh://"))
+					}
+				}
+			}
+		case "identityfile":
+			host.IdentityFiles = append(host.IdentityFiles, d.args[0])
+		}
+	}
+}
+
+// FromSSHHosts converts the hosts to jim config entries, mapped to groups and envs by the mapping.
+// The first existing identity file of a host is added to the keys of the config, keys protected by a passphrase
+// are only added, if passphrase returns the passphrase for the key file. An empty passphrase skips the key.
+// Hosts without user and port use the current user and port 22, like ssh does.
+func FromSSHHosts(hosts []SSHHost, mapping Mapping, passphrase PassphraseFunc) (config.JimConfig, []string, error) {
+	jimConfig := config.JimConfig{Version: config.Version}
+	var warnings []string
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+
+	// jump hosts may be referenced by any of their names
+	aliasOf := make(map[string]string)
+	for _, host := range hosts {
+		for _, name := range host.OtherNames {
+			aliasOf[name] = host.Alias
+		}
+	}
+
+	keys := newKeyLoader(&jimConfig, passphrase, &warnings)
+	addKey := func(host SSHHost, username string) (string, error) {
+		for _, identityFile := range host.IdentityFiles {
+			name, found, err := keys.load(expandTokens(identityFile, host, username, localUser), host.Alias)
+			if err != nil || found {
+				return name, err
+			}
+		}
+		if len(host.IdentityFiles) != 0 {
+			warnings = append(warnings, fmt.Sprintf("None of the identity files of '%s' exists", host.Alias))
+		}
+		return "", nil
+	}
+
+	for _, host := range hosts {
+		username := host.User
+		if username == "" {
+			username = localUser
+		}
+		port := host.Port
+		if port == 0 {
+			port = 22
+		}
+
+		keyRef, err := addKey(host, username)
+		if err != nil {
+			return jimConfig, warnings, err
+		}
+
+		var jump []string
+		for _, hop := range host.ProxyJump {
+			_, name, _ := splitJumpHost(hop)
+			if alias, ok := aliasOf[name]; ok {
+				name = alias
+			}
+			jump = append(jump, name)
+		}
+
+		group, env := mapping.GroupAndEnv(host.Alias)
+		jimConfig.Entries = append(jimConfig.Entries, config.JimConfigElement{
+			Group:   group,
+			Env:     env,
+			Tag:     host.Alias,
+			Aliases: host.OtherNames,
+			Server: config.JimConfigEntry{
+				Host:     host.HostName,
+				Port:     port,
+				Username: username,
+				KeyRef:   keyRef,
+				Jump:     jump,
+			},
+		})
+	}
+	return jimConfig, warnings, nil
+}
+
+// splitJumpHost splits a ProxyJump hop in the format [user@]host[:port]. Returns port 0, if it's not set.
+func splitJumpHost(hop string) (string, string, int) {
+	var username string
+	if i := strings.LastIndex(hop, "@"); i >= 0 {
+		username, hop = hop[:i], hop[i+1:]
+	}
+	if i := strings.LastIndex(hop, ":"); i >= 0 && !strings.HasSuffix(hop, "]") {
+		if port, err := strconv.Atoi(hop[i+1:]); err == nil {
+			return username, strings.Trim(hop[:i], "[]"), port
+		}
+	}
+	return username, strings.Trim(hop, "[]"), 0
+}
+
+// expandTokens replaces ~ and the tokens %d, %u, %h, %r and %% of an identity file path
+func expandTokens(value string, host SSHHost, username string, localUser string) string {
+	home, _ := os.UserHomeDir()
+	value = expandHome(value)
+	replacer := strings.NewReplacer("%d", home, "%u", localUser, "%h", host.HostName, "%r", username, "%%", "%")
+	return replacer.Replace(value)
+}
+
+func expandHome(value string) string {
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(value, "~"))
+		}
+	}
+	return value
+}
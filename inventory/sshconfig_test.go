@@ -0,0 +1,173 @@
+package inventory
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeHome copies the files of testdata/ssh and testdata/keys to ~/.ssh of a temporary home directory
+func fakeHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, dir := range []string{"testdata/ssh", "testdata/keys"} {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			target := filepath.Join(home, ".ssh", rel)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, 0600)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestParseSSHConfig(t *testing.T) {
+	home := fakeHome(t)
+	hosts, warnings, err := ParseSSHConfig(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SSHHost{
+		{Alias: "work-app1-int", HostName: "app1.work.example.com", User: "worker", IdentityFiles: []string{"~/.ssh/id_locked"}},
+		{Alias: "bastion", OtherNames: []string{"jump"}, HostName: "bastion.example.com", Port: 2200, User: "admin"},
+		{Alias: "billing-web1-prod", OtherNames: []string{"web1"}, HostName: "10.0.0.1", Port: 2222, User: "admin",
+			ProxyJump:     []string{"jump"},
+			IdentityFiles: []string{"~/.ssh/id_missing", "~/.ssh/id_deploy", "~/.ssh/id_deploy"}},
+		{Alias: "billing-db1-prod", HostName: "billing-db1-prod.int", Port: 2222, User: "dba",
+			ProxyJump:     []string{"deploy@gateway:2022", "bastion"},
+			IdentityFiles: []string{"~/.ssh/id_deploy"}},
+		{Alias: "legacy", HostName: "legacy"},
+		{Alias: "gateway", HostName: "gateway", Port: 2022, User: "deploy"},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts =\n%+v\nwant\n%+v", hosts, want)
+	}
+
+	wantWarnings := []string{
+		"config:19: Match blocks are not supported",
+		"config:23: ProxyCommand is not supported",
+		"config:24: ignoring invalid port ssh",
+	}
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("warnings = %v, want %d warnings", warnings, len(wantWarnings))
+	}
+	for i, warning := range warnings {
+		if !strings.Contains(warning, wantWarnings[i]) {
+			t.Errorf("warning %q doesn't contain %q", warning, wantWarnings[i])
+		}
+	}
+}
+
+func TestParseSSHConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	unbalanced := filepath.Join(dir, "unbalanced")
+	if err := os.WriteFile(unbalanced, []byte("Host a\n  HostName \"a.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseSSHConfig(unbalanced); err == nil || !strings.Contains(err.Error(), "unbalanced:2: unbalanced quotes") {
+		t.Errorf("expected an error about unbalanced quotes, got %v", err)
+	}
+
+	recursive := filepath.Join(dir, "recursive")
+	if err := os.WriteFile(recursive, []byte("Include "+recursive+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseSSHConfig(recursive); err == nil || !strings.Contains(err.Error(), "Too many nested includes") {
+		t.Errorf("expected an error about nested includes, got %v", err)
+	}
+}
+
+func TestFromSSHHosts(t *testing.T) {
+	home := fakeHome(t)
+	hosts, _, err := ParseSSHConfig(filepath.Join(home, ".ssh", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var asked []string
+	passphrase := func(keyPath string) ([]byte, error) {
+		asked = append(asked, filepath.Base(keyPath))
+		return nil, nil
+	}
+	jimConfig, warnings, err := FromSSHHosts(hosts, Mapping{}, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(asked, []string{"id_locked"}) {
+		t.Errorf("asked for the passphrases of %v, want id_locked only", asked)
+	}
+	if len(jimConfig.Keys) != 1 || jimConfig.Keys[0].Name != "id_deploy" || jimConfig.Keys[0].Passphrase != "" {
+		t.Errorf("keys = %+v, want the unencrypted id_deploy only", jimConfig.Keys)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Skipped the private key") {
+		t.Errorf("warnings = %v, want a warning about the skipped key", warnings)
+	}
+
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	type entry struct {
+		tag, group, env, host string
+		port                  int
+		username, keyRef      string
+		jump                  []string
+	}
+	want := []entry{
+		{"work-app1-int", "work", "INT", "app1.work.example.com", 22, "worker", "", nil},
+		{"bastion", DefaultGroup, DefaultEnv, "bastion.example.com", 2200, "admin", "", nil},
+		{"billing-web1-prod", "billing", "PROD", "10.0.0.1", 2222, "admin", "id_deploy", []string{"bastion"}},
+		{"billing-db1-prod", "billing", "PROD", "billing-db1-prod.int", 2222, "dba", "id_deploy", []string{"gateway", "bastion"}},
+		{"legacy", DefaultGroup, DefaultEnv, "legacy", 22, localUser, "", nil},
+		{"gateway", DefaultGroup, DefaultEnv, "gateway", 2022, "deploy", "", nil},
+	}
+	var got []entry
+	for _, el := range jimConfig.Entries {
+		got = append(got, entry{el.Tag, el.Group, el.Env, el.Server.Host, el.Server.Port, el.Server.Username, el.Server.KeyRef, el.Server.Jump})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries =\n%+v\nwant\n%+v", got, want)
+	}
+	if aliases := jimConfig.Entries[1].Aliases; !reflect.DeepEqual(aliases, []string{"jump"}) {
+		t.Errorf("aliases of bastion = %v, want [jump]", aliases)
+	}
+}
+
+func TestSplitJumpHost(t *testing.T) {
+	tests := []struct {
+		hop      string
+		username string
+		host     string
+		port     int
+	}{
+		{"bastion", "", "bastion", 0},
+		{"deploy@bastion:2200", "deploy", "bastion", 2200},
+		{"[fe80::1]:2200", "", "fe80::1", 2200},
+		{"[fe80::1]", "", "fe80::1", 0},
+		{"a@b@bastion", "a@b", "bastion", 0},
+	}
+	for _, test := range tests {
+		username, host, port := splitJumpHost(test.hop)
+		if username != test.username || host != test.host || port != test.port {
+			t.Errorf("splitJumpHost(%q) = %q, %q, %d, want %q, %q, %d", test.hop, username, host, port, test.username, test.host, test.port)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package recordings
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/pkg/errors"
+)
+
+// encryptedMagic starts every encrypted recording
+var encryptedMagic = []byte("JIMREC01")
+
+// maxChunkSize protects against allocating huge buffers for corrupt files
+const maxChunkSize = 1 << 20
+
+// chunkWriter encrypts every write as a separate chunk, so a recording stays readable up to the last chunk,
+// even if the session ends unexpectedly. Each chunk is prefixed with its length.
+// The sequence number of the chunk is authenticated, so chunks can't be reordered.
+type chunkWriter struct {
+	out      io.Writer
+	key      []byte
+	sequence uint64
+}
+
+func newChunkWriter(out io.Writer, key []byte) (*chunkWriter, error) {
+	if _, err := out.Write(encryptedMagic); err != nil {
+		return nil, err
+	}
+	return &chunkWriter{out: out, key: key}, nil
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	sealed, err := crypto.EncryptWithKey(w.key, p, sequenceBytes(w.sequence))
+	if err != nil {
+		return 0, err
+	}
+	w.sequence++
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := w.out.Write(append(length[:], sealed...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// chunkReader decrypts the chunks written by a chunkWriter
+type chunkReader struct {
+	in       io.Reader
+	key      []byte
+	sequence uint64
+	buffer   bytes.Buffer
+}
+
+func newChunkReader(in io.Reader, key []byte) (*chunkReader, error) {
+	magic := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(in, magic); err != nil || !bytes.Equal(magic, encryptedMagic) {
+		return nil, errors.New("not an encrypted jim recording")
+	}
+	return &chunkReader{in: in, key: key}, nil
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.buffer.Len() == 0 {
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return r.buffer.Read(p)
+}
+
+func (r *chunkReader) readChunk() error {
+	var length [4]byte
+	if _, err := io.ReadFull(r.in, length[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return errors.New("the recording is truncated")
+		}
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxChunkSize {
+		return errors.New("the recording is corrupt")
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(r.in, sealed); err != nil {
+		return errors.New("the recording is truncated")
+	}
+
+	plain, err := crypto.DecryptWithKey(r.key, sealed, sequenceBytes(r.sequence))
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt the recording")
+	}
+	r.sequence++
+	r.buffer.Write(plain)
+	return nil
+}
+
+func sequenceBytes(sequence uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], sequence)
+	return b[:]
+}
@@ -0,0 +1,195 @@
+package recordings
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/CryoCodec/jim/crypto"
+)
+
+var testChunks = []string{"{\"version\": 2}\n", "[0.1, \"o\", \"$ \"]\n", "", "[0.5, \"o\", \"ls\\r\\n\"]\n"}
+
+// encryptChunks writes every chunk with a separate write and returns the recording and the encrypted chunks
+// with their length prefix, in the order they were written
+func encryptChunks(t *testing.T, key []byte, chunks []string) ([]byte, [][]byte) {
+	t.Helper()
+	out := bytes.NewBuffer(nil)
+	w, err := newChunkWriter(out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sealed [][]byte
+	for _, chunk := range chunks {
+		start := out.Len()
+		if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("writing %q returned %d, %v", chunk, n, err)
+		}
+		sealed = append(sealed, append([]byte(nil), out.Bytes()[start:]...))
+	}
+	return out.Bytes(), sealed
+}
+
+func assemble(chunks ...[]byte) []byte {
+	return append(append([]byte(nil), encryptedMagic...), bytes.Join(chunks, nil)...)
+}
+
+func decryptAll(key []byte, data []byte) ([]byte, error) {
+	r, err := newChunkReader(bytes.NewReader(data), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func generateKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	key := generateKey(t)
+	data, sealed := encryptChunks(t, key, testChunks)
+
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		t.Errorf("the recording doesn't start with %s", encryptedMagic)
+	}
+	plaintext := strings.Join(testChunks, "")
+	if bytes.Contains(data, []byte("version")) {
+		t.Errorf("the recording contains the plaintext")
+	}
+	for i, chunk := range sealed {
+		if size := binary.BigEndian.Uint32(chunk); int(size) != len(chunk)-4 {
+			t.Errorf("chunk %d has the length prefix %d, but %d bytes", i, size, len(chunk)-4)
+		}
+	}
+
+	decrypted, err := decryptAll(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != plaintext {
+		t.Errorf("decrypted %q, want %q", decrypted, plaintext)
+	}
+
+	// reading in small pieces spans chunks
+	r, err := newChunkReader(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pieces []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := r.Read(buf)
+		pieces = append(pieces, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(pieces) != plaintext {
+		t.Errorf("reading in pieces returned %q, want %q", pieces, plaintext)
+	}
+}
+
+func TestChunkReaderRejectsOtherFiles(t *testing.T) {
+	key := generateKey(t)
+	data, _ := encryptChunks(t, key, testChunks)
+
+	for name, other := range map[string][]byte{
+		"plain recording": []byte("{\"version\": 2}\n"),
+		"other magic":     append([]byte("JIMREC02"), data[len(encryptedMagic):]...),
+		"empty file":      nil,
+	} {
+		if _, err := newChunkReader(bytes.NewReader(other), key); err == nil || !strings.Contains(err.Error(), "not an encrypted jim recording") {
+			t.Errorf("%s: expected an error about the format, got %v", name, err)
+		}
+	}
+
+	if _, err := decryptAll(generateKey(t), data); err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+		t.Errorf("decrypting with another key returned %v", err)
+	}
+}
+
+func TestReorderedChunksAreRejected(t *testing.T) {
+	key := generateKey(t)
+	_, sealed := encryptChunks(t, key, testChunks)
+
+	tests := map[string][]byte{
+		"swapped":        assemble(sealed[1], sealed[0], sealed[2], sealed[3]),
+		"first dropped":  assemble(sealed[1], sealed[2], sealed[3]),
+		"middle dropped": assemble(sealed[0], sealed[1], sealed[3]),
+		"chunk replayed": assemble(sealed[0], sealed[0], sealed[1], sealed[2], sealed[3]),
+		"chunk inserted": assemble(sealed[0], encryptedChunk(t, key, 5, "[9.9, \"o\", \"rm -rf /\"]\n"), sealed[1], sealed[2], sealed[3]),
+	}
+	for name, data := range tests {
+		if _, err := decryptAll(key, data); err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+			t.Errorf("%s: expected a decryption error, got %v", name, err)
+		}
+	}
+}
+
+func TestTruncatedRecording(t *testing.T) {
+	key := generateKey(t)
+	data, sealed := encryptChunks(t, key, testChunks)
+	end := len(data) - len(sealed[3])
+
+	// a session, which ends unexpectedly, leaves complete chunks, which stay readable
+	decrypted, err := decryptAll(key, data[:end])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(testChunks[:3], ""); string(decrypted) != want {
+		t.Errorf("decrypted %q, want %q", decrypted, want)
+	}
+
+	for _, n := range []int{end + 1, end + 3, end + 4, end + 10, len(data) - 1} {
+		if _, err := decryptAll(key, data[:n]); err == nil || !strings.Contains(err.Error(), "truncated") {
+			t.Errorf("reading the first %d of %d bytes returned %v, want an error about the truncation", n, len(data), err)
+		}
+	}
+}
+
+func TestTamperedChunksAreRejected(t *testing.T) {
+	key := generateKey(t)
+	data, sealed := encryptChunks(t, key, testChunks)
+
+	offset := len(encryptedMagic)
+	for i, chunk := range sealed {
+		for _, position := range []int{4, len(chunk) / 2, len(chunk) - 1} {
+			tampered := append([]byte(nil), data...)
+			tampered[offset+position] ^= 1
+			if _, err := decryptAll(key, tampered); err == nil {
+				t.Errorf("flipping byte %d of chunk %d wasn't detected", position, i)
+			}
+		}
+		offset += len(chunk)
+	}
+
+	huge := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(huge[len(encryptedMagic):], maxChunkSize+1)
+	if _, err := decryptAll(key, huge); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("a huge chunk length returned %v, want an error about the corruption", err)
+	}
+}
+
+// encryptedChunk encrypts plaintext as chunk with given sequence number
+func encryptedChunk(t *testing.T, key []byte, sequence uint64, plaintext string) []byte {
+	t.Helper()
+	sealed, err := crypto.EncryptWithKey(key, []byte(plaintext), sequenceBytes(sequence))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	return append(length[:], sealed...)
+}
@@ -0,0 +1,75 @@
+package recordings
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReadHeader reads the header line of an asciicast v2 recording
+func ReadHeader(reader *bufio.Reader) (*Header, error) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, errors.Wrap(err, "failed to read the header of the recording")
+	}
+
+	var header Header
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, errors.Wrap(err, "invalid header")
+	}
+	if header.Version != 2 {
+		return nil, errors.Errorf("unsupported asciicast version %d", header.Version)
+	}
+	return &header, nil
+}
+
+// Play writes the output events of the asciicast v2 recording to out, keeping the recorded timing.
+// The speed factor speeds up the replay, maxIdle limits pauses between events, if it's positive.
+func Play(reader *bufio.Reader, out io.Writer, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	var last float64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) != 0 {
+			var event []interface{}
+			if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+				return errors.Wrap(jsonErr, "invalid event in recording")
+			}
+			if len(event) != 3 {
+				return errors.New("invalid event in recording")
+			}
+
+			at, _ := event[0].(float64)
+			eventType, _ := event[1].(string)
+			data, _ := event[2].(string)
+
+			pause := time.Duration((at - last) / speed * float64(time.Second))
+			if maxIdle > 0 && pause > maxIdle {
+				pause = maxIdle
+			}
+			if pause > 0 {
+				time.Sleep(pause)
+			}
+			last = at
+
+			if eventType == "o" {
+				if _, err := io.WriteString(out, data); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package recordings records connect sessions in the asciicast v2 format of asciinema (https://asciinema.org)
+// and replays them in the terminal. Recordings may be encrypted with a key stored in the vault.
+package recordings
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header is the first line of an asciicast v2 file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes everything written to it as output events of an asciicast v2 recording.
+// It is safe for concurrent use, so stdout and stderr of a session may share a recorder.
+// Writes never fail, so a broken recording doesn't interrupt the session. Close reports the first error.
+type Recorder struct {
+	lock  sync.Mutex
+	file  io.Closer
+	out   *bufio.Writer
+	start time.Time
+	// pending holds an incomplete utf-8 sequence at the end of the last write
+	pending []byte
+	err     error
+	// Path is the location of the recording
+	Path string
+}
+
+func newRecorder(path string, file io.WriteCloser, out io.Writer, header Header) (*Recorder, error) {
+	r := &Recorder{Path: path, file: file, out: bufio.NewWriter(out), start: time.Now()}
+	line, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.writeLine(line); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write records p as output event
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return len(p), nil
+	}
+
+	data := append(r.pending, p...)
+	complete := completeUTF8Prefix(data)
+	r.pending = append([]byte{}, data[complete:]...)
+	if complete == 0 {
+		return len(p), nil
+	}
+
+	line, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), "o", string(data[:complete])})
+	if err == nil {
+		err = r.writeLine(line)
+	}
+	r.err = err
+	return len(p), nil
+}
+
+func (r *Recorder) writeLine(line []byte) error {
+	if _, err := r.out.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// flushing each event keeps the recording readable, even if jim is killed
+	return r.out.Flush()
+}
+
+// Close finishes the recording
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	err := r.file.Close()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// completeUTF8Prefix returns the length of data without a trailing incomplete utf-8 sequence,
+// since asciicast events have to be valid utf-8 strings
+func completeUTF8Prefix(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(data[i]) {
+			continue
+		}
+		if utf8.FullRune(data[i:]) {
+			return len(data)
+		}
+		return i
+	}
+	return len(data)
+}
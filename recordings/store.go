@@ -0,0 +1,174 @@
+package recordings
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CryoCodec/jim/files"
+	"github.com/pkg/errors"
+)
+
+const (
+	extension          = ".cast"
+	encryptedExtension = ".cast.enc"
+	timeLayout         = "20060102T150405"
+)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Recording describes a stored recording
+type Recording struct {
+	// Name is the file name of the recording
+	Name string
+	Path string
+	// Tag is the tag of the recorded entry, reduced to characters safe for file names
+	Tag       string
+	Time      time.Time
+	Size      int64
+	Encrypted bool
+}
+
+// Dir returns the directory of the recordings ~/.jim/recordings
+func Dir() string {
+	return filepath.Join(files.GetJimConfigDir(), "recordings")
+}
+
+// Create starts a new recording of a session with the entry with given tag.
+// The recording is encrypted, if key is not nil.
+func Create(tag string, width int, height int, key []byte) (*Recorder, error) {
+	if err := os.MkdirAll(Dir(), 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create the recordings directory")
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s_%s", now.Format(timeLayout), unsafeFileNameChars.ReplaceAllString(tag, "-"))
+	if key != nil {
+		name += encryptedExtension
+	} else {
+		name += extension
+	}
+
+	path := filepath.Join(Dir(), name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the recording")
+	}
+
+	var out io.Writer = file
+	if key != nil {
+		if out, err = newChunkWriter(file, key); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	header := Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: now.Unix(),
+		Title:     tag,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	}
+	recorder, err := newRecorder(path, file, out, header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return recorder, nil
+}
+
+// List returns all stored recordings, oldest first
+func List() ([]Recording, error) {
+	entries, err := ioutil.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Recording
+	for _, entry := range entries {
+		if recording, ok := parseFileName(entry.Name()); ok {
+			recording.Size = entry.Size()
+			result = append(result, recording)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Find returns the recording with given file name
+func Find(name string) (*Recording, error) {
+	recording, ok := parseFileName(filepath.Base(name))
+	if !ok {
+		return nil, errors.Errorf("'%s' is not a recording", name)
+	}
+
+	info, err := os.Stat(recording.Path)
+	if err != nil {
+		return nil, errors.Errorf("there is no recording '%s'", name)
+	}
+	recording.Size = info.Size()
+	return &recording, nil
+}
+
+// Open returns a reader for the asciicast contents of the recording. Encrypted recordings require the key.
+func Open(recording *Recording, key []byte) (io.ReadCloser, error) {
+	file, err := os.Open(recording.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !recording.Encrypted {
+		return file, nil
+	}
+
+	if key == nil {
+		file.Close()
+		return nil, errors.New("the recording is encrypted, but no recording key is stored in the vault")
+	}
+	reader, err := newChunkReader(file, key)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+func parseFileName(name string) (Recording, bool) {
+	recording := Recording{Name: name, Path: filepath.Join(Dir(), name)}
+
+	base := name
+	switch {
+	case strings.HasSuffix(name, encryptedExtension):
+		recording.Encrypted = true
+		base = strings.TrimSuffix(name, encryptedExtension)
+	case strings.HasSuffix(name, extension):
+		base = strings.TrimSuffix(name, extension)
+	default:
+		return recording, false
+	}
+
+	parts := strings.SplitN(base, "_", 2)
+	if len(parts) != 2 {
+		return recording, false
+	}
+	t, err := time.ParseInLocation(timeLayout, parts[0], time.Local)
+	if err != nil {
+		return recording, false
+	}
+	recording.Time = t
+	recording.Tag = parts[1]
+	return recording, true
+}
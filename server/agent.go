@@ -0,0 +1,208 @@
+package server
+
+import (
+	"fmt"
+	configuration "github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/crypto"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+var errReadOnlyAgent = errors.New("jim's agent is read-only, add keys to the vault instead")
+
+// vaultAgent serves the private keys of the decrypted vault via the ssh-agent protocol.
+// Clients can't add or remove keys, the agent only mirrors the vault.
+type vaultAgent struct {
+	mu      sync.Mutex
+	keyring agent.ExtendedAgent
+	// confirm holds the marshalled public keys, which require a confirmation before each use
+	confirm map[string]bool
+}
+
+// agentKey is a private key to be served by the agent
+type agentKey struct {
+	comment    string
+	privateKey []byte
+	confirm    bool
+}
+
+func newVaultAgent() *vaultAgent {
+	return &vaultAgent{
+		keyring: agent.NewKeyring().(agent.ExtendedAgent),
+		confirm: make(map[string]bool),
+	}
+}
+
+// load replaces the served keys
+func (a *vaultAgent) load(keys []agentKey) {
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	confirm := make(map[string]bool)
+	for _, key := range keys {
+		rawKey, err := ssh.ParseRawPrivateKey(key.privateKey)
+		if err != nil {
+			log.Printf("Agent skips the invalid key %s: %s", key.comment, err)
+			continue
+		}
+		signer, err := ssh.NewSignerFromKey(rawKey)
+		if err != nil {
+			log.Printf("Agent skips the invalid key %s: %s", key.comment, err)
+			continue
+		}
+
+		publicKey := string(signer.PublicKey().Marshal())
+		if _, exists := confirm[publicKey]; exists {
+			// the same key may be used by multiple entries, the stricter constraint wins
+			confirm[publicKey] = confirm[publicKey] || key.confirm
+			continue
+		}
+
+		err = keyring.Add(agent.AddedKey{PrivateKey: rawKey, Comment: key.comment, ConfirmBeforeUse: key.confirm})
+		if err != nil {
+			log.Printf("Agent failed to add the key %s: %s", key.comment, err)
+			continue
+		}
+		confirm[publicKey] = key.confirm
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keyring = keyring
+	a.confirm = confirm
+	log.Printf("Agent serves %d keys", len(confirm))
+}
+
+// clear removes all keys, this happens whenever the vault locks
+func (a *vaultAgent) clear() {
+	a.load(nil)
+}
+
+func (a *vaultAgent) current() (agent.ExtendedAgent, map[string]bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.keyring, a.confirm
+}
+
+func (a *vaultAgent) List() ([]*agent.Key, error) {
+	keyring, _ := a.current()
+	return keyring.List()
+}
+
+func (a *vaultAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+func (a *vaultAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	keyring, confirm := a.current()
+	if confirm[string(key.Marshal())] {
+		if err := confirmKeyUse(keyring, key); err != nil {
+			log.Printf("Agent refused to sign: %s", err)
+			return nil, err
+		}
+	}
+	return keyring.SignWithFlags(key, data, flags)
+}
+
+func (a *vaultAgent) Signers() ([]ssh.Signer, error) {
+	keyring, _ := a.current()
+	return keyring.Signers()
+}
+
+func (a *vaultAgent) Lock(passphrase []byte) error {
+	keyring, _ := a.current()
+	return keyring.Lock(passphrase)
+}
+
+func (a *vaultAgent) Unlock(passphrase []byte) error {
+	keyring, _ := a.current()
+	return keyring.Unlock(passphrase)
+}
+
+func (a *vaultAgent) Add(key agent.AddedKey) error {
+	return errReadOnlyAgent
+}
+
+func (a *vaultAgent) Remove(key ssh.PublicKey) error {
+	return errReadOnlyAgent
+}
+
+func (a *vaultAgent) RemoveAll() error {
+	return errReadOnlyAgent
+}
+
+func (a *vaultAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
+
+// confirmKeyUse asks the user via the askpass program, whether the key may be used.
+// Like OpenSSH's ssh-agent, it honors the SSH_ASKPASS environment variable.
+func confirmKeyUse(keyring agent.Agent, key ssh.PublicKey) error {
+	comment := ""
+	if keys, err := keyring.List(); err == nil {
+		for _, k := range keys {
+			if string(k.Marshal()) == string(key.Marshal()) {
+				comment = k.Comment
+			}
+		}
+	}
+
+	askpass := os.Getenv("SSH_ASKPASS")
+	if askpass == "" {
+		askpass = "ssh-askpass"
+	}
+	if _, err := exec.LookPath(askpass); err != nil {
+		return errors.Errorf("key %s requires confirmation, but no askpass program is available", comment)
+	}
+
+	prompt := fmt.Sprintf("Allow use of key %s?\nKey fingerprint %s.", comment, ssh.FingerprintSHA256(key))
+	cmd := exec.Command(askpass, prompt)
+	cmd.Env = append(os.Environ(), "SSH_ASKPASS_PROMPT=confirm")
+	if err := cmd.Run(); err != nil {
+		return errors.Errorf("use of key %s was not confirmed", comment)
+	}
+	return nil
+}
+
+// ServeAgent serves the vault's private keys via the ssh-agent protocol on the listener.
+// Blocks until the listener is closed.
+func (j JimServiceImpl) ServeAgent(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := agent.ServeAgent(j.agent, conn); err != nil && err != io.EOF {
+				log.Printf("Agent connection failed: %s", err)
+			}
+		}()
+	}
+}
+
+// collectAgentKeys returns the named keys and all inline keys of the entries
+func collectAgentKeys(jimConfig *configuration.JimConfig, config *Config) []agentKey {
+	var keys []agentKey
+	for _, key := range jimConfig.Keys {
+		privateKey, err := crypto.DecryptPrivateKey([]byte(key.PrivateKey), []byte(key.Passphrase))
+		if err != nil {
+			log.Printf("Agent skips the key %s: %s", key.Name, err)
+			continue
+		}
+		keys = append(keys, agentKey{comment: key.Name, privateKey: privateKey, confirm: key.Confirm})
+	}
+
+	for _, el := range *config {
+		if len(el.Server.Credentials.PrivateKey) != 0 {
+			keys = append(keys, agentKey{comment: el.Tag, privateKey: el.Server.Credentials.PrivateKey})
+		}
+	}
+	return keys
+}
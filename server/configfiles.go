@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	configuration "github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/crypto"
+	pb "github.com/CryoCodec/jim/internal/proto"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// configFile is one of the loaded config files
+type configFile struct {
+	path                  string
+	encryptedFileContents []byte
+	// vault holds the data key while decrypted, so modifications can be written back to the config file
+	vault *crypto.Vault
+	// format is the format of the decrypted config file, modifications are written back in the same format
+	format configuration.Format
+	// clearText is the decrypted config file, modifications are patched into it
+	clearText []byte
+	// jimConfig is the decrypted config file as it was parsed, nil while the file is encrypted
+	jimConfig *configuration.JimConfig
+}
+
+func (j JimServiceImpl) ListConflicts(ctx context.Context, request *pb.ListConflictsRequest) (*pb.ListConflictsReply, error) {
+	defer timeTrack(time.Now(), "ListConflicts")
+
+	state := j.readState()
+	if !state.isDecrypted {
+		return &pb.ListConflictsReply{ResponseType: pb.ResponseType_FAILURE, Reason: "wrong state, requires decryption"}, nil
+	}
+
+	var conflicts []*pb.TagConflict
+	for _, c := range state.conflicts {
+		conflict := &pb.TagConflict{Tag: c.Tag}
+		for _, i := range c.Configs {
+			conflict.Sources = append(conflict.Sources, state.files[i].path)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.ListConflictsReply{ResponseType: pb.ResponseType_SUCCESS, Conflicts: conflicts}, nil
+}
+
+// ReloadRekeyedFile reads the config file at the requested path again, after its password or key slots changed.
+// A decrypted file is decrypted with the data key it holds already, or with the new password, if the file
+// got a new data key. So the daemon stays unlocked and keeps the changed slots on writing modifications.
+func (j JimServiceImpl) ReloadRekeyedFile(ctx context.Context, request *pb.ReloadRekeyedFileRequest) (*pb.ReloadRekeyedFileReply, error) {
+	defer timeTrack(time.Now(), "ReloadRekeyedFile")
+
+	// modifications must not be written with the old password meanwhile
+	j.persistLock.Lock()
+	defer j.persistLock.Unlock()
+
+	state := j.readState()
+	configFiles := append([]configFile(nil), state.files...)
+	var f *configFile
+	for i := range configFiles {
+		if filepath.Clean(configFiles[i].path) == filepath.Clean(request.Path) {
+			f = &configFiles[i]
+		}
+	}
+	if f == nil {
+		return reloadRekeyedFileReplyFail(fmt.Sprintf("The config file %s is not loaded", request.Path)), nil
+	}
+
+	encoded, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return reloadRekeyedFileReplyFail(fmt.Sprintf("Could not read file at %s, reason: %s", f.path, err.Error())), nil
+	}
+	f.encryptedFileContents = encoded
+
+	// a file, which is still encrypted, is decrypted with the new password on unlock
+	if f.jimConfig != nil {
+		cipherText, err := b64.StdEncoding.DecodeString(string(encoded))
+		if err != nil {
+			return reloadRekeyedFileReplyFail(fmt.Sprintf("Corrupt configuration file %s, failed at base64 decode. Reason: %s", f.path, err.Error())), nil
+		}
+		if _, _, err := crypto.ParseHeader(cipherText); err != nil {
+			return reloadRekeyedFileReplyFail(fmt.Sprintf("Corrupt configuration file %s. Reason: %s", f.path, err.Error())), nil
+		}
+		clearText, err := f.vault.Reload(cipherText)
+		if err != nil {
+			// files of older versions got a new data key, when they were written
+			var vault *crypto.Vault
+			if vault, clearText, err = crypto.Open(request.Password, cipherText); err != nil {
+				return reloadRekeyedFileReplyFail(fmt.Sprintf("Failed to decrypt the configuration file %s. Reason: %s", f.path, err.Error())), nil
+			}
+			f.vault = vault
+		}
+		format := configuration.DetectFormat(clearText)
+		parsed, err := configuration.UnmarshalJimConfigFormat(clearText, format)
+		if err != nil {
+			return reloadRekeyedFileReplyFail(fmt.Sprintf("Failed to parse the config file %s. Reason: %s", f.path, err.Error())), nil
+		}
+		f.format = format
+		f.clearText = clearText
+		f.jimConfig = &parsed
+	}
+
+	if state.isDecrypted {
+		if err := j.applyConfigFiles(state, configFiles); err != nil {
+			return reloadRekeyedFileReplyFail(err.Error()), nil
+		}
+	} else {
+		newState := state
+		newState.files = configFiles
+		j.writeChannel <- writeOp{newState: &newState, opType: WriteState}
+	}
+	log.Printf("Reloaded %s, whose key slots changed", f.path)
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.ReloadRekeyedFileReply{ResponseType: pb.ResponseType_SUCCESS}, nil
+}
+
+func reloadRekeyedFileReplyFail(reason string) *pb.ReloadRekeyedFileReply {
+	return &pb.ReloadRekeyedFileReply{ResponseType: pb.ResponseType_FAILURE, Reason: reason}
+}
+
+// mergeConfigFiles merges the decrypted config files, the first file takes precedence
+func mergeConfigFiles(configFiles []configFile) (configuration.JimConfig, configuration.Origins, []configuration.Conflict) {
+	configs := make([]configuration.JimConfig, len(configFiles))
+	for i, f := range configFiles {
+		configs[i] = *f.jimConfig
+	}
+	return configuration.Merge(configs)
+}
+
+// setSources sets the path of the declaring config file for all elements of the merged config.
+// Elements without origin were added to the first config file.
+func setSources(config *Config, origins configuration.Origins, configFiles []configFile) {
+	for i := range *config {
+		source := 0
+		if i < len(origins.Entries) {
+			source = origins.Entries[i].Config
+		}
+		(*config)[i].Source = configFiles[source].path
+	}
+}
+
+// lockedPaths returns the paths of the config files, which are still encrypted
+func lockedPaths(configFiles []configFile) []string {
+	var paths []string
+	for _, f := range configFiles {
+		if f.jimConfig == nil {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths
+}
+
+// lockFiles returns copies of the config files with their decrypted contents and data keys removed
+func lockFiles(configFiles []configFile) []configFile {
+	var locked []configFile
+	for _, f := range configFiles {
+		locked = append(locked, configFile{path: f.path, encryptedFileContents: f.encryptedFileContents})
+	}
+	return locked
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	configuration "github.com/CryoCodec/jim/config"
+	pb "github.com/CryoCodec/jim/internal/proto"
+	"github.com/CryoCodec/jim/sshclient"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+func (j JimServiceImpl) ListHostKeys(ctx context.Context, request *pb.ListHostKeysRequest) (*pb.ListHostKeysReply, error) {
+	defer timeTrack(time.Now(), "ListHostKeys")
+
+	state := j.readState()
+	if !state.isDecrypted {
+		return nil, errors.New("wrong state, requires decryption")
+	}
+
+	var result []*pb.HostKeys
+	for _, el := range *state.config {
+		if request.Tag != "" && request.Tag != el.Tag {
+			continue
+		}
+		if len(el.Server.HostKeys) == 0 {
+			continue
+		}
+		result = append(result, &pb.HostKeys{Tag: el.Tag, Keys: el.Server.HostKeys})
+	}
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.ListHostKeysReply{HostKeys: result}, nil
+}
+
+func (j JimServiceImpl) AddHostKey(ctx context.Context, request *pb.AddHostKeyRequest) (*pb.HostKeyReply, error) {
+	defer timeTrack(time.Now(), "AddHostKey")
+
+	keys, err := sshclient.ParseHostKeys([]string{request.Key})
+	if err != nil {
+		return hostKeyReplyFail(fmt.Sprintf("Invalid host key: %s", err)), nil
+	}
+	key := keys[0]
+
+	err = j.updateConfig(func(jimConfig *configuration.JimConfig) error {
+		entry, err := findEntry(jimConfig, request.Tag)
+		if err != nil {
+			return err
+		}
+
+		// a server presents one key per algorithm, so a new key replaces the old one of the same type
+		pinned, err := sshclient.ParseHostKeys(entry.HostKeys)
+		if err != nil {
+			return err
+		}
+		var hostKeys []string
+		for i, k := range pinned {
+			if k.Type() != key.Type() {
+				hostKeys = append(hostKeys, entry.HostKeys[i])
+			}
+		}
+		entry.HostKeys = append(hostKeys, sshclient.MarshalHostKey(key))
+		return nil
+	})
+	if err != nil {
+		return hostKeyReplyFail(err.Error()), nil
+	}
+
+	log.Printf("Pinned host key for '%s'", request.Tag)
+	j.timerResetChannel <- true // resets the timer
+	return &pb.HostKeyReply{ResponseType: pb.ResponseType_SUCCESS}, nil
+}
+
+func (j JimServiceImpl) RevokeHostKey(ctx context.Context, request *pb.RevokeHostKeyRequest) (*pb.HostKeyReply, error) {
+	defer timeTrack(time.Now(), "RevokeHostKey")
+
+	err := j.updateConfig(func(jimConfig *configuration.JimConfig) error {
+		entry, err := findEntry(jimConfig, request.Tag)
+		if err != nil {
+			return err
+		}
+
+		if request.Fingerprint == "" {
+			entry.HostKeys = nil
+			return nil
+		}
+
+		var hostKeys []string
+		for _, k := range entry.HostKeys {
+			fingerprint, err := sshclient.FingerprintOf(k)
+			if err != nil {
+				return err
+			}
+			if fingerprint != request.Fingerprint {
+				hostKeys = append(hostKeys, k)
+			}
+		}
+		if len(hostKeys) == len(entry.HostKeys) {
+			return errors.Errorf("No host key with fingerprint %s is pinned for '%s'", request.Fingerprint, request.Tag)
+		}
+		entry.HostKeys = hostKeys
+		return nil
+	})
+	if err != nil {
+		return hostKeyReplyFail(err.Error()), nil
+	}
+
+	log.Printf("Revoked host keys for '%s'", request.Tag)
+	j.timerResetChannel <- true // resets the timer
+	return &pb.HostKeyReply{ResponseType: pb.ResponseType_SUCCESS}, nil
+}
+
+func (j JimServiceImpl) ImportHostKeys(ctx context.Context, request *pb.ImportHostKeysRequest) (*pb.ImportHostKeysReply, error) {
+	defer timeTrack(time.Now(), "ImportHostKeys")
+
+	lookup, err := sshclient.NewKnownHostsLookup(request.Destination)
+	if err != nil {
+		return &pb.ImportHostKeysReply{
+			ResponseType: pb.ResponseType_FAILURE,
+			Reason:       fmt.Sprintf("Could not read known_hosts file at %s, reason: %s", request.Destination, err),
+		}, nil
+	}
+
+	var imported []*pb.HostKeys
+	err = j.updateConfig(func(jimConfig *configuration.JimConfig) error {
+		imported = nil
+		for i := range jimConfig.Entries {
+			el := &jimConfig.Entries[i]
+			resolved, _ := jimConfig.Resolve(el)
+			port := resolved.Port
+
+			pinned, err := sshclient.ParseHostKeys(el.Server.HostKeys)
+			if err != nil {
+				return err
+			}
+			pinnedTypes := make(map[string]bool)
+			for _, k := range pinned {
+				pinnedTypes[k.Type()] = true
+			}
+
+			// already pinned keys take precedence over the known_hosts file
+			var newKeys []string
+			for _, key := range lookup.Lookup(el.Server.Host, port) {
+				if !pinnedTypes[key.Type()] {
+					newKeys = append(newKeys, sshclient.MarshalHostKey(key))
+				}
+			}
+			if len(newKeys) != 0 {
+				el.Server.HostKeys = append(el.Server.HostKeys, newKeys...)
+				imported = append(imported, &pb.HostKeys{Tag: el.Tag, Keys: newKeys})
+			}
+		}
+
+		if len(imported) == 0 {
+			return errNothingToImport
+		}
+		return nil
+	})
+	if err != nil && err != errNothingToImport {
+		return &pb.ImportHostKeysReply{ResponseType: pb.ResponseType_FAILURE, Reason: err.Error()}, nil
+	}
+
+	log.Printf("Imported host keys for %d entries", len(imported))
+	j.timerResetChannel <- true // resets the timer
+	return &pb.ImportHostKeysReply{ResponseType: pb.ResponseType_SUCCESS, Imported: imported}, nil
+}
+
+// errNothingToImport aborts the update of the config file, if there were no changes
+var errNothingToImport = errors.New("nothing to import")
+
+// findEntry returns the config entry with given tag
+func findEntry(jimConfig *configuration.JimConfig, tag string) (*configuration.JimConfigEntry, error) {
+	el, err := findElement(jimConfig, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &el.Server, nil
+}
+
+// findElement returns the config element with given tag
+func findElement(jimConfig *configuration.JimConfig, tag string) (*configuration.JimConfigElement, error) {
+	for i := range jimConfig.Entries {
+		if jimConfig.Entries[i].Tag == tag {
+			return &jimConfig.Entries[i], nil
+		}
+	}
+	return nil, errors.Errorf("No entry with tag '%s' exists", tag)
+}
+
+func hostKeyReplyFail(reason string) *pb.HostKeyReply {
+	return &pb.HostKeyReply{
+		ResponseType: pb.ResponseType_FAILURE,
+		Reason:       reason,
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	configuration "github.com/CryoCodec/jim/config"
+	pb "github.com/CryoCodec/jim/internal/proto"
+	"github.com/pkg/errors"
+)
+
+// errDryRun aborts the update of the config file, after the imported entries were validated
+var errDryRun = errors.New("dry run")
+
+func (j JimServiceImpl) ImportEntries(ctx context.Context, request *pb.ImportEntriesRequest) (*pb.ImportEntriesReply, error) {
+	defer timeTrack(time.Now(), "ImportEntries")
+
+	imported, err := configuration.UnmarshalJimConfigFormat(request.Config, configuration.JSON)
+	if err != nil {
+		return importEntriesReplyFail(errors.Wrap(err, "Failed to parse the imported entries").Error()), nil
+	}
+
+	var results []*pb.ImportedEntry
+	err = j.updateConfig(func(jimConfig *configuration.JimConfig) error {
+		results = importEntries(jimConfig, &imported, request.Update)
+		if request.DryRun {
+			if _, err := toServerConfig(jimConfig); err != nil {
+				return err
+			}
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return importEntriesReplyFail(err.Error()), nil
+	}
+
+	if !request.DryRun {
+		log.Printf("Imported %d entries", len(results))
+	}
+	j.timerResetChannel <- true // resets the timer
+	return &pb.ImportEntriesReply{ResponseType: pb.ResponseType_SUCCESS, Entries: results}, nil
+}
+
+// importEntries merges the entries and keys of imported into jimConfig. New entries are appended, existing entries
+// are skipped or, if update is set, take over host, port, username, key, jump hosts and aliases of the imported entry.
+// Keys are merged by name and contents, an imported key, whose name is taken by a different key, is renamed.
+// An existing key is only reused, if the config files of all entries referencing the imported key declare it.
+func importEntries(jimConfig *configuration.JimConfig, imported *configuration.JimConfig, update bool) []*pb.ImportedEntry {
+	renamed := make(map[string]string)
+	for _, key := range imported.Keys {
+		name := key.Name
+		for i := 2; ; i++ {
+			existing := jimConfig.FindKey(key.Name)
+			if existing == nil {
+				jimConfig.Keys = append(jimConfig.Keys, key)
+				break
+			}
+			if existing.PrivateKey == key.PrivateKey && keyVisible(jimConfig, imported, name, &key, update) {
+				break
+			}
+			key.Name = fmt.Sprintf("%s-%d", name, i)
+		}
+		renamed[name] = key.Name
+	}
+
+	var results []*pb.ImportedEntry
+	for _, el := range imported.Entries {
+		if name, ok := renamed[el.Server.KeyRef]; ok {
+			el.Server.KeyRef = name
+		}
+		existing, err := findElement(jimConfig, el.Tag)
+		switch {
+		case err != nil:
+			jimConfig.Entries = append(jimConfig.Entries, el)
+			results = append(results, &pb.ImportedEntry{Tag: el.Tag, Action: pb.ImportedEntry_ADDED})
+		case update:
+			if len(el.Aliases) != 0 {
+				existing.Aliases = el.Aliases
+			}
+			existing.Server.Host = el.Server.Host
+			existing.Server.Port = el.Server.Port
+			existing.Server.Username = el.Server.Username
+			existing.Server.Jump = el.Server.Jump
+			if el.Server.KeyRef != "" {
+				existing.Server.KeyRef = el.Server.KeyRef
+				existing.Server.PrivateKey = ""
+			}
+			results = append(results, &pb.ImportedEntry{Tag: el.Tag, Action: pb.ImportedEntry_UPDATED})
+		default:
+			results = append(results, &pb.ImportedEntry{Tag: el.Tag, Action: pb.ImportedEntry_SKIPPED})
+		}
+	}
+	return results
+}
+
+// keyVisible reports whether all imported entries referencing the key by name, which are added or updated,
+// may reference the existing key with the name and contents of key. New entries are added to the first config file.
+func keyVisible(jimConfig *configuration.JimConfig, imported *configuration.JimConfig, name string, key *configuration.JimKey, update bool) bool {
+	for i := range imported.Entries {
+		el := &imported.Entries[i]
+		if el.Server.KeyRef != name {
+			continue
+		}
+		target := el
+		if existing, err := findElement(jimConfig, el.Tag); err == nil {
+			if !update {
+				continue
+			}
+			target = existing
+		}
+		if visible := jimConfig.FindKeyOf(target, key.Name); visible == nil || visible.PrivateKey != key.PrivateKey {
+			return false
+		}
+	}
+	return true
+}
+
+func importEntriesReplyFail(reason string) *pb.ImportEntriesReply {
+	return &pb.ImportEntriesReply{
+		ResponseType: pb.ResponseType_FAILURE,
+		Reason:       reason,
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	configuration "github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/files"
+	"github.com/pkg/errors"
+	"log"
+)
+
+// updateConfig applies the modification to a copy of the merged config, writes the changes back to the
+// config files declaring the modified parts, encrypts them with their data key and replaces the files.
+// The changes are patched into the decrypted files, so comments and layout are kept, see configuration.Patch.
+// Afterwards the server state reflects the modified config.
+func (j JimServiceImpl) updateConfig(modify func(jimConfig *configuration.JimConfig) error) error {
+	j.persistLock.Lock()
+	defer j.persistLock.Unlock()
+
+	state := j.readState()
+	if !state.isDecrypted {
+		return errors.New("wrong state, requires decryption")
+	}
+
+	// work on copies, so the current state stays untouched if anything fails
+	configs := make([]configuration.JimConfig, len(state.files))
+	for i, f := range state.files {
+		var err error
+		if configs[i], err = configuration.UnmarshalJimConfigFormat(f.clearText, f.format); err != nil {
+			return err
+		}
+	}
+	merged, origins, _ := configuration.Merge(configs)
+
+	if err := modify(&merged); err != nil {
+		return err
+	}
+
+	// validate before anything is written
+	if _, err := toServerConfig(&merged); err != nil {
+		return err
+	}
+
+	// patch all files first, so none is written, if one of them can't be patched
+	configFiles := append([]configFile(nil), state.files...)
+	splitConfigs := configuration.Split(&merged, configs, origins)
+	clearTexts := make([][]byte, len(splitConfigs))
+	for i := range splitConfigs {
+		f := &configFiles[i]
+		clearText, err := configuration.Patch(f.clearText, f.format, &configs[i], &splitConfigs[i])
+		if err != nil {
+			return errors.Wrapf(err, "failed to modify the config file %s", f.path)
+		}
+		clearTexts[i] = clearText
+	}
+
+	for i, clearText := range clearTexts {
+		f := &configFiles[i]
+		if bytes.Equal(clearText, f.clearText) {
+			continue
+		}
+
+		cipherText, err := f.vault.Seal(clearText)
+		if err != nil {
+			return errors.Wrap(err, "failed to encrypt the config")
+		}
+		encoded := []byte(b64.StdEncoding.EncodeToString(cipherText))
+
+		if err := files.WriteFileAtomic(f.path, encoded, 0600); err != nil {
+			return errors.Wrapf(err, "failed to write the config file %s", f.path)
+		}
+		log.Printf("Wrote modified config to %s", f.path)
+
+		f.encryptedFileContents = encoded
+		f.clearText = clearText
+		f.jimConfig = &splitConfigs[i]
+	}
+
+	// merge again, so added entries show up at the position of the config file they were written to
+	return j.applyConfigFiles(state, configFiles)
+}
+
+// applyConfigFiles merges the decrypted config files and makes them the server state, replacing state.
+// The agent is loaded with the keys of the merged config.
+// The config files are written already, so the old index is kept, if the new one can't be built.
+func (j JimServiceImpl) applyConfigFiles(state serverState, configFiles []configFile) error {
+	merged, origins, conflicts := mergeConfigFiles(configFiles)
+	resultConfig, err := toServerConfig(&merged)
+	if err != nil {
+		return err
+	}
+	setSources(resultConfig, origins, configFiles)
+
+	// added or modified entries have to be found by the search
+	index := state.index
+	if needsNewIndex(state.config, resultConfig) {
+		if newIndex, err := buildIndex(resultConfig); err != nil {
+			log.Printf("Failed to update the search index: %s", err)
+		} else {
+			index = newIndex
+		}
+	}
+
+	newState := state
+	newState.files = configFiles
+	newState.jimConfig = &merged
+	newState.origins = origins
+	newState.conflicts = conflicts
+	newState.config = resultConfig
+	newState.grouping = buildGroupTable(resultConfig)
+	newState.index = index
+	j.writeChannel <- writeOp{newState: &newState, opType: WriteState}
+	// the agent serves the keys of the modified config, removed keys are gone at once
+	j.agent.load(collectAgentKeys(&merged, resultConfig))
+	if index != state.index {
+		if err := state.index.Close(); err != nil {
+			log.Printf("Error when closing the index: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	configuration "github.com/CryoCodec/jim/config"
+	"github.com/CryoCodec/jim/crypto"
+	pb "github.com/CryoCodec/jim/internal/proto"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+func (j JimServiceImpl) GetRecordingKey(ctx context.Context, request *pb.RecordingKeyRequest) (*pb.RecordingKeyReply, error) {
+	defer timeTrack(time.Now(), "GetRecordingKey")
+
+	state := j.readState()
+	if !state.isDecrypted {
+		return nil, errors.New("wrong state, requires decryption")
+	}
+
+	recording := state.jimConfig.Recording
+	if recording == nil || (recording.Key == "" && (!request.Create || !recording.Encrypt)) {
+		return &pb.RecordingKeyReply{ResponseType: pb.ResponseType_SUCCESS}, nil
+	}
+
+	if recording.Key == "" {
+		err := j.updateConfig(func(jimConfig *configuration.JimConfig) error {
+			// another request may have created the key in the meantime
+			if jimConfig.Recording.Key != "" {
+				return nil
+			}
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				return err
+			}
+			jimConfig.Recording.Key = b64.StdEncoding.EncodeToString(key)
+			return nil
+		})
+		if err != nil {
+			return recordingKeyReplyFail(fmt.Sprintf("Failed to create the recording key: %s", err)), nil
+		}
+		log.Println("Created the recording key")
+		recording = j.readState().jimConfig.Recording
+	}
+
+	key, err := b64.StdEncoding.DecodeString(recording.Key)
+	if err != nil || len(key) != crypto.KeySize {
+		return recordingKeyReplyFail("The recording key stored in the config file is invalid"), nil
+	}
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.RecordingKeyReply{ResponseType: pb.ResponseType_SUCCESS, Key: key}, nil
+}
+
+func recordingKeyReplyFail(reason string) *pb.RecordingKeyReply {
+	return &pb.RecordingKeyReply{ResponseType: pb.ResponseType_FAILURE, Reason: reason}
+}
@@ -7,6 +7,7 @@ import (
 	configuration "github.com/CryoCodec/jim/config"
 	"github.com/CryoCodec/jim/core/domain"
 	"github.com/CryoCodec/jim/crypto"
+	"github.com/CryoCodec/jim/sshclient"
 	"github.com/blevesearch/bleve/v2/analysis/lang/en"
 	"github.com/blevesearch/bleve/v2/mapping"
 	"github.com/blevesearch/bleve/v2/search/query"
@@ -17,7 +18,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/CryoCodec/jim/files"
@@ -29,18 +34,32 @@ type JimServiceImpl struct {
 	readChannel       chan readOp
 	writeChannel      chan writeOp
 	timerResetChannel chan interface{}
+	// agent serves the vault's keys via the ssh-agent protocol
+	agent *vaultAgent
+	// tunnels keeps the port forwards open, until they are stopped or the vault is locked
+	tunnels *tunnelManager
+	// persistLock serializes modifications of the encrypted config file
+	persistLock *sync.Mutex
 }
 
 // CreateJimService creates a new grpc server instance
-func CreateJimService() pb.JimServer {
+func CreateJimService() JimServiceImpl {
 	defer timeTrack(time.Now(), "setup")
 	setupLogging()
-	readChannel, writeChannel := initializeStateManager()
+	vaultAgent := newVaultAgent()
+	tunnels := newTunnelManager()
+	readChannel, writeChannel := initializeStateManager(func() {
+		vaultAgent.clear()
+		tunnels.stopAll()
+	})
 	timerResetChannel := startTimer(writeChannel)
 	return JimServiceImpl{
 		readChannel:       readChannel,
 		writeChannel:      writeChannel,
-		timerResetChannel: timerResetChannel}
+		timerResetChannel: timerResetChannel,
+		agent:             vaultAgent,
+		tunnels:           tunnels,
+		persistLock:       &sync.Mutex{}}
 }
 
 func setupLogging() {
@@ -79,13 +98,14 @@ type writeOp struct {
 }
 
 // initializeStateManager initializes the state governing coroutine.
+// onClose is called whenever the decrypted state is closed.
 // Returns two channels to submit read and write Ops.
-func initializeStateManager() (chan readOp, chan writeOp) {
+func initializeStateManager(onClose func()) (chan readOp, chan writeOp) {
 	reads := make(chan readOp, 3)
 	writes := make(chan writeOp, 3)
 
 	go func() {
-		state := serverState{isDecrypted: false, encryptedFileContents: nil}
+		state := serverState{isDecrypted: false, files: nil}
 		for {
 			select {
 			case read := <-reads:
@@ -97,6 +117,10 @@ func initializeStateManager() (chan readOp, chan writeOp) {
 				switch write.opType {
 				case WriteCloseState:
 					state.isDecrypted = false
+					state.files = lockFiles(state.files)
+					state.jimConfig = nil
+					state.origins = configuration.Origins{}
+					state.conflicts = nil
 					state.config = nil
 					state.grouping = nil
 					if state.index != nil {
@@ -106,6 +130,7 @@ func initializeStateManager() (chan readOp, chan writeOp) {
 						}
 					}
 					state.index = nil
+					onClose()
 				case WriteState:
 					state = *write.newState
 				}
@@ -122,7 +147,7 @@ func (j JimServiceImpl) GetState(ctx context.Context, request *pb.StateRequest)
 
 	state := j.readState()
 
-	if state.encryptedFileContents == nil {
+	if len(state.files) == 0 {
 		return &pb.StateReply{State: pb.StateReply_CONFIG_FILE_REQUIRED}, nil
 	}
 
@@ -136,27 +161,35 @@ func (j JimServiceImpl) GetState(ctx context.Context, request *pb.StateRequest)
 func (j JimServiceImpl) LoadConfigFile(ctx context.Context, request *pb.LoadRequest) (*pb.LoadReply, error) {
 	defer timeTrack(time.Now(), "LoadConfigFile")
 
-	p := request.Destination
-	if !files.Exists(p) {
-		return &pb.LoadReply{
-			ResponseType: pb.ResponseType_FAILURE,
-			Reason:       fmt.Sprintf("Failed to load config file from %s", p),
-		}, nil
+	paths := request.Destinations
+	if len(paths) == 0 {
+		paths = []string{request.Destination}
 	}
 
-	fileContents, err := ioutil.ReadFile(p)
-	if err != nil {
-		return &pb.LoadReply{
-			ResponseType: pb.ResponseType_FAILURE,
-			Reason:       fmt.Sprintf("Could not read file at %s, reason: %s", p, err.Error()),
-		}, nil
+	var configFiles []configFile
+	for _, p := range paths {
+		if !files.Exists(p) {
+			return &pb.LoadReply{
+				ResponseType: pb.ResponseType_FAILURE,
+				Reason:       fmt.Sprintf("Failed to load config file from %s", p),
+			}, nil
+		}
+
+		fileContents, err := ioutil.ReadFile(p)
+		if err != nil {
+			return &pb.LoadReply{
+				ResponseType: pb.ResponseType_FAILURE,
+				Reason:       fmt.Sprintf("Could not read file at %s, reason: %s", p, err.Error()),
+			}, nil
+		}
+		configFiles = append(configFiles, configFile{path: p, encryptedFileContents: fileContents})
 	}
 
 	newState := &serverState{
-		isDecrypted:           false,
-		encryptedFileContents: fileContents,
-		config:                nil,
-		index:                 nil,
+		isDecrypted: false,
+		files:       configFiles,
+		config:      nil,
+		index:       nil,
 	}
 
 	// close previously opened states. This may be required when this function is used with the 'reload' cmd
@@ -169,11 +202,14 @@ func (j JimServiceImpl) LoadConfigFile(ctx context.Context, request *pb.LoadRequ
 	}, nil
 }
 
+// Decrypt decrypts all loaded config files, which the password fits. If config files remain encrypted,
+// the state keeps the decrypted ones and the client is asked for another password.
+// Once all config files are decrypted, they are merged and the state becomes ready.
 func (j JimServiceImpl) Decrypt(req *pb.DecryptRequest, stream pb.Jim_DecryptServer) error {
 	defer timeTrack(time.Now(), "Decrypt")
 
 	state := j.readState()
-	if state.encryptedFileContents == nil {
+	if len(state.files) == 0 {
 		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_VALIDATE, "No configuration file was loaded."))
 	}
 
@@ -181,37 +217,78 @@ func (j JimServiceImpl) Decrypt(req *pb.DecryptRequest, stream pb.Jim_DecryptSer
 		return sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_DONE))
 	}
 
-	cipherText, err := b64.StdEncoding.DecodeString(string(state.encryptedFileContents))
-	if err != nil {
-		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_DECODE_BASE64, fmt.Sprintf("Corrupt configuration file, failed at base64 decode. Reason: %s", err.Error())))
-	} else {
-		err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_DECODE_BASE64))
+	// work on a copy, the state is shared with concurrent readers
+	configFiles := append([]configFile(nil), state.files...)
+	cipherTexts := make(map[int][]byte)
+	for i, f := range configFiles {
+		if f.jimConfig != nil {
+			continue
+		}
+		cipherText, err := b64.StdEncoding.DecodeString(string(f.encryptedFileContents))
 		if err != nil {
-			return err
+			return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_DECODE_BASE64, fmt.Sprintf("Corrupt configuration file %s, failed at base64 decode. Reason: %s", f.path, err.Error())))
 		}
+		if _, _, err := crypto.ParseHeader(cipherText); err != nil {
+			return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_DECODE_BASE64, fmt.Sprintf("Corrupt configuration file %s. Reason: %s", f.path, err.Error())))
+		}
+		cipherTexts[i] = cipherText
+	}
+	if err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_DECODE_BASE64)); err != nil {
+		return err
 	}
 
-	clearText, err := crypto.Decrypt(req.Password, cipherText)
-	if err != nil {
-		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_DECRYPT, fmt.Sprintf("Failed to decrypt the configuration file. Reason: %s", err.Error())))
-	} else {
-		err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_DECRYPT))
+	clearTexts := make(map[int][]byte)
+	vaults := make(map[int]*crypto.Vault)
+	var lastErr error
+	for i, cipherText := range cipherTexts {
+		vault, clearText, err := crypto.Open(req.Password, cipherText)
 		if err != nil {
-			return err
+			lastErr = err
+			continue
+		}
+		clearTexts[i] = clearText
+		vaults[i] = vault
+	}
+	if len(clearTexts) == 0 {
+		reason := fmt.Sprintf("Failed to decrypt the configuration file. Reason: %s", lastErr.Error())
+		if len(configFiles) > 1 {
+			reason = fmt.Sprintf("The password does not fit any of the remaining configuration files %s.", strings.Join(lockedPaths(configFiles), ", "))
 		}
+		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_DECRYPT, reason))
+	}
+	if err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_DECRYPT)); err != nil {
+		return err
 	}
 
-	parsed, err := configuration.UnmarshalJimConfig(clearText)
-	if err != nil {
-		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_UNMARSHAL, fmt.Sprintf("Failed to unmarshal json config. Reason: %s", err.Error())))
-	} else {
-		err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_UNMARSHAL))
+	for i, clearText := range clearTexts {
+		format := configuration.DetectFormat(clearText)
+		parsed, err := configuration.UnmarshalJimConfigFormat(clearText, format)
 		if err != nil {
-			return err
+			return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_UNMARSHAL, fmt.Sprintf("Failed to parse the config file %s. Reason: %s", configFiles[i].path, err.Error())))
 		}
+		configFiles[i].vault = vaults[i]
+		configFiles[i].format = format
+		configFiles[i].clearText = clearText
+		configFiles[i].jimConfig = &parsed
 	}
 
-	resultConfig, err := toServerConfig(&parsed)
+	if locked := lockedPaths(configFiles); len(locked) != 0 {
+		partialState := state
+		partialState.files = configFiles
+		j.writeChannel <- writeOp{newState: &partialState, opType: WriteState}
+		reason := fmt.Sprintf("Decrypted %d of %d configuration files, enter the password of %s", len(configFiles)-len(locked), len(configFiles), strings.Join(locked, ", "))
+		return sendDecryptUpdate(stream, &pb.DecryptReply{ResponseType: pb.ResponseType_SUCCESS, Step: pb.StepName_PASSWORD_REQUIRED, Reason: reason})
+	}
+	if err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_UNMARSHAL)); err != nil {
+		return err
+	}
+
+	merged, origins, conflicts := mergeConfigFiles(configFiles)
+	for _, conflict := range conflicts {
+		log.Printf("The tag '%s' is declared by multiple config files, using the entry of %s", conflict.Tag, configFiles[conflict.Configs[0]].path)
+	}
+
+	resultConfig, err := toServerConfig(&merged)
 	if err != nil {
 		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_VALIDATE, err.Error()))
 	} else {
@@ -220,6 +297,7 @@ func (j JimServiceImpl) Decrypt(req *pb.DecryptRequest, stream pb.Jim_DecryptSer
 			return err
 		}
 	}
+	setSources(resultConfig, origins, configFiles)
 
 	// create the bleve index
 	type pair struct {
@@ -229,37 +307,16 @@ func (j JimServiceImpl) Decrypt(req *pb.DecryptRequest, stream pb.Jim_DecryptSer
 
 	returnChan := make(chan pair)
 	go func() {
-		hash, err := hashstructure.Hash(resultConfig, hashstructure.FormatV2, nil)
-		if err != nil {
-			returnChan <- pair{
-				index: nil,
-				err:   errors.Errorf("Failed to hash the config: %d", hash),
-			}
-		}
-
-		index, err := createIndex(strconv.Itoa(int(hash)), resultConfig)
-		if err != nil {
-			returnChan <- pair{
-				index: nil,
-				err:   err,
-			}
-		}
-		returnChan <- pair{
-			index: index,
-			err:   nil,
-		}
+		index, err := buildIndex(resultConfig)
+		returnChan <- pair{index: index, err: err}
 	}()
 
 	// create grouping table for quickly accessing the matched tag
-	groupTable := make(map[string]*ConfigElement)
-	for _, entry := range *resultConfig {
-		copiedEntry := entry // this is required! otherwise & operator always points to the loop variable
-		groupTable[entry.Tag] = &copiedEntry
-	}
+	groupTable := buildGroupTable(resultConfig)
 
 	result := <-returnChan
 	if result.err != nil {
-		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_BUILD_INDEX, err.Error()))
+		return sendDecryptUpdate(stream, decryptReplyFail(pb.StepName_BUILD_INDEX, result.err.Error()))
 	} else {
 		err := sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_BUILD_INDEX))
 		if err != nil {
@@ -268,14 +325,18 @@ func (j JimServiceImpl) Decrypt(req *pb.DecryptRequest, stream pb.Jim_DecryptSer
 	}
 
 	newState := &serverState{
-		isDecrypted:           true,
-		encryptedFileContents: state.encryptedFileContents,
-		config:                resultConfig,
-		index:                 result.index,
-		grouping:              groupTable,
+		isDecrypted: true,
+		files:       configFiles,
+		jimConfig:   &merged,
+		origins:     origins,
+		conflicts:   conflicts,
+		config:      resultConfig,
+		index:       result.index,
+		grouping:    groupTable,
 	}
 
 	j.writeChannel <- writeOp{newState: newState, opType: WriteState}
+	j.agent.load(collectAgentKeys(&merged, resultConfig))
 
 	err = sendDecryptUpdate(stream, decryptReplySuccess(pb.StepName_DONE))
 	if err != nil {
@@ -285,6 +346,19 @@ func (j JimServiceImpl) Decrypt(req *pb.DecryptRequest, stream pb.Jim_DecryptSer
 	return nil
 }
 
+// buildGroupTable creates a lookup table from tag and aliases to config element
+func buildGroupTable(config *Config) map[string]*ConfigElement {
+	groupTable := make(map[string]*ConfigElement)
+	for _, entry := range *config {
+		copiedEntry := entry // this is required! otherwise & operator always points to the loop variable
+		groupTable[entry.Tag] = &copiedEntry
+		for _, alias := range entry.Aliases {
+			groupTable[alias] = &copiedEntry
+		}
+	}
+	return groupTable
+}
+
 func decryptReplyFail(name pb.StepName, reason string) *pb.DecryptReply {
 	return &pb.DecryptReply{
 		ResponseType: pb.ResponseType_FAILURE,
@@ -316,6 +390,13 @@ func (j JimServiceImpl) Match(ctx context.Context, request *pb.MatchRequest) (*p
 	}
 
 	log.Printf("User queried '%s'", request.Query)
+	// an exact tag or alias always wins over the fuzzy search
+	if configEl := exactMatch(request.Query, state.grouping); configEl != nil {
+		log.Printf("Query matched '%s' exactly", configEl.Tag)
+		j.timerResetChannel <- true // resets the timer
+		return toMatchReply(configEl, state.grouping)
+	}
+
 	// now we try to find the closest match
 	q := bleve.NewMatchQuery(fmt.Sprintf("tag:\"%s\"", request.Query))
 	search := bleve.NewSearchRequest(q)
@@ -332,10 +413,7 @@ func (j JimServiceImpl) Match(ctx context.Context, request *pb.MatchRequest) (*p
 		log.Printf("Query matched '%s'", tag)
 		configEl, ok := state.grouping[tag]
 		if ok {
-			return &pb.MatchReply{
-				Tag:    tag,
-				Server: toPbServer(configEl.Server),
-			}, nil
+			return toMatchReply(configEl, state.grouping)
 		}
 	}
 
@@ -343,15 +421,169 @@ func (j JimServiceImpl) Match(ctx context.Context, request *pb.MatchRequest) (*p
 	return nil, errors.New("nothing matched the query")
 }
 
-// todo remove, no longer required?
+// exactMatch returns the element, whose tag or alias equals the query. If no name equals the query,
+// a name differing only in case is used, as long as it's unique. Returns nil otherwise.
+func exactMatch(query string, grouping map[string]*ConfigElement) *ConfigElement {
+	if configEl, ok := grouping[query]; ok {
+		return configEl
+	}
+
+	var found *ConfigElement
+	for name, configEl := range grouping {
+		if strings.EqualFold(name, query) {
+			if found != nil && found.Tag != configEl.Tag {
+				return nil
+			}
+			found = configEl
+		}
+	}
+	return found
+}
+
+func (j JimServiceImpl) MatchAll(ctx context.Context, request *pb.ListRequest) (*pb.MatchAllReply, error) {
+	defer timeTrack(time.Now(), "MatchAll")
+
+	state := j.readState()
+	if !state.isDecrypted {
+		return nil, errors.New("wrong state, requires decryption")
+	}
+
+	configEntries, err := getEntriesWithFilterApplied(toDomainFilter(request.Filter), &state, int(request.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*pb.MatchReply
+	for i := range *configEntries {
+		match, err := toMatchReply(&(*configEntries)[i], state.grouping)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.MatchAllReply{Matches: matches}, nil
+}
+
+// toMatchReply creates the reply including all credentials of the element and its jump hosts
+func toMatchReply(configEl *ConfigElement, grouping map[string]*ConfigElement) (*pb.MatchReply, error) {
+	jumps, err := resolveJumps(configEl, grouping)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []*pb.Hop
+	for _, jump := range jumps {
+		hops = append(hops, &pb.Hop{Tag: jump.Tag, Server: toPbServer(jump.Server)})
+	}
+	return &pb.MatchReply{
+		Tag:     configEl.Tag,
+		Server:  toPbServer(configEl.Server),
+		Jumps:   hops,
+		Labels:  configEl.Labels,
+		Aliases: configEl.Aliases,
+	}, nil
+}
+
+// toDomainMatch creates a match including all credentials of the element and its jump hosts
+func toDomainMatch(configEl *ConfigElement, grouping map[string]*ConfigElement) (*domain.Match, error) {
+	jumps, err := resolveJumps(configEl, grouping)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []domain.Hop
+	for _, jump := range jumps {
+		hops = append(hops, domain.Hop{Tag: jump.Tag, Server: toDomainServer(jump.Server)})
+	}
+	return &domain.Match{
+		Tag:     configEl.Tag,
+		Server:  toDomainServer(configEl.Server),
+		Jumps:   hops,
+		Labels:  configEl.Labels,
+		Aliases: configEl.Aliases,
+	}, nil
+}
+
+func toDomainServer(server ServerEntry) domain.Server {
+	return domain.Server{
+		Host:           server.Host,
+		Dir:            server.Dir,
+		Port:           server.Port,
+		Username:       server.Credentials.Username,
+		Password:       server.Credentials.Password,
+		PrivateKey:     server.Credentials.PrivateKey,
+		HostKeys:       server.HostKeys,
+		Forwards:       server.Forwards,
+		Record:         server.Record,
+		Shell:          server.Shell,
+		StartupCommand: server.StartupCommand,
+		Env:            server.Env,
+	}
+}
+
+func toDomainFilter(filter *pb.Filter) *domain.Filter {
+	return &domain.Filter{
+		EnvFilter:    filter.Env,
+		GroupFilter:  filter.Group,
+		TagFilter:    filter.Tag,
+		HostFilter:   filter.Host,
+		FreeFilter:   filter.Free,
+		LabelFilters: filter.Labels,
+	}
+}
+
+// MatchN returns the tags and aliases starting with the query, e.g. for shell completion.
+// If there are less than the requested number, the closest tags of the fuzzy search are added.
 func (j JimServiceImpl) MatchN(ctx context.Context, request *pb.MatchNRequest) (*pb.MatchNReply, error) {
+	defer timeTrack(time.Now(), "MatchN")
 
 	state := j.readState()
 	if !state.isDecrypted {
 		return nil, errors.New("wrong state, requires decryption")
 	}
 
-	return &pb.MatchNReply{Tags: []string{}}, nil
+	limit := int(request.NumberOfResults)
+	var names []string
+	for name := range state.grouping {
+		if strings.HasPrefix(strings.ToLower(name), strings.ToLower(request.Query)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	if len(names) < limit && request.Query != "" {
+		q := bleve.NewMatchQuery(fmt.Sprintf("tag:\"%s\"", request.Query))
+		search := bleve.NewSearchRequest(q)
+		search.Size = limit - len(names)
+		search.Fields = []string{"tag"}
+		searchResults, err := state.index.Search(search)
+		if err != nil {
+			return nil, errors.Errorf("Encountered an unexpected error during search: %s", err)
+		}
+		for _, hit := range searchResults.Hits {
+			tag := hit.Fields["tag"].(string)
+			if !containsString(names, tag) {
+				names = append(names, tag)
+			}
+		}
+	}
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.MatchNReply{Tags: names}, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 func (j JimServiceImpl) List(ctx context.Context, request *pb.ListRequest) (*pb.ListReply, error) {
@@ -361,15 +593,7 @@ func (j JimServiceImpl) List(ctx context.Context, request *pb.ListRequest) (*pb.
 	if !state.isDecrypted {
 		return nil, errors.New("wrong state, requires decryption")
 	}
-	filter := &domain.Filter{
-		EnvFilter:   request.Filter.Env,
-		GroupFilter: request.Filter.Group,
-		TagFilter:   request.Filter.Tag,
-		HostFilter:  request.Filter.Host,
-		FreeFilter:  request.Filter.Free,
-	}
-
-	configEntries, err := getEntriesWithFilterApplied(filter, &state, int(request.Limit))
+	configEntries, err := getEntriesWithFilterApplied(toDomainFilter(request.Filter), &state, int(request.Limit))
 	if err != nil {
 		return nil, err
 	}
@@ -383,6 +607,8 @@ func (j JimServiceImpl) List(ctx context.Context, request *pb.ListRequest) (*pb.
 				Host:      config.Server.Host,
 				Directory: config.Server.Dir,
 			},
+			Source:  config.Source,
+			Aliases: config.Aliases,
 		}
 		valSlice := groupings[title]
 		valSlice = append(valSlice, value)
@@ -409,11 +635,18 @@ func (j JimServiceImpl) readState() serverState {
 }
 
 type serverState struct {
-	isDecrypted           bool
-	encryptedFileContents []byte
-	config                *Config
-	grouping              map[string]*ConfigElement
-	index                 bleve.Index
+	isDecrypted bool
+	// files holds the loaded config files, ordered by precedence
+	files []configFile
+	// jimConfig is the merged view of the decrypted config files
+	jimConfig *configuration.JimConfig
+	// origins tells, which config files the parts of jimConfig were taken from
+	origins configuration.Origins
+	// conflicts lists the tags declared by multiple config files
+	conflicts []configuration.Conflict
+	config    *Config
+	grouping  map[string]*ConfigElement
+	index     bleve.Index
 }
 
 // startTimer starts a timer, that will periodically force the server
@@ -423,7 +656,7 @@ func startTimer(writeChannel chan writeOp) chan interface{} {
 	reset := make(chan interface{}, 1)
 	duration := 90 * time.Minute
 	timer := time.NewTimer(duration)
-	resetState := &serverState{isDecrypted: false, encryptedFileContents: nil}
+	resetState := &serverState{isDecrypted: false, files: nil}
 
 	go func() {
 		for {
@@ -444,13 +677,29 @@ func startTimer(writeChannel chan writeOp) chan interface{} {
 
 func toPbServer(domainServer ServerEntry) *pb.Server {
 	return &pb.Server{
-		Info:     &pb.PublicServerInfo{Host: domainServer.Host, Directory: domainServer.Dir},
-		Port:     int32(domainServer.Port),
-		Username: domainServer.Credentials.Username,
-		Password: domainServer.Credentials.Password,
+		Info:           &pb.PublicServerInfo{Host: domainServer.Host, Directory: domainServer.Dir},
+		Port:           int32(domainServer.Port),
+		Username:       domainServer.Credentials.Username,
+		Password:       domainServer.Credentials.Password,
+		PrivateKey:     domainServer.Credentials.PrivateKey,
+		HostKeys:       domainServer.HostKeys,
+		Forwards:       toPbForwards(domainServer.Forwards),
+		Record:         domainServer.Record,
+		Shell:          domainServer.Shell,
+		StartupCommand: domainServer.StartupCommand,
+		Env:            domainServer.Env,
+		Sources:        domainServer.Sources,
 	}
 }
 
+func toPbForwards(forwards []domain.Forward) []*pb.Forward {
+	var result []*pb.Forward
+	for _, f := range forwards {
+		result = append(result, &pb.Forward{Type: f.Type, Listen: f.Listen, Target: f.Target})
+	}
+	return result
+}
+
 // Config is a type alias for a list of config elements
 type Config []ConfigElement
 
@@ -460,6 +709,12 @@ type ConfigElement struct {
 	Env    string
 	Tag    string
 	Server ServerEntry
+	// Labels holds the free key value pairs of the element
+	Labels map[string]string
+	// Aliases lists the further names of the element
+	Aliases []string
+	// Source is the path of the config file declaring the element
+	Source string
 }
 
 func (c ConfigElement) String() string {
@@ -472,21 +727,81 @@ type ServerEntry struct {
 	Dir         string
 	Port        int
 	Credentials credentials
+	HostKeys    []string
+	// Jump lists the tags of the jump hosts
+	Jump []string
+	// Forwards lists the declared port forwards
+	Forwards []domain.Forward
+	// Record is true, if connect sessions have to be recorded
+	Record bool
+	// Shell, StartupCommand and Env configure sessions
+	Shell          string
+	StartupCommand string
+	Env            map[string]string
+	// Sources tells for each setting, whether it was set by the entry or inherited from the defaults
+	Sources map[string]string
 }
 
 type credentials struct {
 	Username string
 	Password []byte
+	// PrivateKey holds the unencrypted private key in PEM format
+	PrivateKey []byte
 }
 
 func toServerConfig(jimConfig *configuration.JimConfig) (*Config, error) {
+	// aliases must not clash with any tag or alias of the vault, names maps them to the tag of their entry
+	names := make(map[string]string)
+	for _, el := range jimConfig.Entries {
+		names[el.Tag] = el.Tag
+	}
+	for _, el := range jimConfig.Entries {
+		for _, alias := range el.Aliases {
+			if owner, ok := names[alias]; ok {
+				return nil, errors.Errorf("The alias '%s' of entry '%s' is already used by the entry '%s'", alias, el.Tag, owner)
+			}
+			names[alias] = el.Tag
+		}
+	}
+
 	var result Config
-	for _, el := range *jimConfig {
-		server := el.Server
-		port, err := strconv.Atoi(server.Port)
+	for _, el := range jimConfig.Entries {
+		server, sources := jimConfig.Resolve(&el)
+		if server.Port < 1 || server.Port > 65535 {
+			return nil, errors.Errorf("Encountered invalid port in config file for entry '%s': %d", el.Tag, server.Port)
+		}
+
+		privateKey, err := decryptPrivateKey(jimConfig, &el, &server)
 		if err != nil {
-			return nil, errors.Errorf("Encountered invalid port in config file: %s", server.Port)
+			return nil, err
+		}
+
+		var forwards []domain.Forward
+		for _, f := range server.Forwards {
+			forward := domain.Forward{Type: f.Type, Listen: f.Listen, Target: f.Target}
+			if err := forward.Validate(); err != nil {
+				return nil, errors.Errorf("Entry '%s' declares an invalid forward: %s", el.Tag, err)
+			}
+			forwards = append(forwards, forward)
+		}
+
+		for name := range server.Env {
+			if !sshclient.IsValidEnvName(name) {
+				return nil, errors.Errorf("Entry '%s' declares the invalid environment variable '%s'", el.Tag, name)
+			}
+		}
+
+		for name := range el.Labels {
+			if !domain.IsValidLabelName(name) {
+				return nil, errors.Errorf("Entry '%s' declares the invalid label '%s'", el.Tag, name)
+			}
+		}
+
+		record := jimConfig.IsRecorded(&el)
+		if record && !server.Record {
+			sources["record"] = "recording section"
 		}
+
 		newEl := ConfigElement{
 			Group: el.Group,
 			Env:   el.Env,
@@ -494,23 +809,105 @@ func toServerConfig(jimConfig *configuration.JimConfig) (*Config, error) {
 			Server: ServerEntry{
 				Host: server.Host,
 				Dir:  server.Dir,
-				Port: port,
+				Port: server.Port,
 				Credentials: credentials{
-					Username: server.Username,
-					Password: []byte(server.Password),
+					Username:   server.Username,
+					Password:   []byte(server.Password),
+					PrivateKey: privateKey,
 				},
+				HostKeys:       server.HostKeys,
+				Jump:           server.Jump,
+				Forwards:       forwards,
+				Record:         record,
+				Shell:          server.Shell,
+				StartupCommand: server.StartupCommand,
+				Env:            server.Env,
+				Sources:        sources,
 			},
+			Labels:  el.Labels,
+			Aliases: el.Aliases,
 		}
 		result = append(result, newEl)
 	}
+
+	// make sure all jump host chains can be resolved
+	groupTable := buildGroupTable(&result)
+	for _, el := range result {
+		if _, err := resolveJumps(&el, groupTable); err != nil {
+			return nil, err
+		}
+	}
 	return &result, nil
 }
 
+// decryptPrivateKey returns the unencrypted private key, the resolved entry authenticates with.
+// Returns nil, if the entry doesn't use key authentication.
+func decryptPrivateKey(jimConfig *configuration.JimConfig, el *configuration.JimConfigElement, entry *configuration.JimConfigEntry) ([]byte, error) {
+	keyPem, passphrase, ok := jimConfig.PrivateKeyOf(el, entry)
+	if !ok {
+		return nil, errors.Errorf("Entry '%s' references the unknown key '%s'", el.Tag, entry.KeyRef)
+	}
+	if keyPem == "" {
+		return nil, nil
+	}
+
+	privateKey, err := crypto.DecryptPrivateKey([]byte(keyPem), []byte(passphrase))
+	if err != nil {
+		return nil, errors.Errorf("Failed to read the private key of entry '%s': %s", el.Tag, err)
+	}
+	return privateKey, nil
+}
+
+// resolveJumps returns the complete chain of jump hosts required to reach the element, starting with the first hop.
+// Jump hosts, which themselves require jump hosts, are expanded recursively.
+func resolveJumps(el *ConfigElement, grouping map[string]*ConfigElement) ([]*ConfigElement, error) {
+	return resolveJumpsVisiting(el, grouping, map[string]bool{el.Tag: true})
+}
+
+func resolveJumpsVisiting(el *ConfigElement, grouping map[string]*ConfigElement, visiting map[string]bool) ([]*ConfigElement, error) {
+	var chain []*ConfigElement
+	for _, tag := range el.Server.Jump {
+		jump, ok := grouping[tag]
+		if !ok {
+			return nil, errors.Errorf("Entry '%s' references the unknown jump host '%s'", el.Tag, tag)
+		}
+		// jump hosts may be referenced by alias, so the visited entries are tracked by tag
+		if visiting[jump.Tag] {
+			return nil, errors.Errorf("Entry '%s' references the jump host '%s', which leads to a cycle", el.Tag, tag)
+		}
+
+		visiting[jump.Tag] = true
+		jumpChain, err := resolveJumpsVisiting(jump, grouping, visiting)
+		if err != nil {
+			return nil, err
+		}
+		delete(visiting, jump.Tag)
+
+		chain = append(chain, jumpChain...)
+		chain = append(chain, jump)
+	}
+	return chain, nil
+}
+
 type indexDocument struct {
 	Group string `json:"group"`
 	Env   string `json:"env"`
 	Tag   string `json:"tag"`
 	Host  string `json:"host"`
+	// Labels are indexed as labels.<name>
+	Labels  map[string]string `json:"labels"`
+	Aliases []string          `json:"aliases"`
+}
+
+func indexDocumentOf(entry *ConfigElement) indexDocument {
+	return indexDocument{
+		Group:   entry.Group,
+		Env:     entry.Env,
+		Tag:     entry.Tag,
+		Host:    entry.Server.Host,
+		Labels:  entry.Labels,
+		Aliases: entry.Aliases,
+	}
 }
 
 func (i indexDocument) Type() string {
@@ -527,6 +924,12 @@ func buildIndexMapping() *mapping.IndexMappingImpl {
 	entryMapping.AddFieldMappingsAt("group", englishTextFieldMapping)
 	entryMapping.AddFieldMappingsAt("env", englishTextFieldMapping)
 	entryMapping.AddFieldMappingsAt("host", englishTextFieldMapping)
+	entryMapping.AddFieldMappingsAt("aliases", englishTextFieldMapping)
+
+	// the names of the labels are unknown upfront, so all their fields are mapped dynamically
+	labelsMapping := bleve.NewDocumentMapping()
+	labelsMapping.DefaultAnalyzer = en.AnalyzerName
+	entryMapping.AddSubDocumentMapping("labels", labelsMapping)
 
 	indexMapping := bleve.NewIndexMapping()
 	indexMapping.AddDocumentMapping("indexDocument", entryMapping)
@@ -536,6 +939,28 @@ func buildIndexMapping() *mapping.IndexMappingImpl {
 	return indexMapping
 }
 
+// buildIndex returns the search index for the config. The index of an identical config is reused.
+func buildIndex(resultConfig *Config) (bleve.Index, error) {
+	hash, err := hashstructure.Hash(resultConfig, hashstructure.FormatV2, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to hash the config")
+	}
+	return createIndex(strconv.Itoa(int(hash)), resultConfig)
+}
+
+// needsNewIndex tells, whether the indexed attributes of the entries differ between the configs
+func needsNewIndex(old *Config, new *Config) bool {
+	if len(*old) != len(*new) {
+		return true
+	}
+	for i := range *old {
+		if !reflect.DeepEqual(indexDocumentOf(&(*old)[i]), indexDocumentOf(&(*new)[i])) {
+			return true
+		}
+	}
+	return false
+}
+
 func createIndex(suffix string, resultConfig *Config) (bleve.Index, error) {
 	defer timeTrack(time.Now(), "createIndex")
 	indexName := "jimdex_" + suffix
@@ -574,12 +999,8 @@ func indexDocuments(index bleve.Index, resultConfig *Config) error {
 	batch := index.NewBatch()
 	batchCount := 0
 	for i, entry := range *resultConfig {
-		err := batch.Index(strconv.Itoa(i), &indexDocument{
-			Group: entry.Group,
-			Env:   entry.Env,
-			Tag:   entry.Tag,
-			Host:  entry.Server.Host,
-		})
+		document := indexDocumentOf(&entry)
+		err := batch.Index(strconv.Itoa(i), &document)
 		if err != nil {
 			return err
 		}
@@ -651,6 +1072,20 @@ func getEntriesWithFilterApplied(filter *domain.Filter, state *serverState, limi
 			q := bleve.NewMatchQuery(fmt.Sprintf("\"%s\"", filter.FreeFilter))
 			queries = append(queries, q)
 		}
+		if filter.HasLabelFilters() {
+			names := make([]string, 0, len(filter.LabelFilters))
+			for name := range filter.LabelFilters {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				// unlike the other categories, the label's field is searched only, all terms of the value must match
+				q := bleve.NewMatchQuery(filter.LabelFilters[name])
+				q.SetField("labels." + name)
+				q.SetOperator(query.MatchQueryOperatorAnd)
+				queries = append(queries, q)
+			}
+		}
 
 		// construct query
 		q := bleve.NewConjunctionQuery(queries...)
@@ -0,0 +1,505 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/CryoCodec/jim/core/domain"
+	pb "github.com/CryoCodec/jim/internal/proto"
+	"github.com/CryoCodec/jim/sshclient"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 1 * time.Minute
+	keepAliveInterval = 30 * time.Second
+	keepAliveTimeout  = 15 * time.Second
+	targetDialTimeout = 15 * time.Second
+	// firstAttemptTimeout limits, how long StartTunnels waits for the tunnels to connect
+	firstAttemptTimeout = 10 * time.Second
+)
+
+func (j JimServiceImpl) StartTunnels(ctx context.Context, request *pb.StartTunnelsRequest) (*pb.TunnelsReply, error) {
+	defer timeTrack(time.Now(), "StartTunnels")
+
+	state := j.readState()
+	if !state.isDecrypted {
+		return nil, errors.New("wrong state, requires decryption")
+	}
+
+	configEl, ok := state.grouping[request.Tag]
+	if !ok {
+		return tunnelsReplyFail(fmt.Sprintf("There is no entry with tag '%s'", request.Tag)), nil
+	}
+	match, err := toDomainMatch(configEl, state.grouping)
+	if err != nil {
+		return tunnelsReplyFail(err.Error()), nil
+	}
+
+	forwards := configEl.Server.Forwards
+	if len(request.Forwards) != 0 {
+		forwards = nil
+		for _, f := range request.Forwards {
+			forward := domain.Forward{Type: f.Type, Listen: f.Listen, Target: f.Target}
+			if err := forward.Validate(); err != nil {
+				return tunnelsReplyFail(fmt.Sprintf("Invalid forward: %s", err)), nil
+			}
+			forwards = append(forwards, forward)
+		}
+	}
+	if len(forwards) == 0 {
+		return tunnelsReplyFail(fmt.Sprintf("Entry '%s' declares no forwards", request.Tag)), nil
+	}
+
+	tunnels, err := j.tunnels.start(match, forwards)
+	if err != nil {
+		return tunnelsReplyFail(err.Error()), nil
+	}
+
+	// give the tunnels a chance to connect, so the client sees errors like failed authentication right away
+	deadline := time.After(firstAttemptTimeout)
+	for _, t := range tunnels {
+		select {
+		case <-t.firstAttempt:
+		case <-deadline:
+		}
+	}
+
+	j.timerResetChannel <- true // resets the timer
+	return &pb.TunnelsReply{ResponseType: pb.ResponseType_SUCCESS, Tunnels: toPbTunnels(tunnels)}, nil
+}
+
+func (j JimServiceImpl) StopTunnels(ctx context.Context, request *pb.StopTunnelsRequest) (*pb.TunnelsReply, error) {
+	defer timeTrack(time.Now(), "StopTunnels")
+
+	ids := make(map[int]bool)
+	for _, id := range request.Ids {
+		ids[int(id)] = true
+	}
+
+	stopped := j.tunnels.stop(func(t *tunnel) bool {
+		return request.All || ids[t.id] || (request.Tag != "" && request.Tag == t.match.Tag)
+	})
+	return &pb.TunnelsReply{ResponseType: pb.ResponseType_SUCCESS, Tunnels: toPbTunnels(stopped)}, nil
+}
+
+func (j JimServiceImpl) ListTunnels(ctx context.Context, request *pb.ListTunnelsRequest) (*pb.TunnelsReply, error) {
+	defer timeTrack(time.Now(), "ListTunnels")
+
+	return &pb.TunnelsReply{ResponseType: pb.ResponseType_SUCCESS, Tunnels: toPbTunnels(j.tunnels.list())}, nil
+}
+
+func tunnelsReplyFail(reason string) *pb.TunnelsReply {
+	return &pb.TunnelsReply{ResponseType: pb.ResponseType_FAILURE, Reason: reason}
+}
+
+func toPbTunnels(tunnels []*tunnel) []*pb.Tunnel {
+	var result []*pb.Tunnel
+	for _, t := range tunnels {
+		result = append(result, t.toPb())
+	}
+	return result
+}
+
+// tunnelManager keeps track of the port forwards kept open by the daemon
+type tunnelManager struct {
+	lock    sync.Mutex
+	tunnels []*tunnel
+	nextID  int
+}
+
+func newTunnelManager() *tunnelManager {
+	return &tunnelManager{nextID: 1}
+}
+
+// start opens the forwards through the matched server. Forwards, that are already open, are not opened twice.
+// Local forwards are bound right away, so a port in use fails the whole call.
+func (m *tunnelManager) start(match *domain.Match, forwards []domain.Forward) ([]*tunnel, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var result []*tunnel
+	var created []*tunnel
+	for _, forward := range forwards {
+		if existing := m.find(match.Tag, forward); existing != nil {
+			result = append(result, existing)
+			continue
+		}
+
+		t := newTunnel(match, forward)
+		if forward.Type == domain.LocalForward {
+			listener, err := net.Listen("tcp", forward.ListenAddress())
+			if err != nil {
+				for _, c := range created {
+					c.listener.Close()
+				}
+				return nil, errors.Wrapf(err, "failed to listen on %s", forward.ListenAddress())
+			}
+			t.listener = listener
+		}
+		created = append(created, t)
+		result = append(result, t)
+	}
+
+	for _, t := range created {
+		t.id = m.nextID
+		m.nextID++
+		m.tunnels = append(m.tunnels, t)
+		log.Printf("Starting tunnel %d to '%s': %s", t.id, match.Tag, t.forward)
+		go t.run()
+	}
+	return result, nil
+}
+
+func (m *tunnelManager) find(tag string, forward domain.Forward) *tunnel {
+	for _, t := range m.tunnels {
+		if t.match.Tag == tag && t.forward == forward {
+			return t
+		}
+	}
+	return nil
+}
+
+// stop closes all tunnels, for which shouldStop returns true. Returns the closed tunnels.
+func (m *tunnelManager) stop(shouldStop func(t *tunnel) bool) []*tunnel {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var stopped []*tunnel
+	var remaining []*tunnel
+	for _, t := range m.tunnels {
+		if shouldStop(t) {
+			t.close()
+			log.Printf("Stopped tunnel %d to '%s'", t.id, t.match.Tag)
+			stopped = append(stopped, t)
+		} else {
+			remaining = append(remaining, t)
+		}
+	}
+	m.tunnels = remaining
+	return stopped
+}
+
+// stopAll closes all tunnels, e.g. because the vault is locked
+func (m *tunnelManager) stopAll() {
+	m.stop(func(t *tunnel) bool { return true })
+}
+
+func (m *tunnelManager) list() []*tunnel {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]*tunnel{}, m.tunnels...)
+}
+
+// tunnel is a single port forward, which reconnects until it is closed
+type tunnel struct {
+	id      int
+	match   *domain.Match
+	forward domain.Forward
+	since   time.Time
+	// listener accepts the connections of local forwards
+	listener net.Listener
+	// stopped is closed, once the tunnel is closed
+	stopped  chan struct{}
+	stopOnce sync.Once
+	// firstAttempt is closed, once the first connection attempt has finished
+	firstAttempt     chan struct{}
+	firstAttemptOnce sync.Once
+
+	connections   int32
+	bytesSent     int64
+	bytesReceived int64
+
+	lock      sync.Mutex
+	state     int
+	lastError string
+	client    *ssh.Client
+}
+
+func newTunnel(match *domain.Match, forward domain.Forward) *tunnel {
+	return &tunnel{
+		match:        match,
+		forward:      forward,
+		since:        time.Now(),
+		stopped:      make(chan struct{}),
+		firstAttempt: make(chan struct{}),
+		state:        domain.TunnelConnecting,
+	}
+}
+
+// run keeps the tunnel connected until it is closed. Reconnects are delayed with exponential backoff.
+func (t *tunnel) run() {
+	if t.listener != nil {
+		go t.acceptLocal()
+	}
+
+	delay := minReconnectDelay
+	for {
+		connectedAt := time.Now()
+		err := t.connect()
+		if t.isStopped() {
+			return
+		}
+
+		log.Printf("Tunnel %d to '%s' failed: %s", t.id, t.match.Tag, err)
+		t.setState(domain.TunnelReconnecting, err)
+		t.firstAttemptOnce.Do(func() { close(t.firstAttempt) })
+
+		// a connection, that was up for a while, is retried right away
+		if time.Since(connectedAt) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+		select {
+		case <-t.stopped:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connect opens the SSH connection and forwards connections, until it breaks down or the tunnel is closed.
+// Host keys must be pinned, since the daemon can't ask the user.
+func (t *tunnel) connect() error {
+	client, err := sshclient.Dial(t.match, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if t.forward.Type == domain.RemoteForward {
+		listener, err := client.Listen("tcp", t.forward.ListenAddress())
+		if err != nil {
+			return errors.Wrapf(err, "failed to listen on %s at the server", t.forward.ListenAddress())
+		}
+		defer listener.Close()
+		go t.acceptRemote(listener)
+	}
+
+	t.setClient(client)
+	defer t.setClient(nil)
+	t.setState(domain.TunnelUp, nil)
+	t.firstAttemptOnce.Do(func() { close(t.firstAttempt) })
+	log.Printf("Tunnel %d to '%s' is up", t.id, t.match.Tag)
+
+	return t.keepAlive(client)
+}
+
+// keepAlive waits until the connection breaks down or the tunnel is closed.
+// Keepalive requests detect connections, that broke down without being closed.
+func (t *tunnel) keepAlive(client *ssh.Client) error {
+	closed := make(chan error, 1)
+	go func() { closed <- client.Wait() }()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopped:
+			return nil
+		case err := <-closed:
+			return errors.Errorf("connection lost: %v", err)
+		case <-ticker.C:
+			if err := sendKeepAlive(client); err != nil {
+				return errors.Wrap(err, "keepalive failed")
+			}
+		}
+	}
+}
+
+func sendKeepAlive(client *ssh.Client) error {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+
+	select {
+	case err := <-reply:
+		return err
+	case <-time.After(keepAliveTimeout):
+		return errors.New("the server didn't answer in time")
+	}
+}
+
+// acceptLocal forwards the connections accepted by a local forward through the current SSH connection
+func (t *tunnel) acceptLocal() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if t.isStopped() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Tunnel %d failed to accept a connection: %s", t.id, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		client := t.currentClient()
+		if client == nil {
+			// reconnecting
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			target, err := client.Dial("tcp", t.forward.Target)
+			if err != nil {
+				t.setError(errors.Wrapf(err, "failed to connect to %s", t.forward.Target))
+				conn.Close()
+				return
+			}
+			t.pipe(conn, target)
+		}()
+	}
+}
+
+// acceptRemote forwards the connections accepted at the server by a remote forward to the target
+func (t *tunnel) acceptRemote(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			target, err := net.DialTimeout("tcp", t.forward.Target, targetDialTimeout)
+			if err != nil {
+				t.setError(errors.Wrapf(err, "failed to connect to %s", t.forward.Target))
+				conn.Close()
+				return
+			}
+			t.pipe(conn, target)
+		}()
+	}
+}
+
+// pipe copies data in both directions, until both sides are done or the tunnel is closed
+func (t *tunnel) pipe(source net.Conn, target net.Conn) {
+	defer source.Close()
+	defer target.Close()
+
+	atomic.AddInt32(&t.connections, 1)
+	defer atomic.AddInt32(&t.connections, -1)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(&countingWriter{writer: target, count: &t.bytesSent}, source)
+		closeWrite(target)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&countingWriter{writer: source, count: &t.bytesReceived}, target)
+		closeWrite(source)
+		done <- struct{}{}
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-t.stopped:
+			return
+		}
+	}
+}
+
+// closeWrite signals the end of the data, while the other direction may still be in use
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	atomic.AddInt64(w.count, int64(n))
+	return n, err
+}
+
+func (t *tunnel) close() {
+	t.stopOnce.Do(func() {
+		close(t.stopped)
+		if t.listener != nil {
+			t.listener.Close()
+		}
+	})
+}
+
+func (t *tunnel) isStopped() bool {
+	select {
+	case <-t.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *tunnel) currentClient() *ssh.Client {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.client
+}
+
+func (t *tunnel) setClient(client *ssh.Client) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.client = client
+}
+
+// setState updates the state. The last error is kept, if err is nil.
+func (t *tunnel) setState(state int, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.state = state
+	if err != nil {
+		t.lastError = err.Error()
+	}
+}
+
+func (t *tunnel) setError(err error) {
+	log.Printf("Tunnel %d to '%s': %s", t.id, t.match.Tag, err)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lastError = err.Error()
+}
+
+func (t *tunnel) toPb() *pb.Tunnel {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	state := pb.Tunnel_CONNECTING
+	switch t.state {
+	case domain.TunnelUp:
+		state = pb.Tunnel_UP
+	case domain.TunnelReconnecting:
+		state = pb.Tunnel_RECONNECTING
+	}
+
+	return &pb.Tunnel{
+		Id:            int32(t.id),
+		Tag:           t.match.Tag,
+		Forward:       &pb.Forward{Type: t.forward.Type, Listen: t.forward.Listen, Target: t.forward.Target},
+		State:         state,
+		Since:         t.since.Unix(),
+		Connections:   atomic.LoadInt32(&t.connections),
+		BytesSent:     atomic.LoadInt64(&t.bytesSent),
+		BytesReceived: atomic.LoadInt64(&t.bytesReceived),
+		LastError:     t.lastError,
+	}
+}
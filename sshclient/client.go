@@ -0,0 +1,224 @@
+// Package sshclient implements jim's native SSH client, which is used to open sessions on the configured servers
+// without depending on external binaries like ssh or sshpass.
+package sshclient
+
+import (
+	"fmt"
+	"github.com/CryoCodec/jim/core/domain"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const dialTimeout = 15 * time.Second
+
+// Dial opens an authenticated SSH connection to the matched server, tunneled through its jump hosts.
+// Servers configured with a private key or password authenticate with those, all others fall back to
+// the local ssh-agent and the default identity files in ~/.ssh.
+// Host keys are verified against the keys pinned for each entry, onUnknown decides about
+// servers without pinned keys. A nil handler rejects unknown host keys.
+func Dial(match *domain.Match, onUnknown UnknownHostKeyHandler) (*ssh.Client, error) {
+	hops := append(append([]domain.Hop{}, match.Jumps...), domain.Hop{Tag: match.Tag, Server: match.Server})
+
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	for _, hop := range hops {
+		var via *ssh.Client
+		if len(clients) != 0 {
+			via = clients[len(clients)-1]
+		}
+
+		client, err := dialHop(via, &hop, onUnknown)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	target := clients[len(clients)-1]
+	if len(clients) > 1 {
+		// the connections to the jump hosts are no longer needed, once the target connection is gone
+		go func() {
+			target.Wait()
+			closeAll()
+		}()
+	}
+	return target, nil
+}
+
+// dialHop connects to the hop directly, or through the given client if it's not nil
+func dialHop(via *ssh.Client, hop *domain.Hop, onUnknown UnknownHostKeyHandler) (*ssh.Client, error) {
+	server := &hop.Server
+	hostKeyCallback, err := HostKeyCallback(hop.Tag, server.HostKeys, onUnknown)
+	if err != nil {
+		return nil, err
+	}
+
+	config, closeAgent := clientConfig(server, hostKeyCallback)
+	// the ssh-agent is only asked during the handshake, which authenticates the connection
+	defer closeAgent()
+	config.HostKeyAlgorithms = HostKeyAlgorithms(server.HostKeys)
+	addr := address(server)
+	log.Debugf("Dialing %s as %s for '%s'", addr, server.Username, hop.Tag)
+
+	conn, err := dialConn(via, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func dialConn(via *ssh.Client, addr string) (net.Conn, error) {
+	if via == nil {
+		return net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	return via.Dial("tcp", addr)
+}
+
+// FetchHostKey connects to the matched server through its jump hosts and returns the host key it presents,
+// without authenticating against the server itself. Jump hosts are verified with onUnknown like in Dial.
+func FetchHostKey(match *domain.Match, onUnknown UnknownHostKeyHandler) (ssh.PublicKey, error) {
+	var via *ssh.Client
+	if len(match.Jumps) != 0 {
+		jumpMatch := &domain.Match{
+			Tag:    match.Jumps[len(match.Jumps)-1].Tag,
+			Server: match.Jumps[len(match.Jumps)-1].Server,
+			Jumps:  match.Jumps[:len(match.Jumps)-1],
+		}
+		client, err := Dial(jumpMatch, onUnknown)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		via = client
+	}
+
+	var hostKey ssh.PublicKey
+	errCaptured := errors.New("host key captured")
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		return errCaptured
+	}
+
+	server := &match.Server
+	addr := address(server)
+	conn, err := dialConn(via, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	config, closeAgent := clientConfig(server, callback)
+	defer closeAgent()
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	if hostKey != nil {
+		return hostKey, nil
+	}
+	return nil, fmt.Errorf("failed to retrieve the host key of %s: %w", addr, err)
+}
+
+func address(server *domain.Server) string {
+	return net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+}
+
+// clientConfig returns the config to authenticate at the server and a function, which closes the connection
+// to the ssh-agent, once the handshake is done
+func clientConfig(server *domain.Server, hostKeyCallback ssh.HostKeyCallback) (*ssh.ClientConfig, func()) {
+	methods, closeAgent := authMethods(server)
+	return &ssh.ClientConfig{
+		User:            server.Username,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}, closeAgent
+}
+
+func authMethods(server *domain.Server) ([]ssh.AuthMethod, func()) {
+	closeAgent := func() {}
+	var methods []ssh.AuthMethod
+	if len(server.PrivateKey) != 0 {
+		signer, err := ssh.ParsePrivateKey(server.PrivateKey)
+		if err != nil {
+			log.Warnf("Ignoring the invalid private key of %s: %s", server.Host, err)
+		} else {
+			methods = append(methods, ssh.PublicKeys(signer))
+		}
+	}
+
+	if len(server.Password) != 0 {
+		password := string(server.Password)
+		methods = append(methods,
+			ssh.Password(password),
+			// some servers only offer keyboard-interactive, answer every prompt with the password
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		)
+	}
+
+	if len(methods) != 0 {
+		return methods, closeAgent
+	}
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			log.Debugf("Could not reach the ssh-agent at %s: %s", socket, err)
+		} else {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	if signers := defaultIdentities(); len(signers) != 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, closeAgent
+}
+
+// defaultIdentities loads the unencrypted default identity files from ~/.ssh
+func defaultIdentities() []ssh.Signer {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(homeDir, ".ssh", name)
+		pemBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			log.Debugf("Skipping identity file %s: %s", path, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
@@ -0,0 +1,91 @@
+package sshclient
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/CryoCodec/jim/core/domain"
+)
+
+var safeWord = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var tildePrefix = regexp.MustCompile(`^~[A-Za-z0-9_.-]*$`)
+
+// defaultShell starts the login shell of the user, like ssh does without a command
+const defaultShell = `exec "${SHELL:-/bin/sh}" -l`
+
+// Quote quotes s for POSIX shells, so the remote side receives it as a single word
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if safeWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// IsValidEnvName returns true, if name can be used as name of an environment variable
+func IsValidEnvName(name string) bool {
+	return envName.MatchString(name)
+}
+
+// SessionCommand builds the command sent to the server, which changes into the server's directory and exports
+// its environment variables. A leading ~ or ~user of the directory is expanded by the remote shell, variables like
+// $HOME are not expanded, neither in the directory nor in the values of the environment. Without command, the
+// startup command is run and the shell is started for an interactive session, which starts in the home directory,
+// if the directory can't be entered. Otherwise the command is run, inside the configured shell if there is one,
+// and fails if the directory can't be entered.
+func SessionCommand(server *domain.Server, command string) string {
+	var lines []string
+	if server.Dir != "" {
+		cd := "cd " + quoteDir(server.Dir)
+		if command != "" {
+			cd += " || exit 1"
+		}
+		lines = append(lines, cd)
+	}
+
+	var names []string
+	for name := range server.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, "export "+name+"="+Quote(server.Env[name]))
+	}
+
+	switch {
+	case command == "":
+		if server.StartupCommand != "" {
+			lines = append(lines, server.StartupCommand)
+		}
+		if server.Shell != "" {
+			lines = append(lines, "exec "+Quote(server.Shell))
+		} else {
+			lines = append(lines, defaultShell)
+		}
+	case server.Shell != "":
+		lines = append(lines, "exec "+Quote(server.Shell)+" -c "+Quote(command))
+	default:
+		lines = append(lines, command)
+	}
+	// separate by new lines, so a startup command ending with & doesn't break the syntax
+	return strings.Join(lines, "\n")
+}
+
+// quoteDir quotes the directory like Quote, but leaves a leading ~ or ~user unquoted for the tilde expansion
+func quoteDir(dir string) string {
+	prefix, rest := dir, ""
+	if i := strings.Index(dir, "/"); i >= 0 {
+		prefix, rest = dir[:i], dir[i+1:]
+	}
+	if !tildePrefix.MatchString(prefix) {
+		return Quote(dir)
+	}
+	if rest == "" {
+		return prefix + "/"
+	}
+	return prefix + "/" + Quote(rest)
+}
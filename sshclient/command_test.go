@@ -0,0 +1,56 @@
+package sshclient
+
+import (
+	"testing"
+
+	"github.com/CryoCodec/jim/core/domain"
+)
+
+func TestSessionCommandDir(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/srv/app", "cd /srv/app"},
+		{"/srv/my app", "cd '/srv/my app'"},
+		{"~", "cd ~/"},
+		{"~/", "cd ~/"},
+		{"~/app", "cd ~/app"},
+		{"~/my app", "cd ~/'my app'"},
+		{"~deploy/app", "cd ~deploy/app"},
+		{"~$(reboot)/app", "cd '~$(reboot)/app'"},
+		{"$HOME/app", "cd '$HOME/app'"},
+		{"app/~", "cd 'app/~'"},
+	}
+	for _, test := range tests {
+		server := &domain.Server{Dir: test.dir, Shell: "bash"}
+		want := test.want + " || exit 1\nexec bash -c true"
+		if got := SessionCommand(server, "true"); got != want {
+			t.Errorf("SessionCommand with dir %q = %q, want %q", test.dir, got, want)
+		}
+	}
+}
+
+func TestSessionCommandInteractive(t *testing.T) {
+	server := &domain.Server{Dir: "/srv/app", Env: map[string]string{"LANG": "C.UTF-8"}, StartupCommand: "uptime"}
+	// the interactive shell starts in the home directory, if the dir doesn't exist
+	want := "cd /srv/app\nexport LANG=C.UTF-8\nuptime\n" + defaultShell
+	if got := SessionCommand(server, ""); got != want {
+		t.Errorf("SessionCommand = %q, want %q", got, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"":          "''",
+		"plain":     "plain",
+		"two words": "'two words'",
+		"it's":      `'it'"'"'s'`,
+		"$HOME":     "'$HOME'",
+	}
+	for in, want := range tests {
+		if got := Quote(in); got != want {
+			t.Errorf("Quote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package sshclient
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strings"
+)
+
+// UnknownHostKeyHandler is invoked whenever a server presents a host key, while no key
+// is pinned for its entry yet. Returning nil trusts the key for the current connection.
+type UnknownHostKeyHandler func(tag string, hostname string, key ssh.PublicKey) error
+
+// HostKeyMismatchError is returned, when the key presented by the server
+// does not match any of the keys pinned for its entry.
+type HostKeyMismatchError struct {
+	Tag         string
+	Hostname    string
+	Fingerprint string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf(`The host key of entry '%s' (%s) has changed!
+Someone could be eavesdropping on you right now (man-in-the-middle attack).
+It is also possible that the host key has just been changed.
+The fingerprint of the presented key is %s.
+If you trust the new key run 'jim hostkeys accept %s'`, e.Tag, e.Hostname, e.Fingerprint, e.Tag)
+}
+
+// ErrHostKeyRejected is returned by handlers, if the user did not trust an unknown host key.
+var ErrHostKeyRejected = errors.New("the host key was not accepted")
+
+// HostKeyCallback creates a callback, which verifies the presented host key against the pinned keys.
+// The pinned keys must be in authorized_keys format. If there are no pinned keys,
+// the decision is delegated to onUnknown.
+func HostKeyCallback(tag string, pinned []string, onUnknown UnknownHostKeyHandler) (ssh.HostKeyCallback, error) {
+	keys, err := ParseHostKeys(pinned)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid host key pinned for entry '%s'", tag)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if len(keys) == 0 {
+			if onUnknown == nil {
+				return errors.Errorf("no host key is pinned for entry '%s', run 'jim hostkeys accept %s' first", tag, tag)
+			}
+			return onUnknown(tag, hostname, key)
+		}
+
+		for _, k := range keys {
+			if k.Type() == key.Type() && string(k.Marshal()) == string(key.Marshal()) {
+				return nil
+			}
+		}
+		return &HostKeyMismatchError{Tag: tag, Hostname: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+	}, nil
+}
+
+// HostKeyAlgorithms returns the algorithms to negotiate, so the server presents one of the pinned keys.
+// Returns nil if no keys are pinned, which lets the server choose.
+func HostKeyAlgorithms(pinned []string) []string {
+	keys, err := ParseHostKeys(pinned)
+	if err != nil {
+		return nil
+	}
+
+	var algorithms []string
+	for _, key := range keys {
+		if key.Type() == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		} else {
+			algorithms = append(algorithms, key.Type())
+		}
+	}
+	return algorithms
+}
+
+// ParseHostKeys parses keys in authorized_keys format.
+func ParseHostKeys(pinned []string) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for _, line := range pinned {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// MarshalHostKey serializes a key to a single line in authorized_keys format.
+func MarshalHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// FingerprintOf returns the SHA256 fingerprint of a key in authorized_keys format.
+func FingerprintOf(authorizedKey string) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
@@ -0,0 +1,58 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"strconv"
+)
+
+// KnownHostsLookup finds the keys listed for a host in an OpenSSH known_hosts file.
+type KnownHostsLookup struct {
+	callback ssh.HostKeyCallback
+	probe    ssh.PublicKey
+}
+
+// NewKnownHostsLookup reads the known_hosts file at given path.
+// Hashed host names and patterns are supported.
+func NewKnownHostsLookup(path string) (*KnownHostsLookup, error) {
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the knownhosts package only exposes the listed keys when verification of a foreign key fails,
+	// so a throwaway key is used to probe the database.
+	probe, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	probeKey, err := ssh.NewPublicKey(probe)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KnownHostsLookup{callback: callback, probe: probeKey}, nil
+}
+
+// Lookup returns the keys listed for the host and port. Returns an empty slice if the host is unknown.
+func (l *KnownHostsLookup) Lookup(host string, port int) []ssh.PublicKey {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	// the remote address is only consulted, if addr is empty
+	remote := &net.TCPAddr{IP: net.IPv4zero, Port: port}
+
+	err := l.callback(addr, remote, l.probe)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var keys []ssh.PublicKey
+	for _, known := range keyErr.Want {
+		keys = append(keys, known.Key)
+	}
+	return keys
+}
@@ -0,0 +1,172 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// forwardedChannelTypes are the channels opened by the server, e.g. for remote port forwards
+var forwardedChannelTypes = []string{"forwarded-tcpip", "forwarded-streamlocal@openssh.com"}
+
+// ServeProxy speaks the SSH server protocol on conn and relays all channels and requests of the client on the other
+// side to the already authenticated connection to the server. This lets external ssh clients use servers, which
+// only jim can authenticate against, e.g. as ProxyCommand. The client is accepted without authentication
+// and sees a host key, which is generated for each call, so conn must only be reachable by the local user.
+// ServeProxy returns, once either connection is closed.
+func ServeProxy(conn net.Conn, client *ssh.Client) error {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the host key of the proxy")
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the host key of the proxy")
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return errors.Wrap(err, "handshake with the ssh client failed")
+	}
+	defer serverConn.Close()
+
+	for _, channelType := range forwardedChannelTypes {
+		go relayChannels(client.HandleChannelOpen(channelType), serverConn)
+	}
+	go relayChannels(chans, client)
+	go relayGlobalRequests(reqs, client)
+
+	// whichever side closes first, terminates the other one
+	done := make(chan error, 2)
+	go func() { done <- serverConn.Wait() }()
+	go func() { done <- client.Wait() }()
+	<-done
+	return nil
+}
+
+// relayChannels opens each new channel on the other connection and copies data and requests in both directions
+func relayChannels(newChannels <-chan ssh.NewChannel, other ssh.Conn) {
+	if newChannels == nil {
+		return
+	}
+	for newChannel := range newChannels {
+		go relayChannel(newChannel, other)
+	}
+}
+
+func relayChannel(newChannel ssh.NewChannel, other ssh.Conn) {
+	otherChannel, otherReqs, err := other.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		otherChannel.Close()
+		return
+	}
+	log.Debugf("Relaying channel %s", newChannel.ChannelType())
+
+	// each side is closed, once the other side closed its channel and all its data and requests were passed on,
+	// so the exit-status of a session arrives before the channel is closed
+	go relay(channel, otherChannel, otherReqs)
+	go relay(otherChannel, channel, reqs)
+}
+
+// relay passes the data and requests of src to dst and closes dst, once src is closed
+func relay(dst ssh.Channel, src ssh.Channel, srcReqs <-chan *ssh.Request) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		relayData(dst, src)
+	}()
+	go func() {
+		defer wg.Done()
+		relayRequests(srcReqs, dst)
+	}()
+	wg.Wait()
+	dst.Close()
+}
+
+// relayData copies stdout and stderr of src to dst, until src sends EOF
+func relayData(dst ssh.Channel, src ssh.Channel) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(dst, src)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(dst.Stderr(), src.Stderr())
+	}()
+	wg.Wait()
+	dst.CloseWrite()
+}
+
+// relayRequests passes channel requests, like pty-req, exec or exit-status, to the other channel
+func relayRequests(reqs <-chan *ssh.Request, other ssh.Channel) {
+	for req := range reqs {
+		ok, err := other.SendRequest(req.Type, req.WantReply, req.Payload)
+		if err != nil {
+			ok = false
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+// relayGlobalRequests passes connection wide requests, like tcpip-forward, to the server
+func relayGlobalRequests(reqs <-chan *ssh.Request, client *ssh.Client) {
+	for req := range reqs {
+		ok, payload, err := client.SendRequest(req.Type, req.WantReply, req.Payload)
+		if err != nil {
+			ok = false
+		}
+		if req.WantReply {
+			req.Reply(ok, payload)
+		}
+	}
+}
+
+// StdioConn returns a connection reading from stdin and writing to stdout, like a ProxyCommand does
+func StdioConn() net.Conn {
+	return &stdioConn{}
+}
+
+type stdioConn struct{}
+
+func (c *stdioConn) Read(b []byte) (int, error)  { return os.Stdin.Read(b) }
+func (c *stdioConn) Write(b []byte) (int, error) { return os.Stdout.Write(b) }
+func (c *stdioConn) Close() error {
+	os.Stdin.Close()
+	return os.Stdout.Close()
+}
+func (c *stdioConn) LocalAddr() net.Addr                { return stdioAddr{} }
+func (c *stdioConn) RemoteAddr() net.Addr               { return stdioAddr{} }
+func (c *stdioConn) SetDeadline(t time.Time) error      { return nil }
+func (c *stdioConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *stdioConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
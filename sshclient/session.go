@@ -0,0 +1,103 @@
+package sshclient
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const defaultTerm = "xterm-256color"
+
+// RunInteractive runs the command on the remote side inside a pseudo terminal,
+// which is attached to the local terminal. Without a local terminal, e.g. if the output is redirected,
+// no pseudo terminal is allocated. The local terminal is put into raw mode
+// for the duration of the session and window size changes are forwarded.
+// The recorder receives a copy of the session's output, it may be nil.
+// If the remote command exits with a non-zero status, an *ssh.ExitError is returned.
+func RunInteractive(client *ssh.Client, command string, recorder io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open a session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	if recorder != nil {
+		session.Stdout = io.MultiWriter(os.Stdout, recorder)
+		session.Stderr = io.MultiWriter(os.Stderr, recorder)
+	}
+
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+	if term.IsTerminal(stdinFd) && term.IsTerminal(stdoutFd) {
+		width, height, err := term.GetSize(stdoutFd)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = defaultTerm
+		}
+
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("failed to allocate a pseudo terminal: %w", err)
+		}
+
+		oldState, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return fmt.Errorf("failed to put the terminal into raw mode: %w", err)
+		}
+		defer term.Restore(stdinFd, oldState)
+
+		stop := forwardWindowChanges(session, stdoutFd)
+		defer stop()
+	}
+
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("failed to start the remote command: %w", err)
+	}
+	return session.Wait()
+}
+
+// forwardWindowChanges listens for SIGWINCH and propagates the new terminal size to the remote pty.
+// Returns a function to stop listening.
+func forwardWindowChanges(session *ssh.Session, fd int) func() {
+	sigwinch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigwinch, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-sigwinch:
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				if err := session.WindowChange(height, width); err != nil {
+					log.Debugf("Failed to forward the window size: %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigwinch)
+		close(done)
+	}
+}
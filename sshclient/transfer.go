@@ -0,0 +1,210 @@
+package sshclient
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/CryoCodec/jim/core/domain"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+)
+
+// ProgressFunc is notified while a file is transferred.
+// It receives the name of the file, the transferred bytes so far and the size of the file.
+type ProgressFunc func(name string, transferred int64, total int64)
+
+// RemotePath returns the SFTP path of a remote path given on the command line. Relative paths are resolved against
+// the dir of the server. SFTP resolves relative paths against the home directory of the user, so a leading ~/ is
+// stripped. The home directory of another user, like ~deploy, can't be resolved and is rejected.
+func RemotePath(server *domain.Server, remotePath string) (string, error) {
+	if path.IsAbs(remotePath) {
+		return remotePath, nil
+	}
+	if strings.HasPrefix(remotePath, "~") {
+		return homeRelative(remotePath)
+	}
+	if server.Dir == "" {
+		return remotePath, nil
+	}
+
+	dir := server.Dir
+	if strings.HasPrefix(dir, "~") {
+		var err error
+		if dir, err = homeRelative(dir); err != nil {
+			return "", err
+		}
+	}
+	return path.Join(dir, remotePath), nil
+}
+
+// homeRelative turns a path starting with ~ into a path relative to the home directory
+func homeRelative(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return "", errors.Errorf("the path %s refers to the home directory of another user, which is not supported", p)
+	}
+	return path.Clean("./" + p[1:]), nil
+}
+
+// Upload copies the local file or directory to the remote path. Like scp, if the remote path
+// is an existing directory, the source is copied into it. Directories require recursive to be set.
+func Upload(client *sftp.Client, localPath string, remotePath string, recursive bool, progress ProgressFunc) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	if remoteInfo, err := client.Stat(remotePath); err == nil && remoteInfo.IsDir() {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+
+	if !info.IsDir() {
+		return uploadFile(client, localPath, remotePath, info, progress)
+	}
+	if !recursive {
+		return errors.Errorf("%s is a directory, use recursive mode to copy it", localPath)
+	}
+
+	return filepath.Walk(localPath, func(current string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, current)
+		if err != nil {
+			return err
+		}
+		target := path.Join(remotePath, filepath.ToSlash(rel))
+
+		if info.IsDir() {
+			if err := client.MkdirAll(target); err != nil {
+				return errors.Wrapf(err, "failed to create remote directory %s", target)
+			}
+			return client.Chmod(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			// symlinks, devices etc. are skipped
+			return nil
+		}
+		return uploadFile(client, current, target, info, progress)
+	})
+}
+
+// Download copies the remote file or directory to the local path. Like scp, if the local path
+// is an existing directory, the source is copied into it. Directories require recursive to be set.
+func Download(client *sftp.Client, remotePath string, localPath string, recursive bool, progress ProgressFunc) error {
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to access remote path %s", remotePath)
+	}
+
+	if localInfo, err := os.Stat(localPath); err == nil && localInfo.IsDir() {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+
+	if !info.IsDir() {
+		return downloadFile(client, remotePath, localPath, info, progress)
+	}
+	if !recursive {
+		return errors.Errorf("%s is a directory, use recursive mode to copy it", remotePath)
+	}
+
+	walker := client.Walk(remotePath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(remotePath, walker.Path())
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(localPath, rel)
+		info := walker.Stat()
+
+		if info.IsDir() {
+			if err := os.MkdirAll(target, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			// symlinks, devices etc. are skipped
+			continue
+		}
+		if err := downloadFile(client, walker.Path(), target, info, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadFile(client *sftp.Client, localPath string, remotePath string, info os.FileInfo, progress ProgressFunc) error {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create remote file %s", remotePath)
+	}
+	defer dst.Close()
+
+	if err := copyWithProgress(dst, src, remotePath, info.Size(), progress); err != nil {
+		return errors.Wrapf(err, "failed to upload %s", localPath)
+	}
+	// sftp reports failed writes on close
+	if err := dst.Close(); err != nil {
+		return errors.Wrapf(err, "failed to upload %s", localPath)
+	}
+	return client.Chmod(remotePath, info.Mode().Perm())
+}
+
+func downloadFile(client *sftp.Client, remotePath string, localPath string, info os.FileInfo, progress ProgressFunc) error {
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open remote file %s", remotePath)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := copyWithProgress(dst, src, localPath, info.Size(), progress); err != nil {
+		return errors.Wrapf(err, "failed to download %s", remotePath)
+	}
+	return dst.Close()
+}
+
+func copyWithProgress(dst io.Writer, src io.Reader, name string, size int64, progress ProgressFunc) error {
+	if progress == nil {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	progress(name, 0, size)
+	buffer := make([]byte, 32*1024)
+	var transferred int64
+	for {
+		n, err := src.Read(buffer)
+		if n > 0 {
+			if _, err := dst.Write(buffer[:n]); err != nil {
+				return err
+			}
+			transferred += int64(n)
+			progress(name, transferred, size)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package sshclient
+
+import (
+	"testing"
+
+	"github.com/CryoCodec/jim/core/domain"
+)
+
+func TestRemotePath(t *testing.T) {
+	tests := []struct {
+		dir  string
+		path string
+		want string
+	}{
+		{"", "logs/app.log", "logs/app.log"},
+		{"", "/var/log/syslog", "/var/log/syslog"},
+		{"/srv/app", "logs/app.log", "/srv/app/logs/app.log"},
+		{"/srv/app", "/var/log/syslog", "/var/log/syslog"},
+		{"/srv/app", ".", "/srv/app"},
+		{"~", "file", "file"},
+		{"~", "../file", "../file"},
+		{"~/", "file", "file"},
+		{"~/app", "file", "app/file"},
+		{"~/app", "../file", "file"},
+		{"~/app", ".", "app"},
+		{"/srv/app", "~", "."},
+		{"/srv/app", "~/", "."},
+		{"/srv/app", "~/file", "file"},
+		{"/srv/app", "~//logs/app.log", "logs/app.log"},
+		{"", "~/file", "file"},
+	}
+	for _, test := range tests {
+		server := &domain.Server{Dir: test.dir}
+		got, err := RemotePath(server, test.path)
+		if err != nil {
+			t.Errorf("RemotePath(%q, %q) failed: %s", test.dir, test.path, err)
+		} else if got != test.want {
+			t.Errorf("RemotePath(%q, %q) = %q, want %q", test.dir, test.path, got, test.want)
+		}
+	}
+}
+
+func TestRemotePathOfOtherUser(t *testing.T) {
+	tests := []struct {
+		dir  string
+		path string
+	}{
+		{"", "~deploy/file"},
+		{"/srv/app", "~deploy"},
+		{"~deploy/app", "file"},
+	}
+	for _, test := range tests {
+		server := &domain.Server{Dir: test.dir}
+		if got, err := RemotePath(server, test.path); err == nil {
+			t.Errorf("RemotePath(%q, %q) = %q, want an error", test.dir, test.path, got)
+		}
+	}
+}